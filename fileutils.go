@@ -21,7 +21,40 @@ func chooseRendererBaseOnOutfile(filename string) (Renderer, error) {
 		return PngRenderer, nil
 	case ".svg":
 		return SvgRenderer, nil
+	case ".pdf":
+		return PdfRenderer, nil
+	case ".txt":
+		return TextRenderer, nil
+	case ".puml":
+		return PlantUMLRenderer, nil
+	case ".mmd":
+		return MermaidRenderer, nil
+	case ".json":
+		return JSONRenderer, nil
 	}
 
 	return nil, errors.New("Unsupported extension: " + filename)
 }
+
+func chooseRendererByFormat(format string) (Renderer, error) {
+	switch format {
+	case "png":
+		return PngRenderer, nil
+	case "svg":
+		return SvgRenderer, nil
+	case "pdf":
+		return PdfRenderer, nil
+	case "text":
+		return TextRenderer, nil
+	case "ascii":
+		return AsciiRenderer, nil
+	case "plantuml":
+		return PlantUMLRenderer, nil
+	case "mermaid":
+		return MermaidRenderer, nil
+	case "json":
+		return JSONRenderer, nil
+	}
+
+	return nil, errors.New("Unsupported format: " + format)
+}
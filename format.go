@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lmika/goseq/seqdiagram/parse"
+)
+
+// Runs the 'fmt' command, which rewrites diagram source in a canonical format.  Like gofmt,
+// the formatted source is written to stdout unless -w or -l is given.
+func runFormat(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	flagWrite := fs.Bool("w", false, "Write the result to the source file instead of stdout")
+	flagList := fs.Bool("l", false, "List files whose formatting differs from goseq fmt's")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: goseq fmt [-w] [-l] [file ...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if *flagWrite {
+			die("fmt: cannot use -w with stdin")
+		}
+		if err := formatFile("-", *flagWrite, *flagList); err != nil {
+			die("stdin - " + err.Error())
+		}
+		return
+	}
+
+	for _, inFile := range fs.Args() {
+		if err := formatFile(inFile, *flagWrite, *flagList); err != nil {
+			die(inFile + " - " + err.Error())
+		}
+	}
+}
+
+// Formats a single file
+func formatFile(inFilename string, write, list bool) error {
+	srcFile, err := openSourceFile(inFilename)
+	if err != nil {
+		return err
+	}
+	src, err := io.ReadAll(srcFile)
+	srcFile.Close()
+	if err != nil {
+		return err
+	}
+
+	formatted, err := formatSource(src, inFilename)
+	if err != nil {
+		return err
+	}
+
+	if list {
+		if !bytes.Equal(src, formatted) {
+			if inFilename == "-" {
+				fmt.Println("<standard input>")
+			} else {
+				fmt.Println(inFilename)
+			}
+		}
+	}
+	if write {
+		if bytes.Equal(src, formatted) {
+			return nil
+		}
+
+		info, err := os.Stat(inFilename)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(inFilename, formatted, info.Mode().Perm())
+	}
+	if !list {
+		_, err = os.Stdout.Write(formatted)
+	}
+	return err
+}
+
+// Returns the diagram source in the canonical format
+func formatSource(src []byte, filename string) ([]byte, error) {
+	nodeList, err := parse.ParseWithComments(bytes.NewReader(src), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := parse.Format(buf, nodeList); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -11,11 +12,16 @@ import (
 
 	"github.com/howeyc/fsnotify"
 	"github.com/lmika/goseq/seqdiagram"
+	"github.com/lmika/goseq/seqdiagram/mermaid"
+	"github.com/lmika/goseq/seqdiagram/plantuml"
 )
 
 // Name of the output file
 var flagOut = flag.String("o", "", "Output file")
 
+// The output format.  If set, this overrides the format chosen from the output file
+var flagFormat = flag.String("T", "", "Output format: svg, png, pdf, text, ascii, plantuml, mermaid or json")
+
 // The style to use
 var flagStyle = flag.String("s", "default", "The style to use")
 
@@ -78,6 +84,67 @@ func processSeqDiagram(infile io.Reader, inFilename, outFilename string, rendere
 		return err
 	}
 
+	return renderDiagram(diagram, outFilename, renderer)
+}
+
+// Processes a PlantUML file.  Anything which cannot be converted is reported as a warning.
+func processPlantUMLFile(inFilename, outFilename string, renderer Renderer) error {
+	srcFile, err := openSourceFile(inFilename)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	diagram, warnings, err := plantuml.Parse(srcFile)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "goseq: warning: %s:%d: %s\n", inFilename, warning.Line, warning.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	return renderDiagram(diagram, outFilename, renderer)
+}
+
+// Processes a Mermaid file.  Anything which cannot be converted is reported as a warning.
+func processMermaidFile(inFilename, outFilename string, renderer Renderer) error {
+	srcFile, err := openSourceFile(inFilename)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	diagram, warnings, err := mermaid.Parse(srcFile)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "goseq: warning: %s:%d: %s\n", inFilename, warning.Line, warning.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	return renderDiagram(diagram, outFilename, renderer)
+}
+
+// Processes a JSON file containing a diagram model
+func processJSONFile(inFilename, outFilename string, renderer Renderer) error {
+	srcFile, err := openSourceFile(inFilename)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	diagram := seqdiagram.NewDiagram()
+	if err := json.NewDecoder(srcFile).Decode(diagram); err != nil {
+		return err
+	}
+
+	return renderDiagram(diagram, outFilename, renderer)
+}
+
+// Renders a parsed diagram
+func renderDiagram(diagram *seqdiagram.Diagram, outFilename string, renderer Renderer) error {
+	var err error
+
 	// Image options
 	imageOptions := buildImageOptions()
 
@@ -106,10 +173,16 @@ func processSeqDiagram(infile io.Reader, inFilename, outFilename string, rendere
 
 // Processes a file.  This switches based on the file extension
 func processFile(inFilename, outFilename string, renderer Renderer) error {
-	ext := filepath.Ext(inFilename)
-	if ext == ".md" {
+	switch filepath.Ext(inFilename) {
+	case ".md":
 		return processMdFile(inFilename, outFilename, renderer)
-	} else {
+	case ".puml", ".plantuml":
+		return processPlantUMLFile(inFilename, outFilename, renderer)
+	case ".mmd":
+		return processMermaidFile(inFilename, outFilename, renderer)
+	case ".json":
+		return processJSONFile(inFilename, outFilename, renderer)
+	default:
 		return processSeqFile(inFilename, outFilename, renderer)
 	}
 }
@@ -148,6 +221,11 @@ func main() {
 	renderer := SvgRenderer
 	outFile := ""
 
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		runFormat(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
 	// Select a suitable renderer (based on the suffix of the output file, if there is one)
@@ -158,6 +236,12 @@ func main() {
 		}
 		outFile = *flagOut
 	}
+	if *flagFormat != "" {
+		renderer, err = chooseRendererByFormat(*flagFormat)
+		if err != nil {
+			die(err.Error())
+		}
+	}
 
 	// Process each file (or stdin)
 	if flag.NArg() == 0 {
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/lmika/goseq/seqdiagram"
+	"github.com/lmika/goseq/seqdiagram/mermaid"
+	"github.com/lmika/goseq/seqdiagram/plantuml"
 )
 
 // Renders the result of the SVG to a destination (e.g. a file)
@@ -26,3 +31,111 @@ func SvgRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, tar
 
 	return diagram.WriteSVGWithOptions(file, opts)
 }
+
+// PdfRenderer writes the diagram as a PDF document.
+func PdfRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
+	if target == "" {
+		return diagram.WritePDFWithOptions(os.Stdout, opts)
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return diagram.WritePDFWithOptions(file, opts)
+}
+
+// TextRenderer writes the diagram as text art using Unicode box drawing characters.
+func TextRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
+	if target == "" {
+		return diagram.WriteText(os.Stdout)
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return diagram.WriteText(file)
+}
+
+// AsciiRenderer writes the diagram as text art using only ASCII characters.
+func AsciiRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
+	if target == "" {
+		return diagram.WriteASCII(os.Stdout)
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return diagram.WriteASCII(file)
+}
+
+// PlantUMLRenderer writes the diagram as PlantUML source.  Parts of the diagram which
+// cannot be represented in PlantUML are reported as warnings.
+func PlantUMLRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
+	w := io.Writer(os.Stdout)
+	if target != "" {
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	warnings, err := plantuml.Write(w, diagram)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "goseq: warning: %s\n", warning)
+	}
+	return err
+}
+
+// MermaidRenderer writes the diagram as a Mermaid sequence diagram.  Parts of the diagram
+// which cannot be represented in Mermaid are reported as warnings.
+func MermaidRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
+	w := io.Writer(os.Stdout)
+	if target != "" {
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	warnings, err := mermaid.Write(w, diagram)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "goseq: warning: %s\n", warning)
+	}
+	return err
+}
+
+// JSONRenderer writes the diagram model as JSON.
+func JSONRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
+	w := io.Writer(os.Stdout)
+	if target != "" {
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diagram)
+}
@@ -1,4 +1,4 @@
-// Renderers disabled if noim is specified
+// Native renderers used when ImageMagick support is not compiled in
 //
 
 //go:build !im
@@ -7,11 +7,23 @@
 package main
 
 import (
-	"errors"
+	"os"
 
 	"github.com/lmika/goseq/seqdiagram"
 )
 
+// PngRenderer writes the diagram as a PNG image using the built-in rasterizer.
 func PngRenderer(diagram *seqdiagram.Diagram, opts *seqdiagram.ImageOptions, target string) error {
-	return errors.New("PNG renderer not available")
+	if target == "" {
+		return diagram.WritePNGWithOptions(os.Stdout, opts)
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return diagram.WritePNGWithOptions(file, opts)
 }
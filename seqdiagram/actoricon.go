@@ -8,6 +8,9 @@ import (
 
 // An actor icon
 type ActorIcon interface {
+	// Name returns the name of the icon, as used in the "icon" attribute
+	Name() string
+
 	// Get the appropriate graphbox icon
 	graphboxIcon() graphbox.Icon
 }
@@ -28,26 +31,31 @@ func LookupActorIcon(name string) (ActorIcon, error) {
 
 // A build-in actor icon
 type builtinActorIcon struct {
+	name string
 	icon graphbox.Icon
 }
 
+func (bai *builtinActorIcon) Name() string {
+	return bai.name
+}
+
 func (bai *builtinActorIcon) graphboxIcon() graphbox.Icon {
 	return bai.icon
 }
 
 // The set of built-in icons
 var builtinIcons = map[string]ActorIcon{
-	"human": &builtinActorIcon{graphbox.StickPersonIcon(1)},
-	"cylinder": &builtinActorIcon{graphbox.CylinderIcon{
+	"human": &builtinActorIcon{"human", graphbox.StickPersonIcon(1)},
+	"cylinder": &builtinActorIcon{"cylinder", graphbox.CylinderIcon{
 		EllipseSmallRadius: 5,
 		EllipseLargeRadius: 18,
 		Length:             28,
 	}},
-	"horiz-cylinder": &builtinActorIcon{graphbox.CylinderIcon{
+	"horiz-cylinder": &builtinActorIcon{"horiz-cylinder", graphbox.CylinderIcon{
 		EllipseSmallRadius: 5,
 		EllipseLargeRadius: 12,
 		Length:             40,
 		Horizontal:         true,
 	}},
-	"cloud": &builtinActorIcon{graphbox.PathIcon{Data: graphbox.CloudPathData}},
+	"cloud": &builtinActorIcon{"cloud", graphbox.PathIcon{Data: graphbox.CloudPathData}},
 }
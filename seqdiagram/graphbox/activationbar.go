@@ -0,0 +1,50 @@
+package graphbox
+
+// ActivationBarStyle defines the style to use for activation bars
+type ActivationBarStyle struct {
+	// The width of the bar
+	Width int
+
+	// The minimum height of the bar
+	MinHeight int
+
+	// The horizontal offset of a nested bar from the bar it is stacked on
+	NestOffset int
+
+	// The gap between the sides of the bar and the ends of activity lines
+	ArrowGap int
+
+	// The colour of the bar outline
+	Color string
+}
+
+// ActivationBar is a bar drawn over a lifeline while an actor is active.  The bar is
+// drawn from the point it is placed at down to the row TR.
+type ActivationBar struct {
+	TR          int
+	Depth       int
+	StartOffset int
+	style       ActivationBarStyle
+}
+
+// NewActivationBar constructs a new ActivationBar.  The depth is the number of bars the
+// bar is stacked on, and the start offset moves the top of the bar down from the row it
+// is placed at.
+func NewActivationBar(toRow, depth, startOffset int, style ActivationBarStyle) *ActivationBar {
+	return &ActivationBar{toRow, depth, startOffset, style}
+}
+
+// Constraint returns the constraints of the graphics object
+func (ab *ActivationBar) Constraint(r, c int, applier ConstraintApplier) {
+}
+
+// Draw draws the graphics object
+func (ab *ActivationBar) Draw(ctx DrawContext, point Point) {
+	if toPoint, isPoint := ctx.PointAt(ab.TR, ctx.C); isPoint {
+		x := point.X + ab.Depth*ab.style.NestOffset - ab.style.Width/2
+		top := point.Y + ab.StartOffset
+		bottom := maxInt(toPoint.Y, top+ab.style.MinHeight)
+
+		ctx.Canvas.Rect(x, top, ab.style.Width, bottom-top, "stroke:"+ab.style.Color+";stroke-width:2px;fill:white;")
+	}
+}
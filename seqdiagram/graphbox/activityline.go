@@ -1,5 +1,10 @@
 package graphbox
 
+import (
+	"fmt"
+	"math"
+)
+
 // ActivityArrowStem is the type of arrow stem to use for activity arrows
 type ActivityArrowStem int
 
@@ -14,6 +19,20 @@ const (
 	ThickArrowStem = iota
 )
 
+// ActivityEndpoint is the end of an activity line which is not attached to a lifeline
+type ActivityEndpoint int
+
+const (
+	// NoEndpoint is used for activity lines between two lifelines
+	NoEndpoint ActivityEndpoint = iota
+
+	// LostEndpoint ends the activity line at a circle to the right of the lifeline
+	LostEndpoint
+
+	// FoundEndpoint starts the activity line at a circle to the left of the lifeline
+	FoundEndpoint
+)
+
 // ActivityLineStyle defines the style to use for an activity line
 type ActivityLineStyle struct {
 	Font          Font
@@ -24,14 +43,67 @@ type ActivityLineStyle struct {
 	SelfRefHeight int
 	ArrowHead     *ArrowHeadStyle
 	ArrowStem     ActivityArrowStem
+	NumberBadge   NumberBadgeStyle
+
+	// The arrow head drawn at the start of the line.  If nil, the line has no head at
+	// its start.
+	TailArrowHead *ArrowHeadStyle
+
+	// The colour of the line and arrow head, and the colour of the message.  If empty,
+	// these are drawn in black.
+	Color     string
+	TextColor string
+
+	// The width of the line.  If zero, the width of the arrow stem is used.  Thick arrow
+	// stems are twice this width.
+	Width int
+
+	// The minimum length of lost and found lines, and the radius of the circle at the
+	// end of them
+	EndpointLength int
+	EndpointRadius int
+}
+
+// NumberBadgeStyle defines the style of the badge showing the number of an activity line
+type NumberBadgeStyle struct {
+	Font     Font
+	FontSize int
+	Padding  Point
+
+	// The gap between the badge and the message
+	Gap int
+
+	// The fill colour of the badge and the colour of the number.  If the colour is empty,
+	// the badge is not filled.
+	Color     string
+	TextColor string
+
+	// Text placed either side of the number.  This is for canvases which cannot fill
+	// shapes, such as text art.
+	Brackets [2]string
 }
 
 // ActivityLine is an activity line graphical object
 type ActivityLine struct {
-	TC          int
+	TC int
+
+	// The row the line ends on.  If this is below the row the line is placed on, the line
+	// slopes down to it.
+	TR int
+
+	// Horizontal offsets of the start and end of the line from the lifelines.  These
+	// are used to end the line at the side of an activation bar.
+	StartOffset int
+	EndOffset   int
+
+	endpoint    ActivityEndpoint
 	style       ActivityLineStyle
 	textBox     *TextBox
 	textBoxRect Rect
+	hasText     bool
+
+	badgeBox  *TextBox
+	badgeRect Rect
 }
 
 // NewActivityLine constructs a new ActivityLine
@@ -42,124 +114,288 @@ func NewActivityLine(toCol int, selfRef bool, text string, style ActivityLineSty
 	}
 
 	textBox := NewTextBox(style.Font, style.FontSize, textBoxAlign)
+	textBox.Color = style.TextColor
 	textBox.AddText(text)
 
 	brect := textBox.BoundingRect()
-	return &ActivityLine{toCol, style, textBox, brect}
+	return &ActivityLine{TC: toCol, style: style, textBox: textBox, textBoxRect: brect, hasText: text != ""}
+}
+
+// NewEndpointActivityLine constructs a new ActivityLine for a lost or found message.  The
+// line is placed at the lifeline of the actor sending or receiving the message.
+func NewEndpointActivityLine(endpoint ActivityEndpoint, text string, style ActivityLineStyle) *ActivityLine {
+	al := NewActivityLine(-1, false, text, style)
+	al.endpoint = endpoint
+	return al
+}
+
+// SetNumber sets the number of the activity line.  The number is drawn in a badge to the
+// left of the message.
+func (al *ActivityLine) SetNumber(number string) {
+	style := al.style.NumberBadge
+
+	al.badgeBox = NewTextBox(style.Font, style.FontSize, MiddleTextAlign)
+	al.badgeBox.Color = style.TextColor
+	al.badgeBox.AddText(style.Brackets[0] + number + style.Brackets[1])
+	al.badgeRect = al.badgeBox.BoundingRect().BlowOut(style.Padding)
+}
+
+// Returns the rectangle containing the message and the number badge
+func (al *ActivityLine) labelRect() Rect {
+	if al.badgeBox == nil {
+		return al.textBoxRect
+	}
+
+	// The width of the message cannot be used to tell whether there is one, as a single
+	// character has no width in the cell font
+	w := al.badgeRect.W
+	if al.hasText {
+		w += al.style.NumberBadge.Gap + al.textBoxRect.W
+	}
+	return Rect{0, 0, w, maxInt(al.badgeRect.H, al.textBoxRect.H)}
 }
 
 // Constraint returns the constraints of the graphics object
 func (al *ActivityLine) Constraint(r, c int, applier ConstraintApplier) {
-	h := al.textBoxRect.H + al.style.Margin.Y + al.style.TextGap
-	w := al.textBoxRect.W
+	labelRect := al.labelRect()
+	h := labelRect.H + al.style.Margin.Y + al.style.TextGap
+	w := labelRect.W
 
 	lc, rc := c, al.TC
 	if al.TC < c {
 		lc, rc = al.TC, c
 	}
 
-	if al.TC == c {
+	if al.endpoint != NoEndpoint {
+		w = al.endpointLength() + al.style.EndpointRadius + al.style.Margin.X + absInt(al.StartOffset) + absInt(al.EndOffset)
+		if al.endpoint == LostEndpoint {
+			lc, rc = c, c+1
+		} else {
+			lc, rc = c-1, c
+		}
+
+		applier.Apply(AddSizeConstraint{r, c, 0, 0, h, al.style.Margin.Y})
+		applier.Apply(TotalSizeConstraint{r - 1, lc, r, rc, w, 0})
+	} else if al.TR > r {
+		// A sloped arrow.  The message is placed above the start of the line.
+		w += al.style.TextGap + al.style.Margin.X*2 + absInt(al.StartOffset) + absInt(al.EndOffset)
+
+		applier.Apply(AddSizeConstraint{r, c, 0, 0, h, al.style.Margin.Y})
+		applier.Apply(TotalSizeConstraint{r - 1, lc, r, rc, w, 0})
+	} else if al.TC == c {
 		// An arrow referring to itself
-		w = maxInt(w, al.style.SelfRefWidth) + al.style.TextGap*3
+		w = maxInt(w, al.style.SelfRefWidth) + al.style.TextGap*3 + maxInt(maxInt(al.StartOffset, al.EndOffset), 0)
 		h += al.style.TextGap / 2
 
 		applier.Apply(AddSizeConstraint{r, c, 0, 0, h, al.style.Margin.Y + al.style.SelfRefHeight})
 		applier.Apply(TotalSizeConstraint{r - 1, lc, r, lc + 1, w, 0})
 	} else {
 		applier.Apply(AddSizeConstraint{r, c, 0, 0, h, al.style.Margin.Y})
-		applier.Apply(TotalSizeConstraint{r - 1, lc, r, rc, w + al.style.Margin.X*2, 0})
+		applier.Apply(TotalSizeConstraint{r - 1, lc, r, rc, w + al.style.Margin.X*2 + absInt(al.StartOffset) + absInt(al.EndOffset), 0})
 	}
 }
 
+// Returns the length of a lost or found line from the lifeline to the centre of the
+// circle.  This is long enough to fit the message.
+func (al *ActivityLine) endpointLength() int {
+	return maxInt(al.style.EndpointLength, al.labelRect().W+al.style.Margin.X*2+al.style.EndpointRadius)
+}
+
 // Draw draws the graphics object
 func (al *ActivityLine) Draw(ctx DrawContext, point Point) {
-	fx, fy := point.X, point.Y
+	fx, fy := point.X+al.StartOffset, point.Y
 
-	if ctx.C == al.TC {
+	if al.endpoint != NoEndpoint {
+		al.drawEndpointLine(ctx, point)
+	} else if al.TR > ctx.R {
+		al.drawSlopedLine(ctx, fx, fy)
+	} else if ctx.C == al.TC {
 		// A self reference arrow
 		if point, isPoint := ctx.PointAt(ctx.R, ctx.C+1); isPoint {
 			// Draw an arrow referencing itself
 			ty := point.Y
-			stemX, stemY := fx+al.style.SelfRefWidth, ty+al.style.SelfRefHeight
+			ex := fx - al.StartOffset + al.EndOffset
+			outerX := maxInt(fx, ex)
+			stemX, stemY := outerX+al.style.SelfRefWidth, ty+al.style.SelfRefHeight
 
-			textX := fx + al.style.TextGap*2
+			textX := outerX + al.style.TextGap*2
 			textY := ty - al.style.TextGap - al.style.TextGap/2
-			al.renderMessage(ctx, textX, textY, true)
+			al.renderMessage(ctx, textX, textY, SouthWestGravity)
 
 			al.drawArrowStemPath(ctx,
-				[]int{fx, stemX, stemX, fx},
+				[]int{fx, stemX, stemX, ex},
 				[]int{fy, fy, stemY, stemY})
-			al.drawArrow(ctx, fx, stemY, false)
+			al.drawArrow(ctx, ex, stemY, false, 0)
+			al.drawTailArrow(ctx, fx, fy, false, 0)
 		}
 	} else {
 		if point, isPoint := ctx.PointAt(ctx.R, al.TC); isPoint {
-			tx, ty := point.X, point.Y
+			tx, ty := point.X+al.EndOffset, point.Y
 
 			textX := fx + (tx-fx)/2
 			textY := ty - al.style.TextGap
-			al.renderMessage(ctx, textX, textY, false)
+			al.renderMessage(ctx, textX, textY, SouthGravity)
 			al.drawArrowStem(ctx, fx, fy, tx, ty)
-			al.drawArrow(ctx, tx, ty, al.TC > ctx.C)
+			al.drawArrow(ctx, tx, ty, al.TC > ctx.C, 0)
+			al.drawTailArrow(ctx, fx, fy, al.TC < ctx.C, 0)
 		}
 	}
 }
 
-// Draws the arrow stem
-func (al *ActivityLine) drawArrowStem(ctx DrawContext, fx, fy, tx, ty int) {
+// Draws a sloped line from the given point down to the end row.  The message is placed
+// above the start of the line, on the side the line slopes towards, so that it does not
+// run into the messages of the rows the line crosses.
+func (al *ActivityLine) drawSlopedLine(ctx DrawContext, fx, fy int) {
+	point, isPoint := ctx.PointAt(al.TR, al.TC)
+	if !isPoint {
+		return
+	}
+
+	tx, ty := point.X+al.EndOffset, point.Y
+	isRight := al.TC > ctx.C
+
+	if isRight {
+		al.renderMessage(ctx, fx+al.style.TextGap, fy-al.style.TextGap, SouthWestGravity)
+	} else {
+		al.renderMessage(ctx, fx-al.style.TextGap, fy-al.style.TextGap, SouthEastGravity)
+	}
+	al.drawArrowStem(ctx, fx, fy, tx, ty)
+	angle := math.Atan2(float64(ty-fy), float64(absInt(tx-fx)))
+	al.drawArrow(ctx, tx, ty, isRight, angle)
+	al.drawTailArrow(ctx, fx, fy, !isRight, -angle)
+}
+
+// Draws a lost or found line.  Lost lines run from the lifeline to the circle, and found
+// lines from the circle to the lifeline.
+func (al *ActivityLine) drawEndpointLine(ctx DrawContext, point Point) {
+	length, radius := al.endpointLength(), al.style.EndpointRadius
+
+	var fx, tx, cx int
+	if al.endpoint == LostEndpoint {
+		cx = point.X + length
+		fx, tx = point.X+al.StartOffset, cx-radius
+	} else {
+		cx = point.X - length
+		fx, tx = cx+radius, point.X+al.EndOffset
+	}
+
+	al.renderMessage(ctx, fx+(tx-fx)/2, point.Y-al.style.TextGap, SouthGravity)
+	al.drawArrowStem(ctx, fx, point.Y, tx, point.Y)
+	al.drawArrow(ctx, tx, point.Y, true, 0)
+	al.drawTailArrow(ctx, fx, point.Y, false, 0)
+	color := al.color()
+	ctx.Canvas.Circle(cx, point.Y, radius, "stroke:"+color+";stroke-width:1px;fill:"+color+";")
+}
+
+// Returns the colour of the line
+func (al *ActivityLine) color() string {
+	if al.style.Color == "" {
+		return "black"
+	}
+	return al.style.Color
+}
+
+// Returns the style of the arrow stem
+func (al *ActivityLine) stemStyle() string {
+	width := al.style.Width
+	if width == 0 {
+		width = 2
+	}
+
+	style := "stroke:" + al.color() + ";"
 	switch al.style.ArrowStem {
-	case SolidArrowStem:
-		ctx.Canvas.Line(fx, fy, tx, ty, "stroke:black;stroke-width:2px;")
 	case DashedArrowStem:
-		ctx.Canvas.Line(fx, fy, tx, ty, "stroke:black;stroke-dasharray:4,2;stroke-width:2px;")
+		style += "stroke-dasharray:4,2;"
 	case ThickArrowStem:
-		ctx.Canvas.Line(fx, fy, tx, ty, "stroke:black;stroke-width:4px;")
+		width *= 2
 	}
+	return style + fmt.Sprintf("stroke-width:%dpx;", width)
+}
+
+// Draws the arrow stem
+func (al *ActivityLine) drawArrowStem(ctx DrawContext, fx, fy, tx, ty int) {
+	ctx.Canvas.Line(fx, fy, tx, ty, al.stemStyle())
 }
 
 // Draws the arrow stem path
 func (al *ActivityLine) drawArrowStemPath(ctx DrawContext, xs, ys []int) {
-	switch al.style.ArrowStem {
-	case SolidArrowStem:
-		ctx.Canvas.Polyline(xs, ys, "fill:none;stroke:black;stroke-width:2px;")
-	case DashedArrowStem:
-		ctx.Canvas.Polyline(xs, ys, "fill:none;stroke:black;stroke-dasharray:4,2;stroke-width:2px;")
-	case ThickArrowStem:
-		ctx.Canvas.Polyline(xs, ys, "fill:none;stroke:black;stroke-width:4px;")
-	}
+	ctx.Canvas.Polyline(xs, ys, "fill:none;"+al.stemStyle())
 }
 
-func (al *ActivityLine) renderMessage(ctx DrawContext, tx, ty int, anchorLeft bool) {
-	anchor := SouthGravity
-	if anchorLeft {
-		anchor = SouthWestGravity
+func (al *ActivityLine) renderMessage(ctx DrawContext, tx, ty int, anchor Gravity) {
+	rect := al.labelRect().PositionAt(tx, ty, anchor)
+	ctx.Canvas.Rect(rect.X, rect.Y, rect.W, rect.H, "fill:white;stroke:white;")
+
+	if al.badgeBox == nil {
+		al.textBox.Render(ctx.Canvas, tx, ty, anchor)
+		return
 	}
 
-	rect := al.textBoxRect.PositionAt(tx, ty, anchor)
+	// The badge is drawn at the left of the label, with the message to the right of it
+	midY := rect.Y + rect.H/2
+	badgeRect := al.badgeRect.PositionAt(rect.X, midY, WestGravity)
+	if color := al.style.NumberBadge.Color; color != "" {
+		ctx.Canvas.Rect(badgeRect.X, badgeRect.Y, badgeRect.W, badgeRect.H, "fill:"+color+";stroke:"+color+";")
+	}
+	al.badgeBox.Render(ctx.Canvas, badgeRect.X+badgeRect.W/2, midY, CenterGravity)
 
-	ctx.Canvas.Rect(rect.X, rect.Y, rect.W, rect.H, "fill:white;stroke:white;")
-	al.textBox.Render(ctx.Canvas, tx, ty, anchor)
+	if al.hasText {
+		al.textBox.Render(ctx.Canvas, rect.X+rect.W, midY, EastGravity)
+	}
 }
 
-// Draws the arrow head.
-func (al *ActivityLine) drawArrow(ctx DrawContext, x, y int, isRight bool) {
-	headStyle := al.style.ArrowHead
+// Draws the arrow head.  The angle is the slope of the line down from the horizontal, in
+// radians.
+func (al *ActivityLine) drawArrow(ctx DrawContext, x, y int, isRight bool, angle float64) {
+	al.drawArrowHead(ctx, al.style.ArrowHead, x, y, isRight, angle)
+}
+
+// Draws the arrow head at the start of the line, if it has one
+func (al *ActivityLine) drawTailArrow(ctx DrawContext, x, y int, isRight bool, angle float64) {
+	if al.style.TailArrowHead != nil {
+		al.drawArrowHead(ctx, al.style.TailArrowHead, x, y, isRight, angle)
+	}
+}
+
+func (al *ActivityLine) drawArrowHead(ctx DrawContext, headStyle *ArrowHeadStyle, x, y int, isRight bool, angle float64) {
+	if headStyle.Glyphs != [2]string{} {
+		glyph := headStyle.Glyphs[0]
+		if isRight {
+			glyph = headStyle.Glyphs[1]
+		}
+
+		glyphBox := NewTextBox(al.style.Font, al.style.FontSize, MiddleTextAlign)
+		glyphBox.Color = al.style.Color
+		glyphBox.AddText(glyph)
+		glyphBox.Render(ctx.Canvas, x, y, CenterGravity)
+		return
+	}
 
 	xs, ys := make([]int, len(headStyle.Xs)), make([]int, len(headStyle.Ys))
 	if len(xs) != len(ys) {
 		panic("length of xs and ys must be the same")
 	}
 
+	sin, cos := math.Sincos(angle)
 	for i := range headStyle.Xs {
-		ox, oy := headStyle.Xs[i], headStyle.Ys[i]
+		ox, oy := float64(headStyle.Xs[i]), float64(headStyle.Ys[i])
+		rx, ry := int(math.Round(ox*cos-oy*sin)), int(math.Round(ox*sin+oy*cos))
 		if isRight {
-			xs[i] = x + ox
+			xs[i] = x + rx
 		} else {
-			xs[i] = x - ox
+			xs[i] = x - rx
 		}
-		ys[i] = y + oy
+		ys[i] = y + ry
 	}
 
-	ctx.Canvas.Polyline(xs, ys, StyleFromString(headStyle.BaseStyle).ToStyle())
+	baseStyle := StyleFromString(headStyle.BaseStyle)
+	if al.style.Color != "" {
+		baseStyle.Set("stroke", al.style.Color)
+		if fill := baseStyle["fill"]; fill != "" && fill != "none" {
+			baseStyle.Set("fill", al.style.Color)
+		}
+	}
+	ctx.Canvas.Polyline(xs, ys, baseStyle.ToStyle())
 }
 
 // ArrowHeadStyle defines style information for the arrow heads
@@ -170,4 +406,10 @@ type ArrowHeadStyle struct {
 
 	// Base style for the arrow head
 	BaseStyle string
+
+	// If set, the arrow head is drawn as text centred on the tip instead of as
+	// a polyline.  This is for canvases which cannot draw arbitrary shapes, such as
+	// text art.  The first glyph is used for arrows pointing left and the second
+	// for arrows pointing right.
+	Glyphs [2]string
 }
@@ -24,6 +24,9 @@ type ActorBoxStyle struct {
 	Margin    Point
 	Color     string
 	TextColor string
+
+	// The gap between the sides of the box and the ends of activity lines pointing to it
+	ArrowGap int
 }
 
 // ActorBox represents an a actor
@@ -48,6 +51,12 @@ func NewActorBox(text string, style ActorBoxStyle, pos ActorBoxPos) *ActorBox {
 	return &ActorBox{brect, style, textBox, pos}
 }
 
+// Size returns the width and height of the box.  The box is centred on the point it is
+// placed at.
+func (tr *ActorBox) Size() (width, height int) {
+	return tr.frameRect.W, tr.frameRect.H
+}
+
 func (tr *ActorBox) Constraint(r, c int, applier ConstraintApplier) {
 	var vertConstraint Constraint
 	posHoriz, posVert := tr.pos&0xFF00, tr.pos&0xFF
@@ -0,0 +1,98 @@
+package graphbox
+
+// ActorGroupStyle defines the style of the box drawn around a group of actors
+type ActorGroupStyle struct {
+	Font     Font
+	FontSize int
+
+	// The space between the box and the actors, and around the label
+	Padding Point
+}
+
+// ActorGroupBox is a labelled box drawn behind a group of adjacent actors.  The box is
+// placed at the header of the first actor and extends to the footer of the last actor.
+type ActorGroupBox struct {
+	TR int
+	TC int
+
+	// The distances from the grid points of the first and last actors to the sides of
+	// their actor boxes
+	Left, Right int
+	Top, Bottom int
+
+	// The fill colour of the box.  If empty, the box is not filled.
+	Color string
+
+	style       ActorGroupStyle
+	label       string
+	textBox     *TextBox
+	textBoxRect Rect
+}
+
+// NewActorGroupBox constructs a new ActorGroupBox
+func NewActorGroupBox(toRow, toCol int, label string, color string, style ActorGroupStyle) *ActorGroupBox {
+	textBox := NewTextBox(style.Font, style.FontSize, MiddleTextAlign)
+	textBox.AddText(label)
+
+	return &ActorGroupBox{TR: toRow, TC: toCol, Color: color, style: style, label: label, textBox: textBox, textBoxRect: textBox.BoundingRect()}
+}
+
+// Constraint returns the constraints of the graphics object.  The padding is added between
+// the actors and the actors outside the group.  At the sides of the diagram, the padding
+// is included in the space needed by the actor boxes.
+func (gb *ActorGroupBox) Constraint(r, c int, applier ConstraintApplier) {
+	left, right := gb.sides(c)
+	pad := gb.style.Padding
+
+	if c == 1 {
+		applier.Apply(SizeConstraint{r, c, left + pad.X, 0, 0, 0})
+	} else {
+		applier.Apply(AddSizeConstraint{r, c, left - gb.Left + pad.X, 0, 0, 0})
+	}
+	if gb.TC+1 == applier.Cols()-1 {
+		applier.Apply(SizeConstraint{r, gb.TC, 0, right + pad.X, 0, 0})
+	} else {
+		applier.Apply(AddSizeConstraint{r, gb.TC, 0, right - gb.Right + pad.X, 0, 0})
+	}
+
+	if gb.TC > c {
+		applier.Apply(TotalSizeConstraint{r - 1, c, r, gb.TC, gb.textBoxRect.W + pad.X*2 - left - right, 0})
+	}
+
+	applier.Apply(SizeConstraint{r, c, 0, 0, gb.Top + gb.labelHeight(), 0})
+	applier.Apply(SizeConstraint{gb.TR, c, 0, 0, 0, gb.Bottom + pad.Y})
+}
+
+// Returns the distances from the grid points to the sides of the box, less the padding.
+// A box around a single actor is widened to fit the label.
+func (gb *ActorGroupBox) sides(c int) (left, right int) {
+	left, right = gb.Left, gb.Right
+	if c == gb.TC {
+		if extra := gb.textBoxRect.W - left - right; extra > 0 {
+			left, right = left+extra/2, right+extra-extra/2
+		}
+	}
+	return left, right
+}
+
+// Returns the height of the label, including the padding above and below it
+func (gb *ActorGroupBox) labelHeight() int {
+	if gb.label == "" {
+		return gb.style.Padding.Y
+	}
+	return gb.textBoxRect.H + gb.style.Padding.Y*2
+}
+
+// Draw draws the graphics object
+func (gb *ActorGroupBox) Draw(ctx DrawContext, point Point) {
+	if to, isPoint := ctx.PointAt(gb.TR, gb.TC); isPoint {
+		left, right := gb.sides(ctx.C)
+		pad := gb.style.Padding
+
+		fx, fy := point.X-left-pad.X, point.Y-gb.Top-gb.labelHeight()
+		tx, ty := to.X+right+pad.X, to.Y+gb.Bottom+pad.Y
+
+		ctx.Canvas.Rect(fx, fy, tx-fx, ty-fy, "stroke:gray;stroke-width:1px;fill:"+gb.Color+";")
+		gb.textBox.Render(ctx.Canvas, fx+(tx-fx)/2, fy+pad.Y, NorthGravity)
+	}
+}
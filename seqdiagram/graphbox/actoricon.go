@@ -28,6 +28,12 @@ func NewActorIconBox(text string, icon Icon, style ActorIconBoxStyle, pos ActorB
 	return &ActorIconBox{textBox, icon, style, pos}
 }
 
+// Size returns the width and height of the icon.  The icon is centred on the point it is
+// placed at, with the text below it.
+func (tr *ActorIconBox) Size() (width, height int) {
+	return tr.Icon.Size()
+}
+
 func (tr *ActorIconBox) Constraint(r, c int, applier ConstraintApplier) {
 	posHoriz, posVert := tr.pos&0xFF00, tr.pos&0xFF
 	iconW, iconH := tr.Icon.Size()
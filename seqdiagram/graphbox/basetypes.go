@@ -7,8 +7,6 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-
-	svg "github.com/ajstarks/svgo"
 )
 
 type GraphboxItem interface {
@@ -58,7 +56,7 @@ type ConstraintChanger interface {
 
 // A drawing context
 type DrawContext struct {
-	Canvas  *svg.SVG
+	Canvas  Canvas
 	Graphic *Graphic
 	R, C    int
 }
@@ -79,6 +77,7 @@ var (
 	CenterGravity    Gravity = func(w, h int) (int, int) { return w / 2, h / 2 }
 	SouthGravity     Gravity = func(w, h int) (int, int) { return w / 2, h }
 	SouthWestGravity Gravity = func(w, h int) (int, int) { return 0, h }
+	SouthEastGravity Gravity = func(w, h int) (int, int) { return w, h }
 )
 
 // A specific gravity
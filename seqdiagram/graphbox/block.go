@@ -1,5 +1,10 @@
 package graphbox
 
+import (
+	"strconv"
+	"strings"
+)
+
 // A block stype
 type BlockStyle struct {
 	Margin Point
@@ -13,6 +18,21 @@ type BlockStyle struct {
 	PrefixExtraWidth int
 	GapWidth         int
 	MidMargin        int
+
+	// The fill colour of the block, the colour of the frame and the fill colour of the
+	// prefix.  If empty, the block is not filled and the frame is drawn in black, with
+	// the prefix filled with white.
+	Color       string
+	BorderColor string
+	TabColor    string
+
+	// The dash pattern of the frame.  If empty, the frame is drawn as a solid line.
+	Dashes []int
+
+	// The fill colour of blocks nested within another block which are not given a colour.
+	// Blocks nested within these are filled with white, so that the fills alternate.  If
+	// empty, nested blocks are not filled.
+	NestedColor string
 }
 
 // A block
@@ -74,6 +94,12 @@ func (block *Block) Draw(ctx DrawContext, point Point) {
 	}
 }
 
+// Returns an item which fills the area of the block with its fill colour.  This is to be
+// placed underneath the lifelines and the other items, so that they are drawn over the fill.
+func (block *Block) Background() GraphboxItem {
+	return &blockBackground{block}
+}
+
 // Calculate the horizontal margin based on the configured style margin and depth
 func (block *Block) calcHorizMargin() int {
 	return block.Style.Margin.X * block.MarginMup
@@ -83,7 +109,15 @@ func (block *Block) drawFrame(ctx DrawContext, fx, fy, tx, ty int) {
 	xs := []int{fx, fx, tx, tx}
 	ys := []int{ty, fy, fy, ty}
 
-	lineStyle := "stroke:black;stroke-dasharray:4,4;stroke-width:2px;fill:none;"
+	lineStyle := "stroke:" + borderColor(block.Style) + ";"
+	if len(block.Style.Dashes) > 0 {
+		dashes := make([]string, len(block.Style.Dashes))
+		for i, d := range block.Style.Dashes {
+			dashes[i] = strconv.Itoa(d)
+		}
+		lineStyle += "stroke-dasharray:" + strings.Join(dashes, ",") + ";"
+	}
+	lineStyle += "stroke-width:2px;fill:none;"
 	if block.IsLast {
 		ctx.Canvas.Polygon(xs, ys, lineStyle)
 	} else {
@@ -92,25 +126,71 @@ func (block *Block) drawFrame(ctx DrawContext, fx, fy, tx, ty int) {
 }
 
 func (block *Block) drawText(ctx DrawContext, fx, fy int) {
-	ptr := block.prefixTextBoxRect.BlowOut(block.Style.TextPadding).AddSize(block.Style.PrefixExtraWidth, 0).PositionAt(fx, fy, NorthWestGravity)
+	ptr := prefixFrameRect(block.prefixTextBoxRect, block.Style).PositionAt(fx, fy, NorthWestGravity)
 	mtr := block.messageTextBoxRect.BlowOut(block.Style.MessagePadding).PositionAt(fx+ptr.W, fy, NorthWestGravity)
 
 	if block.ShowMessage {
-		ctx.Canvas.Rect(mtr.X, mtr.Y, mtr.W+block.Style.GapWidth+block.Style.FontSize/2, mtr.H, "stroke:none;fill:white;")
+		fill := block.Style.Color
+		if fill == "" {
+			fill = "white"
+		}
+		ctx.Canvas.Rect(mtr.X, mtr.Y, mtr.W+block.Style.GapWidth+block.Style.FontSize/2, mtr.H, "stroke:none;fill:"+fill+";")
 		block.messageTextBox.Render(ctx.Canvas, mtr.X+block.Style.GapWidth+block.Style.MessagePadding.X, mtr.Y+block.Style.MessagePadding.Y, NorthWestGravity)
 	}
 
 	if block.ShowPrefix {
-		block.drawPrefixFrame(ctx, ptr.X, ptr.Y, ptr.X+ptr.W, ptr.Y+ptr.H)
+		drawPrefixFrame(ctx, ptr.X, ptr.Y, ptr.X+ptr.W, ptr.Y+ptr.H, block.Style)
 		block.prefixTextBox.Render(ctx.Canvas, ptr.X+block.Style.TextPadding.X, ptr.Y+block.Style.TextPadding.Y, NorthWestGravity)
 	}
 }
 
-func (block *Block) drawPrefixFrame(ctx DrawContext, fx, fy, tx, ty int) {
-	fold := block.Style.FontSize / 2
+// Returns the size of the frame drawn around the prefix of a block
+func prefixFrameRect(prefixTextBoxRect Rect, style BlockStyle) Rect {
+	return prefixTextBoxRect.BlowOut(style.TextPadding).AddSize(style.PrefixExtraWidth, 0)
+}
+
+// Draws the frame around the prefix of a block, with the bottom right corner folded
+func drawPrefixFrame(ctx DrawContext, fx, fy, tx, ty int, style BlockStyle) {
+	fold := style.FontSize / 2
 
 	xs := []int{fx, fx, tx - fold, tx, tx}
 	ys := []int{fy, ty, ty, ty - fold, fy}
 
-	ctx.Canvas.Polygon(xs, ys, "stroke:black;stroke-width:2px;fill:white;")
+	fill := style.TabColor
+	if fill == "" {
+		fill = "white"
+	}
+	ctx.Canvas.Polygon(xs, ys, "stroke:"+borderColor(style)+";stroke-width:2px;fill:"+fill+";")
+}
+
+// Returns the colour of the frame of a block
+func borderColor(style BlockStyle) string {
+	if style.BorderColor == "" {
+		return "black"
+	}
+	return style.BorderColor
+}
+
+// Fills the area of a block
+type blockBackground struct {
+	block *Block
+}
+
+func (bb *blockBackground) Constraint(r, c int, applier ConstraintApplier) {
+}
+
+func (bb *blockBackground) Draw(ctx DrawContext, point Point) {
+	if bb.block.Style.Color == "" {
+		return
+	}
+
+	fx, fy := point.X, point.Y
+	if point, isPoint := ctx.PointAt(bb.block.TR, bb.block.TC); isPoint {
+		tx, ty := point.X, point.Y
+
+		fx -= bb.block.calcHorizMargin()
+		tx += bb.block.calcHorizMargin()
+
+		ctx.Canvas.Rect(fx, fy, tx-fx, ty-fy, "stroke:none;fill:"+bb.block.Style.Color+";")
+	}
 }
@@ -0,0 +1,56 @@
+package graphbox
+
+// Canvas is the drawing surface used by the graphbox items.  Implementations
+// exist for SVG, raster images and PDF documents, and library users can provide
+// their own to render the laid out graphic to other formats.
+//
+// Shapes are styled with CSS declarations, such as "stroke:black;stroke-width:2px;",
+// and paths are given as SVG path data, so the SVG canvas can write them out as they
+// are.  Other canvases understand the stroke, fill, stroke-width and stroke-dasharray
+// properties.
+type Canvas interface {
+	// Draws a straight line between two points
+	Line(x1, y1, x2, y2 int, style string)
+
+	// Draws a series of connected line segments
+	Polyline(xs, ys []int, style string)
+
+	// Draws a closed polygon
+	Polygon(xs, ys []int, style string)
+
+	// Draws a rectangle
+	Rect(x, y, w, h int, style string)
+
+	// Draws a circle
+	Circle(x, y, r int, style string)
+
+	// Draws a path from SVG path data.  The transform is an SVG transform list, such
+	// as "scale(2) translate(10 20)", or empty if the path is not transformed.
+	Path(d string, transform string, style string)
+
+	// Draws a run of text.  The point is the left end of the text baseline.
+	Text(x, y int, text string, style TextStyle)
+
+	// Starts a group of shapes.  Shapes drawn until the matching call to GroupEnd
+	// inherit the style of the group.
+	Group(style string)
+
+	// Ends the current group
+	GroupEnd()
+
+	// Starts a link to a URL.  The shapes drawn until the matching call to EndLink
+	// follow the link when clicked.  Canvases which do not support links ignore it.
+	StartLink(url string)
+
+	// Ends the current link
+	EndLink()
+}
+
+// TextStyle describes how a run of text is drawn
+type TextStyle struct {
+	Font     Font
+	FontSize int
+
+	// The text colour.  If empty, the text is drawn in black.
+	Color string
+}
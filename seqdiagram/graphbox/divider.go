@@ -18,6 +18,9 @@ const (
 	// DSFullLine is a line which will span the entire grapic.  The text will be
 	// centered in front of it.
 	DSFullLine
+
+	// DSNoteFrame is like FramedRect but drawn with the shape and colours of a note
+	DSNoteFrame
 )
 
 // DividerStyle defines the style of the divider
@@ -29,6 +32,15 @@ type DividerStyle struct {
 	TextPadding Point
 	Overlap     int
 	Shape       DividerShape
+
+	// The shape of the frame when the shape is DSNoteFrame
+	NoteShape NoteShape
+
+	// The fill colour of a note frame, the colour of the line or frame and the colour
+	// of the text.  If empty, the frame is filled with white and drawn in black.
+	Color       string
+	BorderColor string
+	TextColor   string
 }
 
 // Divider is a divider graphics object.  This spans the entire diagram.
@@ -48,9 +60,13 @@ type Divider struct {
 // NewDivider creates a new divider
 func NewDivider(toCol int, text string, style DividerStyle) *Divider {
 	textBox := NewTextBox(style.Font, style.FontSize, MiddleTextAlign)
+	textBox.Color = style.TextColor
 	textBox.AddText(text)
 	textBoxRect := textBox.BoundingRect()
 	marginRect := textBoxRect.BlowOut(style.Padding)
+	if style.Shape == DSNoteFrame {
+		marginRect = marginRect.BlowOut(noteShapeMargin(style.NoteShape, marginRect))
+	}
 
 	return &Divider{toCol, 0, 0, style, text != "", textBox, textBoxRect, marginRect}
 }
@@ -102,7 +118,10 @@ func (div *Divider) Draw(ctx DrawContext, point Point) {
 			ctx.Canvas.Rect(borderRect.X, borderRect.Y, borderRect.W, borderRect.H, "fill:white;stroke:white;")
 			div.textBox.Render(ctx.Canvas, centerX, centerY, CenterGravity)
 		case DSFramedRect:
-			ctx.Canvas.Rect(borderRect.X, borderRect.Y, borderRect.W, borderRect.H, "fill:white;stroke:black;stroke-width:2px")
+			ctx.Canvas.Rect(borderRect.X, borderRect.Y, borderRect.W, borderRect.H, "fill:white;stroke:"+div.borderColor()+";stroke-width:2px")
+			div.textBox.Render(ctx.Canvas, centerX, centerY, CenterGravity)
+		case DSNoteFrame:
+			drawNoteFrame(ctx.Canvas, borderRect, div.style.NoteShape, noteFrameStyle(div.style.Color, div.style.BorderColor))
 			div.textBox.Render(ctx.Canvas, centerX, centerY, CenterGravity)
 		case DSSpacerRect:
 			ctx.Canvas.Rect(textBoxRect.X, textBoxRect.Y, textBoxRect.W, textBoxRect.H, "fill:white;stroke:white;")
@@ -110,7 +129,7 @@ func (div *Divider) Draw(ctx DrawContext, point Point) {
 		case DSFullLine:
 			// Draw the rectangle for clearing the image
 			ctx.Canvas.Rect(borderRect.X, borderRect.Y, borderRect.W, borderRect.H, "fill:white;stroke:white;")
-			ctx.Canvas.Line(borderRect.X, centerY, borderRect.W, centerY, "fill:white;stroke:black;stroke-width:2px;") // stroke-dasharray:16,8")
+			ctx.Canvas.Line(borderRect.X, centerY, borderRect.W, centerY, "fill:white;stroke:"+div.borderColor()+";stroke-width:2px;") // stroke-dasharray:16,8")
 
 			if div.hasText {
 				ctx.Canvas.Rect(textBoxRect.X, textBoxRect.Y, textBoxRect.W, textBoxRect.H, "fill:white;stroke:white;")
@@ -119,3 +138,11 @@ func (div *Divider) Draw(ctx DrawContext, point Point) {
 		}
 	}
 }
+
+// Returns the colour of the line or frame
+func (div *Divider) borderColor() string {
+	if div.style.BorderColor == "" {
+		return "black"
+	}
+	return div.style.BorderColor
+}
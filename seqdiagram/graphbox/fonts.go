@@ -26,6 +26,16 @@ type Font interface {
 	Measure(txt string, size float64) (int, int)
 }
 
+// LineMetrics can be implemented by fonts to control how lines of text are laid out.
+// Fonts which do not implement it use metrics suited to TTF fonts.
+type LineMetrics interface {
+	// Returns the gap between lines of text
+	LineGap() int
+
+	// Returns the distance between the baseline and the bottom of a line of text
+	Descent(size int) int
+}
+
 // Given a font, font size, points and gravity, returns a rectangle which will contain
 // the text centered.  The point and gravity describes the location of the rect.
 // The second point is where the text is to start given that it is to be rendered to
@@ -43,6 +53,9 @@ func MeasureFontRect(f Font, size int, text string, x, y int, gravity Gravity) (
 type TTFFont struct {
 	font     *truetype.Font
 	fontName string
+
+	// The raw font file, for embedding in documents
+	data []byte
 }
 
 // Returns a new TTFFont struct
@@ -76,7 +89,7 @@ func NewTTFFontFromByteSlice(b []byte, fontName string) (*TTFFont, error) {
 		return nil, err
 	}
 
-	return &TTFFont{ttfFont, fontName}, nil
+	return &TTFFont{ttfFont, fontName, b}, nil
 }
 
 // Measures the size of a font
@@ -0,0 +1,214 @@
+package graphbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// The tables kept in a font subset.  These are the ones needed to draw glyphs addressed
+// by index, which is how the fonts of a PDF document are used, along with the character
+// map and metrics which some font readers insist on.
+var subsetTables = []string{"OS/2", "cmap", "cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+
+// Returns a true-type font file with only the outlines of the given glyphs, along with
+// any glyphs they are composed from.  Glyph indices are unchanged, with the outlines of
+// the unused glyphs left empty, so that text can still address glyphs by the index in
+// the original font.
+func subsetTTF(data []byte, gids []int) ([]byte, error) {
+	tables, err := readTTFTables(data)
+	if err != nil {
+		return nil, err
+	}
+
+	head, loca, glyf, maxp := tables["head"], tables["loca"], tables["glyf"], tables["maxp"]
+	if len(head) < 54 || len(maxp) < 6 || loca == nil || glyf == nil {
+		return nil, errors.New("font subset: missing required tables")
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	longOffsets := binary.BigEndian.Uint16(head[50:]) != 0
+
+	glyphData := func(gid int) []byte {
+		var start, end int
+		if longOffsets {
+			if len(loca) < (gid+2)*4 {
+				return nil
+			}
+			start, end = int(binary.BigEndian.Uint32(loca[gid*4:])), int(binary.BigEndian.Uint32(loca[gid*4+4:]))
+		} else {
+			if len(loca) < (gid+2)*2 {
+				return nil
+			}
+			start, end = int(binary.BigEndian.Uint16(loca[gid*2:]))*2, int(binary.BigEndian.Uint16(loca[gid*2+2:]))*2
+		}
+		if start >= end || end > len(glyf) {
+			return nil
+		}
+		return glyf[start:end]
+	}
+
+	// Glyph 0 is the missing glyph, which is always kept
+	keep := map[int]bool{0: true}
+	pending := append([]int{0}, gids...)
+	for len(pending) > 0 {
+		gid := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		keep[gid] = true
+
+		for _, c := range glyphComponents(glyphData(gid)) {
+			if !keep[c] {
+				pending = append(pending, c)
+			}
+		}
+	}
+
+	newGlyf := new(bytes.Buffer)
+	newLoca := make([]byte, (numGlyphs+1)*4)
+	for gid := 0; gid < numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(newLoca[gid*4:], uint32(newGlyf.Len()))
+		if keep[gid] {
+			newGlyf.Write(glyphData(gid))
+			for newGlyf.Len()%4 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[numGlyphs*4:], uint32(newGlyf.Len()))
+
+	// The head table is changed to use long offsets for the new loca table.  The
+	// checksum adjustment is set once the whole font is written.
+	newHead := append([]byte{}, head...)
+	binary.BigEndian.PutUint32(newHead[8:], 0)
+	binary.BigEndian.PutUint16(newHead[50:], 1)
+
+	tables["head"], tables["loca"], tables["glyf"] = newHead, newLoca, newGlyf.Bytes()
+
+	out, offsets := writeTTFTables(tables)
+	binary.BigEndian.PutUint32(out[offsets["head"]+8:], 0xB1B0AFBA-ttfChecksum(out))
+
+	return out, nil
+}
+
+// Reads the tables of a true-type font
+func readTTFTables(data []byte) (map[string][]byte, error) {
+	if len(data) < 12 {
+		return nil, errors.New("font subset: font file too short")
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+numTables*16 {
+		return nil, errors.New("font subset: font file too short")
+	}
+
+	tables := make(map[string][]byte)
+	for i := 0; i < numTables; i++ {
+		rec := data[12+i*16:]
+		tag := string(rec[:4])
+		offset, length := int(binary.BigEndian.Uint32(rec[8:])), int(binary.BigEndian.Uint32(rec[12:]))
+		if offset+length > len(data) {
+			return nil, errors.New("font subset: table " + tag + " out of range")
+		}
+		tables[tag] = data[offset : offset+length]
+	}
+
+	return tables, nil
+}
+
+// Writes the subset tables as a true-type font file.  Returns the file along with the
+// offsets of the tables within it.
+func writeTTFTables(tables map[string][]byte) ([]byte, map[string]int) {
+	var tags []string
+	for _, tag := range subsetTables {
+		if _, hasTable := tables[tag]; hasTable {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	out := new(bytes.Buffer)
+	binary.Write(out, binary.BigEndian, []uint16{1, 0, uint16(len(tags)), uint16(searchRange),
+		uint16(entrySelector), uint16(len(tags)*16 - searchRange)})
+
+	offsets := make(map[string]int)
+	offset := 12 + len(tags)*16
+	for _, tag := range tags {
+		t := tables[tag]
+		out.WriteString(tag)
+		binary.Write(out, binary.BigEndian, []uint32{ttfChecksum(t), uint32(offset), uint32(len(t))})
+		offsets[tag] = offset
+		offset += (len(t) + 3) &^ 3
+	}
+
+	for _, tag := range tags {
+		out.Write(tables[tag])
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+
+	return out.Bytes(), offsets
+}
+
+// Returns the indices of the glyphs a composite glyph is made up of.  Returns nil for
+// simple glyphs.
+func glyphComponents(glyph []byte) []int {
+	const (
+		argsAreWords = 0x0001
+		hasScale     = 0x0008
+		moreComps    = 0x0020
+		hasXYScale   = 0x0040
+		hasTwoByTwo  = 0x0080
+	)
+
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+
+	var comps []int
+	for pos := 10; pos+4 <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[pos:])
+		comps = append(comps, int(binary.BigEndian.Uint16(glyph[pos+2:])))
+		pos += 4
+
+		if flags&argsAreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+
+		switch {
+		case flags&hasScale != 0:
+			pos += 2
+		case flags&hasXYScale != 0:
+			pos += 4
+		case flags&hasTwoByTwo != 0:
+			pos += 8
+		}
+
+		if flags&moreComps == 0 {
+			break
+		}
+	}
+
+	return comps
+}
+
+// Returns the true-type checksum of some data, which is the sum of its big-endian
+// 32-bit words
+func ttfChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -5,6 +5,8 @@ package graphbox
 
 import (
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 
 	svg "github.com/ajstarks/svgo"
@@ -177,6 +179,24 @@ func (g *Graphic) Put(r, c int, item GraphboxItem) bool {
 	}
 }
 
+// Returns the number of items which have been put in the graphic
+func (g *Graphic) ItemCount() int {
+	return len(g.items)
+}
+
+// Sets a point in the matrix, like Put, except that the item is drawn before the item at
+// the given index.  This is used to place items underneath items which have already been put.
+func (g *Graphic) PutBefore(index, r, c int, item GraphboxItem) bool {
+	if (r >= 0) && (c >= 0) && (r < len(g.matrix)) && (c < len(g.matrix[r])) && (index >= 0) && (index <= len(g.items)) {
+		g.items = append(g.items, itemInstance{})
+		copy(g.items[index+1:], g.items[index:])
+		g.items[index] = itemInstance{r, c, item}
+		return true
+	} else {
+		return false
+	}
+}
+
 // Draws the graphics as an SVG
 func (g *Graphic) DrawSVG(w io.Writer) {
 	sizeW, sizeH := g.remeasure()
@@ -195,6 +215,57 @@ func (g *Graphic) DrawSVG(w io.Writer) {
 	g.addStyles(canvas)
 	canvas.DefEnd()
 
+	g.Draw(&svgCanvas{canvas})
+}
+
+// Draws the graphics onto a new image
+func (g *Graphic) DrawImage() *image.RGBA {
+	sizeW, sizeH := g.remeasure()
+
+	canvas := newRasterCanvas(sizeW, sizeH)
+	g.Draw(canvas)
+
+	return canvas.img
+}
+
+// Draws the graphics as a PNG image
+func (g *Graphic) DrawPNG(w io.Writer) error {
+	return png.Encode(w, g.DrawImage())
+}
+
+// Draws the graphics as a single page PDF document.  The page size matches the
+// size of the graphic.
+func (g *Graphic) DrawPDF(w io.Writer) error {
+	sizeW, sizeH := g.remeasure()
+
+	canvas := newPDFCanvas(sizeH)
+	g.Draw(canvas)
+
+	return canvas.writeDocument(w, sizeW, sizeH)
+}
+
+// Draws the graphics as text art.  The graphic is expected to be laid out in character
+// cells, such as by using the CellFont.  If asciiOnly is true, lines are drawn using
+// ASCII characters instead of box drawing characters.
+func (g *Graphic) DrawText(w io.Writer, asciiOnly bool) error {
+	sizeW, sizeH := g.remeasure()
+
+	canvas := NewTextCanvas(sizeW+1, sizeH+1)
+	canvas.ASCII = asciiOnly
+	g.Draw(canvas)
+
+	_, err := canvas.WriteTo(w)
+	return err
+}
+
+// Lays out the graphic and returns the size of it
+func (g *Graphic) Measure() (width, height int) {
+	return g.remeasure()
+}
+
+// Draws the graphic onto a canvas.  The graphic must be laid out first by
+// calling Measure.
+func (g *Graphic) Draw(canvas Canvas) {
 	for _, item := range g.items {
 		g.drawItem(canvas, item)
 	}
@@ -226,7 +297,7 @@ func (g *Graphic) addStyles(canvas *svg.SVG) {
 }
 
 // Draws the item
-func (g *Graphic) drawItem(canvas *svg.SVG, item itemInstance) {
+func (g *Graphic) drawItem(canvas Canvas, item itemInstance) {
 	if !((item.R >= 0) && (item.C >= 0) && (item.R < len(g.matrix)) && (item.C < len(g.matrix[item.R]))) {
 		// Do nothing
 		return
@@ -121,7 +121,7 @@ func (ci CylinderIcon) drawCurve(ctx DrawContext, fx, fy, tx, ty, magX, magY int
 	fmt.Fprint(pathCmds, "M", fx, fy, " ")
 	fmt.Fprint(pathCmds, "C", fx-magX*2, fy-magY*2, ",", tx-magX*2, ty-magY*2, ",", tx, ty)
 
-	ctx.Canvas.Path(pathCmds.String(), style)
+	ctx.Canvas.Path(pathCmds.String(), "", style)
 }
 
 // A cloud
@@ -146,8 +146,8 @@ func (pi PathIcon) Draw(ctx DrawContext, x, y int, lineStyle *SvgStyle) {
 	transformations := fmt.Sprintf("scale(%f) translate(%f %f)", scaleFactor, tx, ty)
 
 	ctx.Canvas.Group(style)
-	ctx.Canvas.Path(pi.Data.Path, "transform=\""+transformations+"\"", "style=\"stroke-width:10px\"")
-	ctx.Canvas.Gend()
+	ctx.Canvas.Path(pi.Data.Path, transformations, "stroke-width:10px")
+	ctx.Canvas.GroupEnd()
 }
 
 type PathIconData struct {
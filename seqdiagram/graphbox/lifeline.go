@@ -2,12 +2,18 @@ package graphbox
 
 type LifeLineStyle struct {
 	Color string
+
+	// The size of the cross drawn at the end of a destroyed lifeline
+	CrossSize int
 }
 
 // The object lifeline
 type LifeLine struct {
 	TR, TC int
 	Style  LifeLineStyle
+
+	// If true, the lifeline ends with a cross
+	Destroyed bool
 }
 
 func (ll *LifeLine) Constraint(r, c int, applier ConstraintApplier) {
@@ -24,5 +30,12 @@ func (ll *LifeLine) Draw(ctx DrawContext, point Point) {
 		tx, ty := point.X, point.Y
 
 		ctx.Canvas.Line(fx, fy, tx, ty, s.ToStyle())
+
+		if ll.Destroyed {
+			cs := "stroke:" + ll.Style.Color + ";stroke-width:2px;"
+			size := ll.Style.CrossSize
+			ctx.Canvas.Line(tx-size, ty-size, tx+size, ty+size, cs)
+			ctx.Canvas.Line(tx-size, ty+size, tx+size, ty-size, cs)
+		}
 	}
 }
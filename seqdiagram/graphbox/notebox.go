@@ -1,5 +1,11 @@
 package graphbox
 
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
 type NoteBoxPos int
 
 const (
@@ -8,6 +14,26 @@ const (
 	RightNotePos             = iota
 )
 
+// NoteShape is the shape of the frame drawn around a note
+type NoteShape int
+
+const (
+	// RectNoteShape is a plain rectangle
+	RectNoteShape NoteShape = iota
+
+	// FoldedNoteShape is a rectangle with the top right corner folded over
+	FoldedNoteShape
+
+	// RoundedNoteShape is a rectangle with rounded corners
+	RoundedNoteShape
+
+	// HexagonNoteShape is a rectangle with pointed left and right ends
+	HexagonNoteShape
+
+	// CloudNoteShape is a rectangle with a scalloped edge
+	CloudNoteShape
+)
+
 // Styling options for the actor rect
 type NoteBoxStyle struct {
 	Font     Font
@@ -15,6 +41,13 @@ type NoteBoxStyle struct {
 	Padding  Point
 	Margin   Point
 	Position NoteBoxPos
+
+	// The shape of the frame, and the fill, border and text colours.  If empty, the
+	// frame is filled with white and the border and text are drawn in black.
+	Shape       NoteShape
+	Color       string
+	BorderColor string
+	TextColor   string
 }
 
 // Draws an object instance
@@ -29,10 +62,12 @@ func NewNoteBox(text string, style NoteBoxStyle, pos NoteBoxPos) *NoteBox {
 	var textAlign TextAlign = MiddleTextAlign
 
 	textBox := NewTextBox(style.Font, style.FontSize, textAlign)
+	textBox.Color = style.TextColor
 	textBox.AddText(text)
 
 	trect := textBox.BoundingRect()
 	brect := trect.BlowOut(style.Padding)
+	brect = brect.BlowOut(noteShapeMargin(style.Shape, brect))
 
 	return &NoteBox{brect, style, textBox, pos}
 }
@@ -59,23 +94,136 @@ func (tr *NoteBox) Constraint(r, c int, applier ConstraintApplier) {
 func (r *NoteBox) Draw(ctx DrawContext, point Point) {
 	centerX, centerY := point.X, point.Y
 	marginX := r.style.Margin.X
+	textInsetX := (r.frameRect.W - r.textBox.BoundingRect().W) / 2
+	frameStyle := noteFrameStyle(r.style.Color, r.style.BorderColor)
 
 	switch r.pos {
 	case CenterNotePos:
 		rect := r.frameRect.PositionAt(centerX, centerY, CenterGravity)
-		ctx.Canvas.Rect(rect.X, rect.Y, rect.W, rect.H, "stroke:black;fill:white;stroke-width:2px;")
+		drawNoteFrame(ctx.Canvas, rect, r.style.Shape, frameStyle)
 		r.textBox.Render(ctx.Canvas, centerX, centerY, CenterGravity)
 	case LeftNotePos:
 		offsetX := centerX - marginX
-		textOffsetX := centerX - r.style.Padding.X - marginX
+		textOffsetX := centerX - textInsetX - marginX
 		rect := r.frameRect.PositionAt(offsetX, centerY, EastGravity)
-		ctx.Canvas.Rect(rect.X, rect.Y, rect.W, rect.H, "stroke:black;fill:white;stroke-width:2px;")
+		drawNoteFrame(ctx.Canvas, rect, r.style.Shape, frameStyle)
 		r.textBox.Render(ctx.Canvas, textOffsetX, centerY, EastGravity)
 	case RightNotePos:
 		offsetX := centerX + marginX
-		textOffsetX := centerX + r.style.Padding.X + marginX
+		textOffsetX := centerX + textInsetX + marginX
 		rect := r.frameRect.PositionAt(offsetX, centerY, WestGravity)
-		ctx.Canvas.Rect(rect.X, rect.Y, rect.W, rect.H, "stroke:black;fill:white;stroke-width:2px;")
+		drawNoteFrame(ctx.Canvas, rect, r.style.Shape, frameStyle)
 		r.textBox.Render(ctx.Canvas, textOffsetX, centerY, WestGravity)
 	}
 }
+
+// Returns the style of a note frame with the given fill and border colours
+func noteFrameStyle(color, borderColor string) string {
+	if color == "" {
+		color = "white"
+	}
+	if borderColor == "" {
+		borderColor = "black"
+	}
+	return "stroke:" + borderColor + ";fill:" + color + ";stroke-width:2px;"
+}
+
+// Returns the space needed between the text and the frame of a note, in addition to the
+// padding, for the frame to be drawn with the given shape.
+func noteShapeMargin(shape NoteShape, rect Rect) Point {
+	switch shape {
+	case HexagonNoteShape:
+		return Point{rect.H / 4, 0}
+	case CloudNoteShape:
+		return Point{rect.H / 4, rect.H / 4}
+	default:
+		return Point{0, 0}
+	}
+}
+
+// Draws the frame of a note within the rectangle.  Shapes which are too small to be drawn,
+// such as those on a text canvas, are drawn as a rectangle.
+func drawNoteFrame(canvas Canvas, rect Rect, shape NoteShape, style string) {
+	x, y, w, h := rect.X, rect.Y, rect.W, rect.H
+
+	switch shape {
+	case FoldedNoteShape:
+		if fold := minInt(h/3, 10); fold > 0 {
+			foldStyle := StyleFromString(style)
+			foldStyle.Set("fill", "none")
+			canvas.Polygon([]int{x, x + w - fold, x + w, x + w, x}, []int{y, y, y + fold, y + h, y + h}, style)
+			canvas.Polyline([]int{x + w - fold, x + w - fold, x + w}, []int{y, y + fold, y + fold},
+				foldStyle.ToStyle())
+			return
+		}
+	case RoundedNoteShape:
+		if r := float64(minInt(h/4, 8)); r > 0 {
+			k := r * 0.45
+			fx, fy, fw, fh := float64(x), float64(y), float64(w), float64(h)
+			path := new(pathData).add('M', fx+r, fy).
+				add('L', fx+fw-r, fy).add('C', fx+fw-k, fy, fx+fw, fy+k, fx+fw, fy+r).
+				add('L', fx+fw, fy+fh-r).add('C', fx+fw, fy+fh-k, fx+fw-k, fy+fh, fx+fw-r, fy+fh).
+				add('L', fx+r, fy+fh).add('C', fx+k, fy+fh, fx, fy+fh-k, fx, fy+fh-r).
+				add('L', fx, fy+r).add('C', fx, fy+k, fx+k, fy, fx+r, fy).
+				add('Z')
+			canvas.Path(path.String(), "", style)
+			return
+		}
+	case HexagonNoteShape:
+		if d := h / 4; d > 0 {
+			canvas.Polygon([]int{x + d, x + w - d, x + w, x + w - d, x + d, x},
+				[]int{y, y, y + h/2, y + h, y + h, y + h/2}, style)
+			return
+		}
+	case CloudNoteShape:
+		if b := h / 6; b > 0 {
+			canvas.Path(cloudPath(rect.BlowOut(Point{-b, -b}), float64(b)), "", style)
+			return
+		}
+	}
+
+	canvas.Rect(x, y, w, h, style)
+}
+
+// Returns the path data of a cloud drawn as bumps of the given size around the edge of the
+// rectangle
+func cloudPath(rect Rect, bump float64) string {
+	fx, fy, fw, fh := float64(rect.X), float64(rect.Y), float64(rect.W), float64(rect.H)
+	path := new(pathData).add('M', fx, fy)
+
+	// Each edge is divided into bumps about twice as wide as they are high.  The control
+	// points of each curve are placed so that the curve reaches the size of the bump.
+	out := bump * 4 / 3
+	edge := func(x1, y1, x2, y2, nx, ny float64) {
+		n := math.Max(1, math.Round(math.Hypot(x2-x1, y2-y1)/(bump*2)))
+		dx, dy := (x2-x1)/n, (y2-y1)/n
+		for i := 0.0; i < n; i++ {
+			sx, sy := x1+dx*i, y1+dy*i
+			path.add('C', sx+nx*out, sy+ny*out, sx+dx+nx*out, sy+dy+ny*out, sx+dx, sy+dy)
+		}
+	}
+
+	edge(fx, fy, fx+fw, fy, 0, -1)
+	edge(fx+fw, fy, fx+fw, fy+fh, 1, 0)
+	edge(fx+fw, fy+fh, fx, fy+fh, 0, 1)
+	edge(fx, fy+fh, fx, fy, -1, 0)
+	return path.add('Z').String()
+}
+
+// Path data built up from commands
+type pathData struct {
+	bytes.Buffer
+}
+
+// Adds a command with its points, which are rounded to two decimal places
+func (pd *pathData) add(op byte, pts ...float64) *pathData {
+	if pd.Len() > 0 {
+		pd.WriteByte(' ')
+	}
+	pd.WriteByte(op)
+	for _, p := range pts {
+		pd.WriteByte(' ')
+		pd.WriteString(strconv.FormatFloat(math.Round(p*100)/100, 'f', -1, 64))
+	}
+	return pd
+}
@@ -0,0 +1,236 @@
+package graphbox
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A single path command with absolute coordinates.  Op is one of 'M' (move), 'L' (line),
+// 'C' (cubic curve, with two control points followed by the end point) or 'Z' (close).
+type pathCmd struct {
+	Op  byte
+	Pts []float64
+}
+
+// Parses SVG path data into a list of absolute path commands.  Relative commands,
+// horizontal and vertical lines and quadratic curves are converted to their absolute
+// M, L and C equivalents.  Arcs are not supported.
+func parsePathData(d string) ([]pathCmd, error) {
+	pp := &pathDataParser{d: d}
+	return pp.parse()
+}
+
+type pathDataParser struct {
+	d   string
+	pos int
+
+	cmds          []pathCmd
+	cx, cy        float64 // current point
+	sx, sy        float64 // start of the current subpath
+	lastCtrlX     float64 // last control point, for smooth curves
+	lastCtrlY     float64
+	lastWasCurve  bool
+	lastWasQuad   bool
+	lastQuadCtrlX float64
+	lastQuadCtrlY float64
+}
+
+func (pp *pathDataParser) parse() ([]pathCmd, error) {
+	var op byte
+
+	for {
+		pp.skipSeparators()
+		if pp.pos >= len(pp.d) {
+			break
+		}
+
+		ch := pp.d[pp.pos]
+		if isPathCommand(ch) {
+			op = ch
+			pp.pos++
+		} else if op == 0 {
+			return nil, fmt.Errorf("path data: expected command at offset %d", pp.pos)
+		} else if op == 'M' {
+			// Implicit commands after a move are treated as line-tos
+			op = 'L'
+		} else if op == 'm' {
+			op = 'l'
+		}
+
+		if err := pp.command(op); err != nil {
+			return nil, err
+		}
+	}
+
+	return pp.cmds, nil
+}
+
+func (pp *pathDataParser) command(op byte) error {
+	rel := op >= 'a' && op <= 'z'
+	ox, oy := 0.0, 0.0
+	if rel {
+		ox, oy = pp.cx, pp.cy
+	}
+
+	switch op {
+	case 'M', 'm':
+		p, err := pp.numbers(2)
+		if err != nil {
+			return err
+		}
+		pp.cx, pp.cy = ox+p[0], oy+p[1]
+		pp.sx, pp.sy = pp.cx, pp.cy
+		pp.add('M', pp.cx, pp.cy)
+	case 'L', 'l':
+		p, err := pp.numbers(2)
+		if err != nil {
+			return err
+		}
+		pp.cx, pp.cy = ox+p[0], oy+p[1]
+		pp.add('L', pp.cx, pp.cy)
+	case 'H', 'h':
+		p, err := pp.numbers(1)
+		if err != nil {
+			return err
+		}
+		pp.cx = ox + p[0]
+		pp.add('L', pp.cx, pp.cy)
+	case 'V', 'v':
+		p, err := pp.numbers(1)
+		if err != nil {
+			return err
+		}
+		pp.cy = oy + p[0]
+		pp.add('L', pp.cx, pp.cy)
+	case 'C', 'c':
+		p, err := pp.numbers(6)
+		if err != nil {
+			return err
+		}
+		pp.curve(ox+p[0], oy+p[1], ox+p[2], oy+p[3], ox+p[4], oy+p[5])
+		return nil
+	case 'S', 's':
+		p, err := pp.numbers(4)
+		if err != nil {
+			return err
+		}
+		c1x, c1y := pp.cx, pp.cy
+		if pp.lastWasCurve {
+			c1x, c1y = 2*pp.cx-pp.lastCtrlX, 2*pp.cy-pp.lastCtrlY
+		}
+		pp.curve(c1x, c1y, ox+p[0], oy+p[1], ox+p[2], oy+p[3])
+		return nil
+	case 'Q', 'q':
+		p, err := pp.numbers(4)
+		if err != nil {
+			return err
+		}
+		pp.quad(ox+p[0], oy+p[1], ox+p[2], oy+p[3])
+		return nil
+	case 'T', 't':
+		p, err := pp.numbers(2)
+		if err != nil {
+			return err
+		}
+		qx, qy := pp.cx, pp.cy
+		if pp.lastWasQuad {
+			qx, qy = 2*pp.cx-pp.lastQuadCtrlX, 2*pp.cy-pp.lastQuadCtrlY
+		}
+		pp.quad(qx, qy, ox+p[0], oy+p[1])
+		return nil
+	case 'Z', 'z':
+		pp.cx, pp.cy = pp.sx, pp.sy
+		pp.add('Z')
+	default:
+		return fmt.Errorf("path data: unsupported command '%c'", op)
+	}
+
+	pp.lastWasCurve, pp.lastWasQuad = false, false
+	return nil
+}
+
+func (pp *pathDataParser) curve(c1x, c1y, c2x, c2y, x, y float64) {
+	pp.add('C', c1x, c1y, c2x, c2y, x, y)
+	pp.cx, pp.cy = x, y
+	pp.lastCtrlX, pp.lastCtrlY = c2x, c2y
+	pp.lastWasCurve, pp.lastWasQuad = true, false
+}
+
+// Adds a quadratic curve by converting it into the equivalent cubic curve
+func (pp *pathDataParser) quad(qx, qy, x, y float64) {
+	c1x, c1y := pp.cx+2.0/3.0*(qx-pp.cx), pp.cy+2.0/3.0*(qy-pp.cy)
+	c2x, c2y := x+2.0/3.0*(qx-x), y+2.0/3.0*(qy-y)
+	pp.curve(c1x, c1y, c2x, c2y, x, y)
+	pp.lastQuadCtrlX, pp.lastQuadCtrlY = qx, qy
+	pp.lastWasCurve, pp.lastWasQuad = false, true
+}
+
+func (pp *pathDataParser) add(op byte, pts ...float64) {
+	pp.cmds = append(pp.cmds, pathCmd{op, pts})
+}
+
+// Reads n numbers from the path data
+func (pp *pathDataParser) numbers(n int) ([]float64, error) {
+	nums := make([]float64, n)
+	for i := range nums {
+		pp.skipSeparators()
+		start := pp.pos
+		pp.scanNumber()
+		if start == pp.pos {
+			return nil, fmt.Errorf("path data: expected number at offset %d", start)
+		}
+
+		v, err := strconv.ParseFloat(pp.d[start:pp.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("path data: %v", err)
+		}
+		nums[i] = v
+	}
+	return nums, nil
+}
+
+// Advances over a single number.  Numbers can run into each other without separators,
+// such as "0.411-12.001" or "1.5.5".
+func (pp *pathDataParser) scanNumber() {
+	d := pp.d
+	if pp.pos < len(d) && (d[pp.pos] == '-' || d[pp.pos] == '+') {
+		pp.pos++
+	}
+
+	seenDot, seenExp := false, false
+	for pp.pos < len(d) {
+		ch := d[pp.pos]
+		switch {
+		case ch >= '0' && ch <= '9':
+		case ch == '.' && !seenDot && !seenExp:
+			seenDot = true
+		case (ch == 'e' || ch == 'E') && !seenExp:
+			seenExp = true
+			if pp.pos+1 < len(d) && (d[pp.pos+1] == '-' || d[pp.pos+1] == '+') {
+				pp.pos++
+			}
+		default:
+			return
+		}
+		pp.pos++
+	}
+}
+
+func (pp *pathDataParser) skipSeparators() {
+	for pp.pos < len(pp.d) {
+		switch pp.d[pp.pos] {
+		case ' ', '\t', '\n', '\r', ',':
+			pp.pos++
+		default:
+			return
+		}
+	}
+}
+
+func isPathCommand(ch byte) bool {
+	switch ch {
+	case 'M', 'm', 'L', 'l', 'H', 'h', 'V', 'v', 'C', 'c', 'S', 's', 'Q', 'q', 'T', 't', 'Z', 'z':
+		return true
+	}
+	return false
+}
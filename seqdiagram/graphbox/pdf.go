@@ -0,0 +1,397 @@
+package graphbox
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// A canvas which produces the page content of a PDF document.  Shapes are drawn as
+// vector paths and text is set using embedded true-type fonts.
+type pdfCanvas struct {
+	content *bytes.Buffer
+	groups  groupStyles
+
+	// Fonts used on the page, in order of first use
+	fonts []*pdfFont
+}
+
+// A font used within the PDF document
+type pdfFont struct {
+	ttf      *TTFFont
+	resource string
+
+	// Glyphs used, mapped to the rune they were used for
+	glyphs map[truetype.Index]rune
+}
+
+func newPDFCanvas(height int) *pdfCanvas {
+	pc := &pdfCanvas{content: new(bytes.Buffer)}
+
+	// Flip the coordinate system so that the origin is at the top left, like SVG
+	fmt.Fprintf(pc.content, "1 0 0 -1 0 %d cm\n1 j 0 J\n", height)
+	return pc
+}
+
+func (pc *pdfCanvas) Line(x1, y1, x2, y2 int, style string) {
+	st := pc.groups.resolve(style, 1)
+	st.Fill = nil
+	pc.drawPath(st, identityMatrix, polylinePath([]int{x1, x2}, []int{y1, y2}, false))
+}
+
+func (pc *pdfCanvas) Polyline(xs, ys []int, style string) {
+	pc.drawPath(pc.groups.resolve(style, 1), identityMatrix, polylinePath(xs, ys, false))
+}
+
+func (pc *pdfCanvas) Polygon(xs, ys []int, style string) {
+	pc.drawPath(pc.groups.resolve(style, 1), identityMatrix, polylinePath(xs, ys, true))
+}
+
+func (pc *pdfCanvas) Rect(x, y, w, h int, style string) {
+	pc.Polygon([]int{x, x + w, x + w, x}, []int{y, y, y + h, y + h}, style)
+}
+
+func (pc *pdfCanvas) Circle(x, y, r int, style string) {
+	const k = 0.5522847498
+
+	fx, fy, fr := float64(x), float64(y), float64(r)
+
+	cmds := []pathCmd{
+		{'M', []float64{fx + fr, fy}},
+		{'C', []float64{fx + fr, fy + fr*k, fx + fr*k, fy + fr, fx, fy + fr}},
+		{'C', []float64{fx - fr*k, fy + fr, fx - fr, fy + fr*k, fx - fr, fy}},
+		{'C', []float64{fx - fr, fy - fr*k, fx - fr*k, fy - fr, fx, fy - fr}},
+		{'C', []float64{fx + fr*k, fy - fr, fx + fr, fy - fr*k, fx + fr, fy}},
+		{'Z', nil},
+	}
+	pc.drawPath(pc.groups.resolve(style, 1), identityMatrix, cmds)
+}
+
+func (pc *pdfCanvas) Path(d string, transform string, style string) {
+	cmds, err := parsePathData(d)
+	if err != nil {
+		return
+	}
+
+	m, err := parseTransform(transform)
+	if err != nil {
+		return
+	}
+
+	pc.drawPath(pc.groups.resolve(style, m.scaleFactor()), m, cmds)
+}
+
+func (pc *pdfCanvas) Text(x, y int, text string, style TextStyle) {
+	ttf, isTTF := style.Font.(*TTFFont)
+	if !isTTF {
+		return
+	}
+	pf := pc.fontFor(ttf)
+
+	glyphs := new(bytes.Buffer)
+	for _, r := range text {
+		idx := ttf.font.Index(r)
+		if _, hasGlyph := pf.glyphs[idx]; !hasGlyph {
+			pf.glyphs[idx] = r
+		}
+		fmt.Fprintf(glyphs, "%04X", uint16(idx))
+	}
+
+	fmt.Fprintf(pc.content, "BT %s rg /%s %d Tf 1 0 0 -1 %d %d Tm <%s> Tj ET\n",
+		pdfColor(textColor(style)), pf.resource, style.FontSize, x, y, glyphs.String())
+}
+
+func (pc *pdfCanvas) Group(style string) {
+	pc.groups.push(style)
+}
+
+func (pc *pdfCanvas) GroupEnd() {
+	pc.groups.pop()
+}
+
+// Links are not supported
+func (pc *pdfCanvas) StartLink(url string) {}
+
+func (pc *pdfCanvas) EndLink() {}
+
+// Returns the font resource for a true-type font, adding it if it has not been used yet
+func (pc *pdfCanvas) fontFor(ttf *TTFFont) *pdfFont {
+	for _, f := range pc.fonts {
+		if f.ttf == ttf {
+			return f
+		}
+	}
+
+	f := &pdfFont{ttf, "F" + strconv.Itoa(len(pc.fonts)+1), make(map[truetype.Index]rune)}
+	pc.fonts = append(pc.fonts, f)
+	return f
+}
+
+// Returns the path commands for a series of points
+func polylinePath(xs, ys []int, closed bool) []pathCmd {
+	var cmds []pathCmd
+	for i := 0; i < len(xs) && i < len(ys); i++ {
+		op := byte('L')
+		if i == 0 {
+			op = 'M'
+		}
+		cmds = append(cmds, pathCmd{op, []float64{float64(xs[i]), float64(ys[i])}})
+	}
+	if closed {
+		cmds = append(cmds, pathCmd{'Z', nil})
+	}
+	return cmds
+}
+
+// Fills and strokes the path.  Like SVG, unclosed subpaths are implicitly closed when
+// filled but not when stroked, so these are painted in two steps.
+func (pc *pdfCanvas) drawPath(st shapeStyle, m matrix, cmds []pathCmd) {
+	hasOpenSubpath := false
+	for i, cmd := range cmds {
+		if cmd.Op == 'M' && i > 0 && cmds[i-1].Op != 'Z' {
+			hasOpenSubpath = true
+		}
+	}
+	if len(cmds) > 0 && cmds[len(cmds)-1].Op != 'Z' {
+		hasOpenSubpath = true
+	}
+
+	doFill := st.Fill != nil
+	doStroke := st.Stroke != nil && st.StrokeWidth > 0
+
+	if doFill {
+		fmt.Fprintf(pc.content, "%s rg\n", pdfColor(st.Fill))
+	}
+	if doStroke {
+		fmt.Fprintf(pc.content, "%s RG %s w [", pdfColor(st.Stroke), pdfNum(st.StrokeWidth))
+		for i, d := range st.Dashes {
+			if i > 0 {
+				pc.content.WriteString(" ")
+			}
+			pc.content.WriteString(pdfNum(d))
+		}
+		pc.content.WriteString("] 0 d\n")
+	}
+
+	switch {
+	case doFill && doStroke && !hasOpenSubpath:
+		pc.writePath(m, cmds)
+		pc.content.WriteString("B\n")
+	case doFill && doStroke:
+		pc.writePath(m, cmds)
+		pc.content.WriteString("f\n")
+		pc.writePath(m, cmds)
+		pc.content.WriteString("S\n")
+	case doFill:
+		pc.writePath(m, cmds)
+		pc.content.WriteString("f\n")
+	case doStroke:
+		pc.writePath(m, cmds)
+		pc.content.WriteString("S\n")
+	}
+}
+
+func (pc *pdfCanvas) writePath(m matrix, cmds []pathCmd) {
+	for _, cmd := range cmds {
+		switch cmd.Op {
+		case 'M', 'L':
+			x, y := m.apply(cmd.Pts[0], cmd.Pts[1])
+			fmt.Fprintf(pc.content, "%s %s %c ", pdfNum(x), pdfNum(y), strings.ToLower(string(cmd.Op))[0])
+		case 'C':
+			for i := 0; i < 6; i += 2 {
+				x, y := m.apply(cmd.Pts[i], cmd.Pts[i+1])
+				fmt.Fprintf(pc.content, "%s %s ", pdfNum(x), pdfNum(y))
+			}
+			pc.content.WriteString("c ")
+		case 'Z':
+			pc.content.WriteString("h ")
+		}
+	}
+}
+
+// Writes the PDF document with a single page containing the canvas content
+func (pc *pdfCanvas) writeDocument(w io.Writer, width, height int) error {
+	pw := &pdfWriter{buf: new(bytes.Buffer)}
+	pw.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object numbers are allocated up front: 1 catalog, 2 pages, 3 page, 4 contents,
+	// then five objects per font.
+	fontResources := new(bytes.Buffer)
+	for i, f := range pc.fonts {
+		fmt.Fprintf(fontResources, "/%s %d 0 R ", f.resource, 5+i*5)
+	}
+
+	pw.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	pw.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	pw.object(3, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s>> >> /Contents 4 0 R >>",
+		width, height, fontResources.String()))
+	if err := pw.stream(4, "", pc.content.Bytes()); err != nil {
+		return err
+	}
+
+	for i, f := range pc.fonts {
+		if err := pw.font(5+i*5, f); err != nil {
+			return err
+		}
+	}
+
+	pw.trailer()
+	_, err := w.Write(pw.buf.Bytes())
+	return err
+}
+
+// Writes the objects of a PDF file, keeping track of their offsets
+type pdfWriter struct {
+	buf     *bytes.Buffer
+	offsets []int
+}
+
+func (pw *pdfWriter) begin(num int) {
+	for len(pw.offsets) < num {
+		pw.offsets = append(pw.offsets, 0)
+	}
+	pw.offsets[num-1] = pw.buf.Len()
+	fmt.Fprintf(pw.buf, "%d 0 obj\n", num)
+}
+
+func (pw *pdfWriter) object(num int, body string) {
+	pw.begin(num)
+	fmt.Fprintf(pw.buf, "%s\nendobj\n", body)
+}
+
+// Writes a compressed stream object.  The dict argument contains extra dictionary entries.
+func (pw *pdfWriter) stream(num int, dict string, data []byte) error {
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	pw.begin(num)
+	fmt.Fprintf(pw.buf, "<< /Length %d /Filter /FlateDecode %s>>\nstream\n", compressed.Len(), dict)
+	pw.buf.Write(compressed.Bytes())
+	pw.buf.WriteString("\nendstream\nendobj\n")
+	return nil
+}
+
+// Writes a true-type font as a composite font, addressing glyphs by index.  This
+// takes five objects: the type 0 font, the CID font, the font descriptor, the ToUnicode
+// map (so that text can be extracted from the document) and the font file.  Only the
+// glyphs used in the document are embedded.
+func (pw *pdfWriter) font(num int, f *pdfFont) error {
+	ttf := f.ttf.font
+	upem := ttf.FUnitsPerEm()
+	scale := fixed.Int26_6(upem)
+	toPDFUnits := func(v fixed.Int26_6) int { return int(v) * 1000 / int(upem) }
+
+	name := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+			return -1
+		}
+		return r
+	}, f.ttf.fontName)
+
+	gids := make([]int, 0, len(f.glyphs))
+	for idx := range f.glyphs {
+		gids = append(gids, int(idx))
+	}
+	sort.Ints(gids)
+
+	widths := new(bytes.Buffer)
+	toUnicode := new(bytes.Buffer)
+	fmt.Fprintf(toUnicode, "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n"+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n"+
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n"+
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	for i, gid := range gids {
+		adv := ttf.HMetric(scale, truetype.Index(gid)).AdvanceWidth
+		fmt.Fprintf(widths, "%d [%d] ", gid, toPDFUnits(adv))
+
+		if i%100 == 0 {
+			if i > 0 {
+				toUnicode.WriteString("endbfchar\n")
+			}
+			fmt.Fprintf(toUnicode, "%d beginbfchar\n", minInt(100, len(gids)-i))
+		}
+		fmt.Fprintf(toUnicode, "<%04X> <", gid)
+		for _, u := range utf16Units(f.glyphs[truetype.Index(gid)]) {
+			fmt.Fprintf(toUnicode, "%04X", u)
+		}
+		toUnicode.WriteString(">\n")
+	}
+	if len(gids) > 0 {
+		toUnicode.WriteString("endbfchar\n")
+	}
+	toUnicode.WriteString("endcmap CMapName currentdict /CMap defineresource pop end end\n")
+
+	fontFile, err := subsetTTF(f.ttf.data, gids)
+	if err != nil {
+		return err
+	}
+
+	bounds := ttf.Bounds(scale)
+	ascent, descent := toPDFUnits(bounds.Max.Y), toPDFUnits(bounds.Min.Y)
+
+	// The cap height is taken from the height of "H"
+	capHeight := ascent
+	var capGlyph truetype.GlyphBuf
+	if err := capGlyph.Load(ttf, scale, ttf.Index('H'), font.HintingNone); err == nil {
+		capHeight = toPDFUnits(capGlyph.Bounds.Max.Y)
+	}
+
+	pw.object(num, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, num+1, num+3))
+	pw.object(num+1, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		name, num+2, widths.String()))
+	pw.object(num+2, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, toPDFUnits(bounds.Min.X), descent, toPDFUnits(bounds.Max.X), ascent, ascent, descent, capHeight, num+4))
+	if err := pw.stream(num+3, "", toUnicode.Bytes()); err != nil {
+		return err
+	}
+	return pw.stream(num+4, fmt.Sprintf("/Length1 %d ", len(fontFile)), fontFile)
+}
+
+func (pw *pdfWriter) trailer() {
+	xrefOffset := pw.buf.Len()
+	fmt.Fprintf(pw.buf, "xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, off := range pw.offsets {
+		fmt.Fprintf(pw.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(pw.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, xrefOffset)
+}
+
+// Formats a number for the content stream
+func pdfNum(v float64) string {
+	if math.Abs(v) < 0.005 {
+		return "0"
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// Formats a colour as the three operands of the rg or RG operator
+func pdfColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return pdfNum(float64(r)/0xffff) + " " + pdfNum(float64(g)/0xffff) + " " + pdfNum(float64(b)/0xffff)
+}
+
+// Encodes a rune as UTF-16 code units
+func utf16Units(r rune) []uint16 {
+	if r >= 0x10000 {
+		r -= 0x10000
+		return []uint16{uint16(0xD800 + (r>>10)&0x3FF), uint16(0xDC00 + r&0x3FF)}
+	}
+	return []uint16{uint16(r)}
+}
@@ -0,0 +1,317 @@
+package graphbox
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/golang/freetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/vector"
+)
+
+// A canvas which draws directly onto an RGBA image
+type rasterCanvas struct {
+	img    *image.RGBA
+	groups groupStyles
+}
+
+// A point in device space
+type fpoint struct {
+	X, Y float64
+}
+
+// A sequence of connected points
+type fpolyline struct {
+	Pts    []fpoint
+	Closed bool
+}
+
+func newRasterCanvas(w, h int) *rasterCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	return &rasterCanvas{img: img}
+}
+
+func (rc *rasterCanvas) Line(x1, y1, x2, y2 int, style string) {
+	rc.stroke(rc.groups.resolve(style, 1), []fpolyline{pointsPolyline([]int{x1, x2}, []int{y1, y2}, false)})
+}
+
+func (rc *rasterCanvas) Polyline(xs, ys []int, style string) {
+	rc.fillAndStroke(rc.groups.resolve(style, 1), []fpolyline{pointsPolyline(xs, ys, false)})
+}
+
+func (rc *rasterCanvas) Polygon(xs, ys []int, style string) {
+	rc.fillAndStroke(rc.groups.resolve(style, 1), []fpolyline{pointsPolyline(xs, ys, true)})
+}
+
+func (rc *rasterCanvas) Rect(x, y, w, h int, style string) {
+	rc.Polygon([]int{x, x + w, x + w, x}, []int{y, y, y + h, y + h}, style)
+}
+
+func (rc *rasterCanvas) Circle(x, y, r int, style string) {
+	segs := maxInt(16, r*2)
+	pl := fpolyline{Closed: true}
+	for i := 0; i < segs; i++ {
+		a := 2 * math.Pi * float64(i) / float64(segs)
+		pl.Pts = append(pl.Pts, fpoint{float64(x) + float64(r)*math.Cos(a), float64(y) + float64(r)*math.Sin(a)})
+	}
+	rc.fillAndStroke(rc.groups.resolve(style, 1), []fpolyline{pl})
+}
+
+func (rc *rasterCanvas) Path(d string, transform string, style string) {
+	cmds, err := parsePathData(d)
+	if err != nil {
+		return
+	}
+
+	m, err := parseTransform(transform)
+	if err != nil {
+		return
+	}
+
+	rc.fillAndStroke(rc.groups.resolve(style, m.scaleFactor()), flattenPath(cmds, m))
+}
+
+func (rc *rasterCanvas) Text(x, y int, text string, style TextStyle) {
+	ttf, isTTF := style.Font.(*TTFFont)
+	if !isTTF {
+		return
+	}
+
+	ctx := freetype.NewContext()
+	ctx.SetDPI(72)
+	ctx.SetFont(ttf.font)
+	ctx.SetFontSize(float64(style.FontSize))
+	ctx.SetHinting(font.HintingFull)
+	ctx.SetClip(rc.img.Bounds())
+	ctx.SetDst(rc.img)
+	ctx.SetSrc(image.NewUniform(textColor(style)))
+	ctx.DrawString(text, freetype.Pt(x, y))
+}
+
+func (rc *rasterCanvas) Group(style string) {
+	rc.groups.push(style)
+}
+
+func (rc *rasterCanvas) GroupEnd() {
+	rc.groups.pop()
+}
+
+// Links are not supported
+func (rc *rasterCanvas) StartLink(url string) {}
+
+func (rc *rasterCanvas) EndLink() {}
+
+func (rc *rasterCanvas) fillAndStroke(st shapeStyle, pls []fpolyline) {
+	if st.Fill != nil {
+		z := rc.newRasterizer()
+		for _, pl := range pls {
+			addPolygon(z, pl.Pts, false)
+		}
+		rc.paint(z, st.Fill)
+	}
+
+	rc.stroke(st, pls)
+}
+
+// Strokes the polylines.  Segments are drawn with butt ends and round joins.
+func (rc *rasterCanvas) stroke(st shapeStyle, pls []fpolyline) {
+	width := st.StrokeWidth
+	if st.Stroke == nil || width <= 0 {
+		return
+	}
+
+	if len(st.Dashes) > 0 {
+		pls = dashPolylines(pls, st.Dashes)
+	}
+
+	z := rc.newRasterizer()
+	hw := width / 2
+	for _, pl := range pls {
+		pts := pl.Pts
+		if pl.Closed && len(pts) > 1 {
+			pts = append(append([]fpoint{}, pts...), pts[0])
+		}
+
+		for i := 1; i < len(pts); i++ {
+			p, q := pts[i-1], pts[i]
+			dx, dy := q.X-p.X, q.Y-p.Y
+			l := math.Hypot(dx, dy)
+			if l == 0 {
+				continue
+			}
+			nx, ny := -dy/l*hw, dx/l*hw
+			addPolygon(z, []fpoint{{p.X + nx, p.Y + ny}, {q.X + nx, q.Y + ny}, {q.X - nx, q.Y - ny}, {p.X - nx, p.Y - ny}}, true)
+		}
+
+		// Round joins on the inner vertices
+		for i := 1; i < len(pts)-1; i++ {
+			addPolygon(z, circlePoints(pts[i], hw), true)
+		}
+		if pl.Closed && len(pts) > 2 {
+			addPolygon(z, circlePoints(pts[0], hw), true)
+		}
+	}
+	rc.paint(z, st.Stroke)
+}
+
+func (rc *rasterCanvas) newRasterizer() *vector.Rasterizer {
+	b := rc.img.Bounds()
+	return vector.NewRasterizer(b.Dx(), b.Dy())
+}
+
+func (rc *rasterCanvas) paint(z *vector.Rasterizer, c color.Color) {
+	z.Draw(rc.img, rc.img.Bounds(), image.NewUniform(c), image.Point{})
+}
+
+// Adds a closed polygon to the rasterizer.  If normalize is true, the points are
+// reordered to have the same winding so that overlapping polygons do not cancel out.
+func addPolygon(z *vector.Rasterizer, pts []fpoint, normalize bool) {
+	if len(pts) < 2 {
+		return
+	}
+
+	if normalize && signedArea(pts) < 0 {
+		rev := make([]fpoint, len(pts))
+		for i, p := range pts {
+			rev[len(pts)-1-i] = p
+		}
+		pts = rev
+	}
+
+	z.MoveTo(float32(pts[0].X), float32(pts[0].Y))
+	for _, p := range pts[1:] {
+		z.LineTo(float32(p.X), float32(p.Y))
+	}
+	z.ClosePath()
+}
+
+func signedArea(pts []fpoint) float64 {
+	a := 0.0
+	for i := range pts {
+		p, q := pts[i], pts[(i+1)%len(pts)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a / 2
+}
+
+func circlePoints(c fpoint, r float64) []fpoint {
+	segs := maxInt(8, int(r*4))
+	pts := make([]fpoint, segs)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / float64(segs)
+		pts[i] = fpoint{c.X + r*math.Cos(a), c.Y + r*math.Sin(a)}
+	}
+	return pts
+}
+
+func pointsPolyline(xs, ys []int, closed bool) fpolyline {
+	pl := fpolyline{Closed: closed}
+	for i := 0; i < len(xs) && i < len(ys); i++ {
+		pl.Pts = append(pl.Pts, fpoint{float64(xs[i]), float64(ys[i])})
+	}
+	return pl
+}
+
+// Converts path commands into polylines in device space, approximating curves
+// with line segments.
+func flattenPath(cmds []pathCmd, m matrix) []fpolyline {
+	var pls []fpolyline
+	var cur *fpolyline
+	var cx, cy float64
+
+	for _, cmd := range cmds {
+		switch cmd.Op {
+		case 'M':
+			pls = append(pls, fpolyline{})
+			cur = &pls[len(pls)-1]
+			cx, cy = cmd.Pts[0], cmd.Pts[1]
+			x, y := m.apply(cx, cy)
+			cur.Pts = append(cur.Pts, fpoint{x, y})
+		case 'L':
+			if cur == nil {
+				continue
+			}
+			cx, cy = cmd.Pts[0], cmd.Pts[1]
+			x, y := m.apply(cx, cy)
+			cur.Pts = append(cur.Pts, fpoint{x, y})
+		case 'C':
+			if cur == nil {
+				continue
+			}
+			p := cmd.Pts
+			const steps = 16
+			for i := 1; i <= steps; i++ {
+				t := float64(i) / steps
+				u := 1 - t
+				bx := u*u*u*cx + 3*u*u*t*p[0] + 3*u*t*t*p[2] + t*t*t*p[4]
+				by := u*u*u*cy + 3*u*u*t*p[1] + 3*u*t*t*p[3] + t*t*t*p[5]
+				x, y := m.apply(bx, by)
+				cur.Pts = append(cur.Pts, fpoint{x, y})
+			}
+			cx, cy = p[4], p[5]
+		case 'Z':
+			if cur == nil {
+				continue
+			}
+			cur.Closed = true
+			if len(cur.Pts) > 0 {
+				start := cur.Pts[0]
+				pls = append(pls, fpolyline{Pts: []fpoint{start}})
+				cur = &pls[len(pls)-1]
+			}
+		}
+	}
+
+	return pls
+}
+
+// Breaks the polylines up into dashes
+func dashPolylines(pls []fpolyline, dashes []float64) []fpolyline {
+	var out []fpolyline
+
+	for _, pl := range pls {
+		pts := pl.Pts
+		if pl.Closed && len(pts) > 1 {
+			pts = append(append([]fpoint{}, pts...), pts[0])
+		}
+
+		dashIdx, dashLeft, on := 0, dashes[0], true
+		var cur []fpoint
+		if len(pts) > 0 {
+			cur = []fpoint{pts[0]}
+		}
+
+		for i := 1; i < len(pts); i++ {
+			p, q := pts[i-1], pts[i]
+			segLen := math.Hypot(q.X-p.X, q.Y-p.Y)
+			pos := 0.0
+
+			for segLen-pos > dashLeft {
+				pos += dashLeft
+				t := pos / segLen
+				mid := fpoint{p.X + (q.X-p.X)*t, p.Y + (q.Y-p.Y)*t}
+				if on {
+					out = append(out, fpolyline{Pts: append(cur, mid)})
+				}
+				cur = []fpoint{mid}
+
+				on = !on
+				dashIdx = (dashIdx + 1) % len(dashes)
+				dashLeft = dashes[dashIdx]
+			}
+
+			dashLeft -= segLen - pos
+			cur = append(cur, q)
+		}
+
+		if on && len(cur) > 1 {
+			out = append(out, fpolyline{Pts: cur})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,90 @@
+package graphbox
+
+// Ref is a reference to another interaction.  It is drawn as a frame over the lifelines
+// from the column it is placed at to TC, with a "ref" prefix in the top left corner and
+// the message below it.  The frame uses the styling of blocks.
+type Ref struct {
+	TC int
+
+	// If not empty, the URL the frame links to
+	Link string
+
+	style          BlockStyle
+	prefixTextBox  *TextBox
+	prefixRect     Rect
+	messageTextBox *TextBox
+	messageRect    Rect
+}
+
+// NewRef constructs a new Ref
+func NewRef(toCol int, text string, link string, style BlockStyle) *Ref {
+	prefixTextBox := NewTextBox(style.Font, style.FontSize, MiddleTextAlign)
+	prefixTextBox.AddText("ref")
+
+	messageTextBox := NewTextBox(style.Font, style.FontSize, MiddleTextAlign)
+	messageTextBox.AddText(text)
+
+	return &Ref{
+		TC:             toCol,
+		Link:           link,
+		style:          style,
+		prefixTextBox:  prefixTextBox,
+		prefixRect:     prefixFrameRect(prefixTextBox.BoundingRect(), style),
+		messageTextBox: messageTextBox,
+		messageRect:    messageTextBox.BoundingRect().BlowOut(style.MessagePadding),
+	}
+}
+
+// Returns the minimum size of the frame
+func (ref *Ref) size() (width, height int) {
+	return maxInt(ref.prefixRect.W, ref.messageRect.W+ref.style.TextPadding.X*2), ref.prefixRect.H + ref.messageRect.H
+}
+
+// Returns the distance the frame extends beyond the outer lifelines.  This is less than
+// the margin of blocks, so that the frame is within any blocks it is in.
+func (ref *Ref) overhang() int {
+	return ref.style.Margin.X / 2
+}
+
+// Constraint returns the constraints of the graphics object
+func (ref *Ref) Constraint(r, c int, applier ConstraintApplier) {
+	w, h := ref.size()
+	marginX, overhang := ref.style.Margin.X, ref.overhang()
+
+	if c == ref.TC {
+		w = maxInt(w, overhang*2)
+		applier.Apply(SizeConstraint{r, c, w/2 + marginX, w - w/2 + marginX, 0, 0})
+	} else {
+		applier.Apply(SizeConstraint{r, c, overhang + marginX, 0, 0, 0})
+		applier.Apply(SizeConstraint{r, ref.TC, 0, overhang + marginX, 0, 0})
+		applier.Apply(TotalSizeConstraint{r - 1, c, r, ref.TC, w - overhang*2, 0})
+	}
+
+	applier.Apply(AddSizeConstraint{r, c, 0, 0, h/2 + ref.style.Margin.Y, h - h/2 + ref.style.Margin.Y})
+}
+
+// Draw draws the graphics object
+func (ref *Ref) Draw(ctx DrawContext, point Point) {
+	if to, isPoint := ctx.PointAt(ctx.R, ref.TC); isPoint {
+		w, h := ref.size()
+
+		fx, tx := point.X-ref.overhang(), to.X+ref.overhang()
+		if tx-fx < w {
+			centerX := fx + (tx-fx)/2
+			fx, tx = centerX-w/2, centerX-w/2+w
+		}
+		fy, ty := point.Y-h/2, point.Y-h/2+h
+
+		if ref.Link != "" {
+			ctx.Canvas.StartLink(ref.Link)
+			defer ctx.Canvas.EndLink()
+		}
+
+		ctx.Canvas.Rect(fx, fy, tx-fx, ty-fy, "stroke:black;stroke-width:2px;fill:white;")
+
+		drawPrefixFrame(ctx, fx, fy, fx+ref.prefixRect.W, fy+ref.prefixRect.H, ref.style)
+		ref.prefixTextBox.Render(ctx.Canvas, fx+ref.style.TextPadding.X, fy+ref.style.TextPadding.Y, NorthWestGravity)
+
+		ref.messageTextBox.Render(ctx.Canvas, fx+(tx-fx)/2, fy+ref.prefixRect.H+ref.style.MessagePadding.Y, NorthGravity)
+	}
+}
@@ -0,0 +1,116 @@
+package graphbox
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/colornames"
+)
+
+// The presentation attributes of a shape, resolved into device space for the
+// canvases which do their own rendering.
+type shapeStyle struct {
+	Fill        color.Color // nil if the shape is not filled
+	Stroke      color.Color // nil if the shape is not stroked
+	StrokeWidth float64
+	Dashes      []float64
+}
+
+// Resolves the CSS style of a shape.  As in SVG, shapes are filled in black and are
+// not stroked unless the style says otherwise.  Stroke widths and dashes are multiplied
+// by the scale.
+func resolveStyle(css string, scale float64) shapeStyle {
+	s := StyleFromString(css)
+
+	ss := shapeStyle{Fill: color.Black, StrokeWidth: scale}
+	if fill, hasFill := s["fill"]; hasFill {
+		ss.Fill = parseColor(fill)
+	}
+	if stroke, hasStroke := s["stroke"]; hasStroke {
+		ss.Stroke = parseColor(stroke)
+	}
+	if width, hasWidth := s["stroke-width"]; hasWidth {
+		ss.StrokeWidth = parseLength(width) * scale
+	}
+	for _, d := range strings.FieldsFunc(s["stroke-dasharray"], isListSeparator) {
+		ss.Dashes = append(ss.Dashes, parseLength(d)*scale)
+	}
+
+	return ss
+}
+
+// The styles of the groups a canvas is drawing in, with the innermost group last
+type groupStyles []string
+
+func (gs *groupStyles) push(style string) {
+	*gs = append(*gs, style)
+}
+
+func (gs *groupStyles) pop() {
+	if len(*gs) > 0 {
+		*gs = (*gs)[:len(*gs)-1]
+	}
+}
+
+// Resolves the style of a shape drawn within the groups.  The properties of the shape
+// take precedence over those of the groups.
+func (gs groupStyles) resolve(style string, scale float64) shapeStyle {
+	return resolveStyle(strings.Join(append(gs[:len(gs):len(gs)], style), ";"), scale)
+}
+
+// Parses a CSS length in pixels.  Returns zero if the length cannot be parsed.
+func parseLength(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' '
+}
+
+// Parses a CSS colour.  Returns nil for "none" or an empty string, and black for
+// unrecognised colours.
+func parseColor(s string) color.Color {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch {
+	case s == "" || s == "none" || s == "transparent":
+		return nil
+	case strings.HasPrefix(s, "#"):
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil && len(hex) == 6 {
+			return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+		}
+	case strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")"):
+		parts := strings.Split(s[4:len(s)-1], ",")
+		if len(parts) == 3 {
+			var rgb [3]uint8
+			for i, p := range parts {
+				v, _ := strconv.Atoi(strings.TrimSpace(p))
+				rgb[i] = uint8(minInt(maxInt(v, 0), 255))
+			}
+			return color.RGBA{rgb[0], rgb[1], rgb[2], 0xff}
+		}
+	default:
+		if c, hasColor := colornames.Map[s]; hasColor {
+			return c
+		}
+	}
+
+	return color.Black
+}
+
+// Returns the text colour of a text style
+func textColor(s TextStyle) color.Color {
+	if c := parseColor(s.Color); c != nil {
+		return c
+	}
+	return color.Black
+}
@@ -0,0 +1,70 @@
+package graphbox
+
+import (
+	"fmt"
+	"html"
+
+	svg "github.com/ajstarks/svgo"
+)
+
+// A canvas which writes SVG elements
+type svgCanvas struct {
+	svg *svg.SVG
+}
+
+func (sc *svgCanvas) Line(x1, y1, x2, y2 int, style string) {
+	sc.svg.Line(x1, y1, x2, y2, style)
+}
+
+func (sc *svgCanvas) Polyline(xs, ys []int, style string) {
+	sc.svg.Polyline(xs, ys, style)
+}
+
+func (sc *svgCanvas) Polygon(xs, ys []int, style string) {
+	sc.svg.Polygon(xs, ys, style)
+}
+
+func (sc *svgCanvas) Rect(x, y, w, h int, style string) {
+	sc.svg.Rect(x, y, w, h, style)
+}
+
+func (sc *svgCanvas) Circle(x, y, r int, style string) {
+	sc.svg.Circle(x, y, r, style)
+}
+
+func (sc *svgCanvas) Path(d string, transform string, style string) {
+	if transform == "" {
+		sc.svg.Path(d, style)
+	} else {
+		sc.svg.Path(d, "transform=\""+transform+"\"", "style=\""+style+"\"")
+	}
+}
+
+func (sc *svgCanvas) Text(x, y int, text string, style TextStyle) {
+	s := SvgStyle{}
+
+	s.Set("font-family", style.Font.SvgName())
+	s.Set("font-size", fmt.Sprintf("%dpx", style.FontSize))
+
+	if style.Color != "" {
+		s.Set("fill", style.Color)
+	}
+
+	sc.svg.Text(x, y, text, s.ToStyle())
+}
+
+func (sc *svgCanvas) Group(style string) {
+	sc.svg.Group(style)
+}
+
+func (sc *svgCanvas) GroupEnd() {
+	sc.svg.Gend()
+}
+
+func (sc *svgCanvas) StartLink(url string) {
+	sc.svg.Link(html.EscapeString(url), "")
+}
+
+func (sc *svgCanvas) EndLink() {
+	sc.svg.LinkEnd()
+}
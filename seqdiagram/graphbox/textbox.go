@@ -1,10 +1,7 @@
 package graphbox
 
 import (
-	"fmt"
 	"strings"
-
-	svg "github.com/ajstarks/svgo"
 )
 
 const (
@@ -52,10 +49,10 @@ func (tb *TextBox) Measure() (width, height int) {
 	for _, line := range tb.Lines {
 		lw, lh := tb.measureLine(line)
 		w = maxInt(w, lw)
-		h += lh + LINE_GAP
+		h += lh + tb.lineGap()
 	}
 
-	return w, h - LINE_GAP
+	return w, h - tb.lineGap()
 }
 
 // Measures a line
@@ -75,7 +72,7 @@ func (tb *TextBox) BoundingRect() Rect {
 }
 
 // Renders the text from the given point and gravity
-func (tb *TextBox) Render(s *svg.SVG, x, y int, gravity Gravity) {
+func (tb *TextBox) Render(s Canvas, x, y int, gravity Gravity) {
 	rect := tb.BoundingRect().PositionAt(x, y, gravity)
 	left := rect.X
 	currY := rect.Y
@@ -95,26 +92,33 @@ func (tb *TextBox) Render(s *svg.SVG, x, y int, gravity Gravity) {
 			textLeft = left + rect.W - lineW
 		}
 
-		textBottom := currY + lineH - (tb.FontSize*1/4 - 1)
+		textBottom := currY + lineH - tb.descent()
 
 		if line != "" {
 			s.Text(textLeft, textBottom, line, style)
 		}
 
-		currY += lineH + LINE_GAP
+		currY += lineH + tb.lineGap()
 	}
 }
 
-// Returns the text styling
-func (tb *TextBox) textStyle() string {
-	s := SvgStyle{}
-
-	s.Set("font-family", tb.Font.SvgName())
-	s.Set("font-size", fmt.Sprintf("%dpx", tb.FontSize))
+// Returns the gap between lines
+func (tb *TextBox) lineGap() int {
+	if lm, hasLineMetrics := tb.Font.(LineMetrics); hasLineMetrics {
+		return lm.LineGap()
+	}
+	return LINE_GAP
+}
 
-	if tb.Color != "" {
-		s.Set("fill", tb.Color)
+// Returns the distance between the baseline and the bottom of a line
+func (tb *TextBox) descent() int {
+	if lm, hasLineMetrics := tb.Font.(LineMetrics); hasLineMetrics {
+		return lm.Descent(tb.FontSize)
 	}
+	return tb.FontSize*1/4 - 1
+}
 
-	return s.ToStyle()
+// Returns the text styling
+func (tb *TextBox) textStyle() TextStyle {
+	return TextStyle{Font: tb.Font, FontSize: tb.FontSize, Color: tb.Color}
 }
@@ -0,0 +1,421 @@
+package graphbox
+
+import (
+	"bufio"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// CellFont is a font for laying out graphics on a grid of character cells, such as
+// for text art.  Coordinates refer to the centres of the cells, so a run of n
+// characters is n - 1 wide and a single line of text has no height.  The font size
+// is ignored.
+type CellFont struct{}
+
+// SvgName returns the name of the font in SVG
+func (cf CellFont) SvgName() string {
+	return "monospace"
+}
+
+// Measure returns the size of a line of text
+func (cf CellFont) Measure(txt string, size float64) (int, int) {
+	return maxInt(utf8.RuneCountInString(txt)-1, 0), 0
+}
+
+// LineGap returns the gap between lines of text
+func (cf CellFont) LineGap() int {
+	return 1
+}
+
+// Descent returns the distance between the baseline and the bottom of a line of text
+func (cf CellFont) Descent(size int) int {
+	return 0
+}
+
+// Directions of the line segments within a cell
+const (
+	cellLineUp uint8 = 1 << iota
+	cellLineRight
+	cellLineDown
+	cellLineLeft
+)
+
+// A single character cell
+type textCell struct {
+	ch     rune  // a text character, or 0 if the cell has no text
+	lines  uint8 // the directions of the lines passing through the cell
+	heavy  bool  // true if all the lines are heavy
+	dashed bool  // true if all the lines are dashed
+}
+
+// TextCanvas is a canvas which draws onto a grid of character cells, using Unicode
+// box drawing characters for the lines.  It is intended for graphics laid out
+// with the CellFont, with each unit being a single cell.
+//
+// Lines are merged with the lines already in the cells they pass through.  Lines with
+// a stroke width greater than 2 are drawn heavy, and lines with dashes are drawn dashed
+// where possible.  Filling a shape clears the cells it covers.  White strokes are
+// treated as the background and are not drawn.
+type TextCanvas struct {
+	// If true, only ASCII characters are used for the lines and arrows
+	ASCII bool
+
+	cells  [][]textCell
+	groups groupStyles
+}
+
+// NewTextCanvas returns a new, blank text canvas of the given number of columns and rows
+func NewTextCanvas(cols, rows int) *TextCanvas {
+	cells := make([][]textCell, rows)
+	for i := range cells {
+		cells[i] = make([]textCell, cols)
+	}
+
+	return &TextCanvas{cells: cells}
+}
+
+func (tc *TextCanvas) Line(x1, y1, x2, y2 int, style string) {
+	st := tc.groups.resolve(style, 1)
+	st.Fill = nil
+	tc.drawPoints([]Point{{x1, y1}, {x2, y2}}, false, st)
+}
+
+func (tc *TextCanvas) Polyline(xs, ys []int, style string) {
+	tc.drawPoints(toPoints(xs, ys), false, tc.groups.resolve(style, 1))
+}
+
+func (tc *TextCanvas) Polygon(xs, ys []int, style string) {
+	tc.drawPoints(toPoints(xs, ys), true, tc.groups.resolve(style, 1))
+}
+
+func (tc *TextCanvas) Rect(x, y, w, h int, style string) {
+	tc.Polygon([]int{x, x + w, x + w, x}, []int{y, y, y + h, y + h}, style)
+}
+
+// Circle draws a circle.  As circles cannot be drawn with box drawing characters,
+// only the centre is marked.
+func (tc *TextCanvas) Circle(x, y, r int, style string) {
+	st := tc.groups.resolve(style, 1)
+	if isBackgroundColor(st.Stroke) {
+		return
+	}
+
+	if isBackgroundColor(st.Fill) {
+		tc.setText(x, y, 'o')
+	} else {
+		tc.setText(x, y, '●')
+	}
+}
+
+func (tc *TextCanvas) Path(d string, transform string, style string) {
+	cmds, err := parsePathData(d)
+	if err != nil {
+		return
+	}
+
+	m, err := parseTransform(transform)
+	if err != nil {
+		return
+	}
+
+	st := tc.groups.resolve(style, m.scaleFactor())
+	for _, pl := range flattenPath(cmds, m) {
+		pts := make([]Point, len(pl.Pts))
+		for i, p := range pl.Pts {
+			pts[i] = Point{int(math.Round(p.X)), int(math.Round(p.Y))}
+		}
+		tc.drawPoints(pts, pl.Closed, st)
+	}
+}
+
+// Text draws a run of text.  The characters are placed on the row of the baseline,
+// starting at the given column.
+func (tc *TextCanvas) Text(x, y int, text string, style TextStyle) {
+	for _, r := range text {
+		tc.setText(x, y, r)
+		x++
+	}
+}
+
+func (tc *TextCanvas) Group(style string) {
+	tc.groups.push(style)
+}
+
+func (tc *TextCanvas) GroupEnd() {
+	tc.groups.pop()
+}
+
+// Links are not supported
+func (tc *TextCanvas) StartLink(url string) {}
+
+func (tc *TextCanvas) EndLink() {}
+
+// WriteTo writes the canvas as lines of text.  Trailing spaces and blank lines are
+// not written.
+func (tc *TextCanvas) WriteTo(w io.Writer) (int64, error) {
+	lines := make([]string, len(tc.cells))
+	for i, row := range tc.cells {
+		line := new(strings.Builder)
+		for _, cell := range row {
+			line.WriteRune(tc.cellRune(cell))
+		}
+		lines[i] = strings.TrimRight(line.String(), " ")
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	bw := bufio.NewWriter(w)
+	n := int64(0)
+	for _, line := range lines {
+		c, _ := bw.WriteString(line + "\n")
+		n += int64(c)
+	}
+	return n, bw.Flush()
+}
+
+func toPoints(xs, ys []int) []Point {
+	pts := make([]Point, 0, len(xs))
+	for i := 0; i < len(xs) && i < len(ys); i++ {
+		pts = append(pts, Point{xs[i], ys[i]})
+	}
+	return pts
+}
+
+// Fills and strokes a series of points
+func (tc *TextCanvas) drawPoints(pts []Point, closed bool, style shapeStyle) {
+	if len(pts) == 0 {
+		return
+	}
+
+	if style.Fill != nil {
+		tc.clear(pts)
+	}
+
+	if isBackgroundColor(style.Stroke) || style.StrokeWidth <= 0 {
+		return
+	}
+
+	heavy, dashed := style.StrokeWidth > 2, len(style.Dashes) > 0
+	for i := 1; i < len(pts); i++ {
+		tc.drawSegment(pts[i-1], pts[i], heavy, dashed)
+	}
+	if closed && len(pts) > 2 {
+		tc.drawSegment(pts[len(pts)-1], pts[0], heavy, dashed)
+	}
+}
+
+// Clears the cells within the bounds of the points
+func (tc *TextCanvas) clear(pts []Point) {
+	minX, minY, maxX, maxY := pts[0].X, pts[0].Y, pts[0].X, pts[0].Y
+	for _, p := range pts[1:] {
+		minX, maxX = minInt(minX, p.X), maxInt(maxX, p.X)
+		minY, maxY = minInt(minY, p.Y), maxInt(maxY, p.Y)
+	}
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if cell := tc.cellAt(x, y); cell != nil {
+				*cell = textCell{}
+			}
+		}
+	}
+}
+
+// Draws a line segment between two cells
+func (tc *TextCanvas) drawSegment(from, to Point, heavy, dashed bool) {
+	switch {
+	case from == to:
+		return
+	case from.Y == to.Y:
+		if from.X > to.X {
+			from, to = to, from
+		}
+		for x := from.X; x <= to.X; x++ {
+			var dirs uint8
+			if x > from.X {
+				dirs |= cellLineLeft
+			}
+			if x < to.X {
+				dirs |= cellLineRight
+			}
+			tc.addLines(x, from.Y, dirs, heavy, dashed)
+		}
+	case from.X == to.X:
+		if from.Y > to.Y {
+			from, to = to, from
+		}
+		for y := from.Y; y <= to.Y; y++ {
+			var dirs uint8
+			if y > from.Y {
+				dirs |= cellLineUp
+			}
+			if y < to.Y {
+				dirs |= cellLineDown
+			}
+			tc.addLines(from.X, y, dirs, heavy, dashed)
+		}
+	default:
+		tc.drawDiagonal(from, to)
+	}
+}
+
+// Draws a diagonal line using Bresenham's algorithm
+func (tc *TextCanvas) drawDiagonal(from, to Point) {
+	ch := '╲'
+	if (to.X-from.X)*(to.Y-from.Y) < 0 {
+		ch = '╱'
+	}
+
+	dx, dy := absInt(to.X-from.X), -absInt(to.Y-from.Y)
+	sx, sy := 1, 1
+	if from.X > to.X {
+		sx = -1
+	}
+	if from.Y > to.Y {
+		sy = -1
+	}
+
+	x, y, e := from.X, from.Y, dx+dy
+	for {
+		// Diagonals crossing each other are drawn as a cross.  Other text, such as arrow
+		// heads and messages, is kept.
+		cell := tc.cellAt(x, y)
+		switch {
+		case cell == nil:
+		case cell.ch == 0, cell.ch == ch:
+			tc.setText(x, y, ch)
+		case strings.ContainsRune("╱╲╳", cell.ch):
+			tc.setText(x, y, '╳')
+		}
+		if x == to.X && y == to.Y {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y += sy
+		}
+	}
+}
+
+func (tc *TextCanvas) addLines(x, y int, dirs uint8, heavy, dashed bool) {
+	cell := tc.cellAt(x, y)
+	if cell == nil {
+		return
+	}
+
+	if cell.lines == 0 {
+		cell.heavy, cell.dashed = heavy, dashed
+	} else {
+		cell.heavy, cell.dashed = cell.heavy && heavy, cell.dashed && dashed
+	}
+	cell.ch = 0
+	cell.lines |= dirs
+}
+
+func (tc *TextCanvas) setText(x, y int, r rune) {
+	if cell := tc.cellAt(x, y); cell != nil {
+		*cell = textCell{ch: r}
+	}
+}
+
+func (tc *TextCanvas) cellAt(x, y int) *textCell {
+	if y < 0 || y >= len(tc.cells) || x < 0 || x >= len(tc.cells[y]) {
+		return nil
+	}
+	return &tc.cells[y][x]
+}
+
+// Returns the character to display for a cell
+func (tc *TextCanvas) cellRune(cell textCell) rune {
+	if cell.ch != 0 {
+		if tc.ASCII {
+			if r, hasASCII := asciiGlyphs[cell.ch]; hasASCII {
+				return r
+			}
+		}
+		return cell.ch
+	}
+
+	lines := cell.lines
+	if lines == 0 {
+		return ' '
+	}
+
+	// Lines ending in the cell are drawn as if they pass through it
+	switch lines {
+	case cellLineUp, cellLineDown:
+		lines = cellLineUp | cellLineDown
+	case cellLineLeft, cellLineRight:
+		lines = cellLineLeft | cellLineRight
+	}
+
+	if tc.ASCII {
+		switch {
+		case lines == cellLineLeft|cellLineRight && cell.dashed:
+			return '.'
+		case lines == cellLineLeft|cellLineRight && cell.heavy:
+			return '='
+		case lines == cellLineLeft|cellLineRight:
+			return '-'
+		case lines == cellLineUp|cellLineDown && cell.dashed:
+			return ':'
+		case lines == cellLineUp|cellLineDown:
+			return '|'
+		default:
+			return '+'
+		}
+	}
+
+	if cell.dashed {
+		switch lines {
+		case cellLineLeft | cellLineRight:
+			return '╌'
+		case cellLineUp | cellLineDown:
+			return '╎'
+		}
+	}
+	if cell.heavy {
+		return heavyBoxGlyphs[lines]
+	}
+	return lightBoxGlyphs[lines]
+}
+
+// Box drawing characters, indexed by the line directions
+var (
+	lightBoxGlyphs = [16]rune{
+		' ', '│', '─', '└', '│', '│', '┌', '├',
+		'─', '┘', '─', '┴', '┐', '┤', '┬', '┼',
+	}
+	heavyBoxGlyphs = [16]rune{
+		' ', '┃', '━', '┗', '┃', '┃', '┏', '┣',
+		'━', '┛', '━', '┻', '┓', '┫', '┳', '╋',
+	}
+)
+
+// ASCII replacements for the arrow head, diagonal and circle glyphs
+var asciiGlyphs = map[rune]rune{
+	'◀': '<', '◁': '<', '↼': '<', '↽': '<',
+	'▶': '>', '▷': '>', '⇀': '>', '⇁': '>',
+	'╱': '/', '╲': '\\', '╳': 'X', '●': 'o',
+}
+
+// Returns true if the colour is empty or the same as the background
+func isBackgroundColor(c color.Color) bool {
+	if c == nil {
+		return true
+	}
+
+	r, g, b, _ := c.RGBA()
+	wr, wg, wb, _ := color.White.RGBA()
+	return r == wr && g == wg && b == wb
+}
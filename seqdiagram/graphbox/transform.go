@@ -0,0 +1,82 @@
+package graphbox
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A 2D affine transformation.  A point is transformed to (a*x + c*y + e, b*x + d*y + f),
+// where the matrix is [a b c d e f].
+type matrix [6]float64
+
+// The identity transformation
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// Returns the transformation which applies o, then m
+func (m matrix) mul(o matrix) matrix {
+	return matrix{
+		m[0]*o[0] + m[2]*o[1],
+		m[1]*o[0] + m[3]*o[1],
+		m[0]*o[2] + m[2]*o[3],
+		m[1]*o[2] + m[3]*o[3],
+		m[0]*o[4] + m[2]*o[5] + m[4],
+		m[1]*o[4] + m[3]*o[5] + m[5],
+	}
+}
+
+// Transforms a point
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// Returns the mean scaling factor of the transformation
+func (m matrix) scaleFactor() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// Parses an SVG transform list, such as "scale(2) translate(10 20)".  The matrix,
+// translate and scale transforms are supported.  An empty list is the identity
+// transformation.
+func parseTransform(s string) (matrix, error) {
+	m := identityMatrix
+
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		start := strings.IndexByte(rest, '(')
+		end := strings.IndexByte(rest, ')')
+		if start < 0 || end < start {
+			return m, fmt.Errorf("transform: malformed transform list '%s'", s)
+		}
+
+		name := strings.TrimSpace(rest[:start])
+		var args []float64
+		for _, a := range strings.FieldsFunc(rest[start+1:end], isListSeparator) {
+			v, err := strconv.ParseFloat(a, 64)
+			if err != nil {
+				return m, fmt.Errorf("transform: bad number '%s'", a)
+			}
+			args = append(args, v)
+		}
+
+		switch {
+		case name == "matrix" && len(args) == 6:
+			m = m.mul(matrix{args[0], args[1], args[2], args[3], args[4], args[5]})
+		case name == "translate" && len(args) == 1:
+			m = m.mul(matrix{1, 0, 0, 1, args[0], 0})
+		case name == "translate" && len(args) == 2:
+			m = m.mul(matrix{1, 0, 0, 1, args[0], args[1]})
+		case name == "scale" && len(args) == 1:
+			m = m.mul(matrix{args[0], 0, 0, args[0], 0, 0})
+		case name == "scale" && len(args) == 2:
+			m = m.mul(matrix{args[0], 0, 0, args[1], 0, 0})
+		default:
+			return m, fmt.Errorf("transform: unsupported transform '%s'", rest[:end+1])
+		}
+
+		rest = strings.TrimLeft(rest[end+1:], " \t\n,")
+	}
+
+	return m, nil
+}
@@ -8,3 +8,21 @@ func maxInt(x, y int) int {
 		return y
 	}
 }
+
+// Returns the minimum of two integer.
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	} else {
+		return y
+	}
+}
+
+// Returns the absolute value of an integer.
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	} else {
+		return x
+	}
+}
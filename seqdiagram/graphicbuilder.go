@@ -4,6 +4,8 @@ import (
 	"errors"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/lmika/goseq/seqdiagram/graphbox"
 )
@@ -14,12 +16,23 @@ const (
 	posObjectY     = 1
 )
 
+// The height of a diagram with no items, for styles which do not set one
+const defaultEmptyDiagramHeight = 64
+
 var graphboxArrowStemMapping = map[ArrowStem]graphbox.ActivityArrowStem{
 	SolidArrowStem:  graphbox.SolidArrowStem,
 	DashedArrowStem: graphbox.DashedArrowStem,
 	ThickArrowStem:  graphbox.ThickArrowStem,
 }
 
+var graphboxNoteShapeMapping = map[NoteShape]graphbox.NoteShape{
+	RectNoteShape:    graphbox.RectNoteShape,
+	FoldedNoteShape:  graphbox.FoldedNoteShape,
+	RoundedNoteShape: graphbox.RoundedNoteShape,
+	HexagonNoteShape: graphbox.HexagonNoteShape,
+	CloudNoteShape:   graphbox.CloudNoteShape,
+}
+
 // Load the internal font
 func mustLoadFont() *graphbox.TTFFont {
 	font, err := loadInternalFont(dejaVuSansFont)
@@ -40,16 +53,79 @@ type actorInfo struct {
 	Col int
 }
 
+// An activation which has been started but not yet ended
+type openActivation struct {
+	// The row the activation started on
+	Row int
+
+	// Vertical offset of the start of the activation bar from the row
+	StartOffset int
+}
+
+// An activation bar waiting to be placed underneath the other items
+type pendingActivationBar struct {
+	Row, Col int
+	Bar      *graphbox.ActivationBar
+}
+
+// The fill of a block waiting to be placed underneath the lifelines
+type pendingBlockBackground struct {
+	Row, Col   int
+	Depth      int
+	Background graphbox.GraphboxItem
+}
+
+// A box drawn for an actor, such as an actor box or actor icon
+type actorBoxItem interface {
+	graphbox.GraphboxItem
+
+	Size() (width, height int)
+}
+
 type graphicBuilder struct {
 	Diagram *Diagram
 	Graphic *graphbox.Graphic
 	Style   *DiagramStyles
 
 	actorInfos []actorInfo
+
+	// Activations which are still open, by actor
+	openActivations map[*Actor][]openActivation
+
+	// Activation bars to place underneath the other items
+	activationBars []pendingActivationBar
+
+	// Block fills to place underneath the lifelines
+	blockBackgrounds []pendingBlockBackground
+
+	// The last action placed, the row it was placed on and its activity line
+	lastAction       *Action
+	lastActionRow    int
+	lastActivityLine *graphbox.ActivityLine
+
+	// The rows actors are created and destroyed on
+	createdRows   map[*Actor]int
+	destroyedRows map[*Actor]int
+
+	// Rows reserved for delayed actions which have no items
+	reservedRows []int
+
+	// The automatic numbering of actions.  The numbers are the last number used at each
+	// level of nested blocks.
+	autoNumber       *AutoNumber
+	numbers          []int
+	numberingStopped bool
 }
 
 func newGraphicBuilder(d *Diagram, style *DiagramStyles) (*graphicBuilder, error) {
-	return &graphicBuilder{d, nil, style, nil}, nil
+	return &graphicBuilder{
+		Diagram:         d,
+		Style:           style,
+		openActivations: make(map[*Actor][]openActivation),
+		createdRows:     make(map[*Actor]int),
+		destroyedRows:   make(map[*Actor]int),
+		numbers:         []int{0},
+	}, nil
 }
 
 func (gb *graphicBuilder) buildGraphic() *graphbox.Graphic {
@@ -59,15 +135,24 @@ func (gb *graphicBuilder) buildGraphic() *graphbox.Graphic {
 	gb.Graphic.Margin = gb.Style.Margin
 	gb.Graphic.ShowGrid = false
 
-	gb.addActors()
-
 	if len(gb.Diagram.Items) == 0 {
-		gb.Graphic.Put(2, 0, &graphbox.Spacer{Margin: graphbox.Point{X: 0, Y: 64}})
+		height := gb.Style.EmptyDiagramHeight
+		if height == 0 {
+			height = defaultEmptyDiagramHeight
+		}
+		gb.Graphic.Put(2, 0, &graphbox.Spacer{Margin: graphbox.Point{X: 0, Y: height}})
 	} else {
 		row := 2
 		gb.putItemsInSlice(&row, 0, gb.Diagram.Items)
+		gb.putReservedRows()
 	}
 
+	// The actors are added once the items are placed, as the items determine where the
+	// lifelines of created and destroyed actors start and end
+	itemCount := gb.Graphic.ItemCount()
+	gb.addActors()
+	gb.putActivationBars(gb.Graphic.ItemCount() - itemCount)
+
 	// Add a title
 	if gb.Diagram.Title != "" {
 		gb.Graphic.Put(0, 0, graphbox.NewTitle(cols, gb.Diagram.Title, gb.Style.Title))
@@ -76,29 +161,66 @@ func (gb *graphicBuilder) buildGraphic() *graphbox.Graphic {
 	return gb.Graphic
 }
 
-// Place items in a slice.  This will update the rows pointer
+// Place items in a slice.  This will update the rows pointer.  The items following a
+// delayed action are placed in the rows it spans, and any rows it spans beyond the last
+// item are reserved.
 func (gb *graphicBuilder) putItemsInSlice(row *int, depth int, items []SequenceItem) {
+	endRow := *row
 	for _, item := range items {
 		switch itemDetails := item.(type) {
 		case *Action:
 			gb.putAction(*row, itemDetails)
+			endRow = maxInt(endRow, *row+itemDetails.Delay+1)
 		case *Note:
 			gb.putNote(*row, itemDetails)
+		case *Ref:
+			gb.putRef(*row, itemDetails)
 		case *Divider:
 			gb.putDivider(*row, itemDetails)
 		case *Block:
 			gb.putBlock(row, depth, itemDetails)
+		case *Activation:
+			// Activations are drawn against the rows of the other items
+			gb.putActivation(*row, itemDetails)
+			continue
+		case *Creation:
+			gb.putCreation(*row, itemDetails)
+			continue
+		case *Destruction:
+			gb.putDestruction(*row, itemDetails)
+			continue
+		case *AutoNumber:
+			gb.putAutoNumber(itemDetails)
+			continue
 		}
 
 		*row += 1
 	}
+
+	for ; *row < endRow; *row++ {
+		gb.reservedRows = append(gb.reservedRows, *row)
+	}
+}
+
+// Places spacers in the rows reserved for delayed actions, so that the actions slope down
+// to the row they arrive on.  These are placed after the other items, so that the height
+// of the spacers does not add to the height of the items in the following rows.
+func (gb *graphicBuilder) putReservedRows() {
+	for _, row := range gb.reservedRows {
+		gb.Graphic.Put(row, 0, &graphbox.Spacer{Margin: graphbox.Point{X: 0, Y: gb.Style.DelayRowHeight * 2}})
+	}
 }
 
 // Calculate rows in slice
 func (gb *graphicBuilder) calcItemsInSlice(items []SequenceItem) int {
-	rows := 0
+	rows, endRows := 0, 0
 	for _, item := range items {
 		switch itemDetails := item.(type) {
+		case *Activation, *Creation, *Destruction, *AutoNumber:
+			// Does not require a row
+		case *Action:
+			endRows = maxInt(endRows, rows+itemDetails.Delay+1)
+			rows++
 		case *Block:
 			if itemDetails.Concurrent() {
 				maxRows := 0
@@ -119,7 +241,7 @@ func (gb *graphicBuilder) calcItemsInSlice(items []SequenceItem) int {
 			rows++
 		}
 	}
-	return rows
+	return maxInt(rows, endRows)
 }
 
 // Places a note
@@ -159,7 +281,11 @@ func (gb *graphicBuilder) putSingleActorNote(row int, actor *Actor, note *Note)
 	}
 
 	col := gb.colOfActor(actor)
-	gb.Graphic.Put(row, col, graphbox.NewNoteBox(note.Message, gb.Style.NoteBox, pos))
+	style := gb.Style.NoteBox
+	style.Shape = graphboxNoteShapeMapping[note.Shape]
+	style.Color, style.BorderColor, style.TextColor = note.Color, note.BorderColor, note.TextColor
+
+	gb.Graphic.Put(row, col, graphbox.NewNoteBox(note.Message, style, pos))
 }
 
 // Places a note over a multiple actors.  This actually uses the divider graphics object
@@ -171,8 +297,12 @@ func (gb *graphicBuilder) putMultiActorOverNote(row int, leftActor, rightActor *
 		Padding:     gb.Style.NoteBox.Padding,
 		Margin:      gb.Style.NoteBox.Margin,
 		TextPadding: graphbox.Point{X: 0, Y: 0},
-		Shape:       graphbox.DSFramedRect,
+		Shape:       graphbox.DSNoteFrame,
 		Overlap:     gb.Style.MultiNoteOverlap,
+		NoteShape:   graphboxNoteShapeMapping[note.Shape],
+		Color:       note.Color,
+		BorderColor: note.BorderColor,
+		TextColor:   note.TextColor,
 	}
 
 	fromCol := gb.colOfActor(leftActor)
@@ -190,17 +320,267 @@ func (gb *graphicBuilder) putMultiActorOverNote(row int, leftActor, rightActor *
 	gb.Graphic.Put(row, fromCol, graphbox.NewDivider(toCol, note.Message, dividerBox))
 }
 
+// Places a reference over the lifelines of its actors
+func (gb *graphicBuilder) putRef(row int, ref *Ref) {
+	fromCol, toCol := gb.colOfActor(ref.Actor1), gb.colOfActor(ref.Actor2)
+	if fromCol > toCol {
+		fromCol, toCol = toCol, fromCol
+	}
+
+	gb.Graphic.Put(row, fromCol, graphbox.NewRef(toCol, ref.Message, ref.Link, gb.Style.Block))
+}
+
 // Places an action
 func (gb *graphicBuilder) putAction(row int, action *Action) {
-	fromCol := gb.colOfActor(action.From)
-	toCol := gb.colOfActor(action.To)
+	fromCol, toCol := gb.actionCols(action)
 
 	style := gb.Style.ActivityLine
 
 	style.ArrowHead = gb.Style.ArrowHeads[action.Arrow.Head] // graphboxArrowHeadMapping[action.Arrow.Head]
 	style.ArrowStem = graphboxArrowStemMapping[action.Arrow.Stem]
+	if action.Arrow.TailHead {
+		style.TailArrowHead = style.ArrowHead
+	}
+	style.Color, style.TextColor, style.Width = action.Color, action.TextColor, action.Width
+
+	// Found lines are placed at the lifeline of the receiving actor
+	col := fromCol
+	var activityLine *graphbox.ActivityLine
+	switch {
+	case action.To == LostActor:
+		activityLine = graphbox.NewEndpointActivityLine(graphbox.LostEndpoint, action.Message, style)
+	case action.From == FoundActor:
+		activityLine = graphbox.NewEndpointActivityLine(graphbox.FoundEndpoint, action.Message, style)
+		col = toCol
+	default:
+		activityLine = graphbox.NewActivityLine(toCol, fromCol == toCol, action.Message, style)
+		if action.Delay > 0 {
+			activityLine.TR = row + action.Delay
+		}
+	}
+	activityLine.StartOffset = gb.activationEdge(gb.activationsAt(action.From, row), toCol >= fromCol)
+	activityLine.EndOffset = gb.activationEdge(gb.activationsAt(action.To, row+action.Delay), toCol <= fromCol)
+
+	// An action to an actor being created points to the side of the actor box, unless it
+	// arrives after the actor box
+	if gb.isCreatedOn(action.To, row) && action.To.InHeader && fromCol != toCol && action.Delay == 0 {
+		width, _ := gb.actorBox(action.To, graphbox.TopActorBox).Size()
+		edge := width/2 + gb.Style.ActorBox.ArrowGap
+		if toCol > fromCol {
+			activityLine.EndOffset = -edge
+		} else {
+			activityLine.EndOffset = edge
+		}
+	}
+	if number := gb.nextNumber(); number != "" {
+		activityLine.SetNumber(number)
+	}
+	gb.Graphic.Put(row, col, activityLine)
+
+	gb.lastAction, gb.lastActionRow, gb.lastActivityLine = action, row, activityLine
+}
+
+// Starts or ends an activation.  Activations start and end at the row of the previous
+// item, so that an activation following an action starts where the arrow meets the
+// lifeline.
+func (gb *graphicBuilder) putActivation(row int, activation *Activation) {
+	actor := activation.Actor
+	activationRow := maxInt(row-1, posObjectY+1)
+	activations := gb.openActivations[actor]
+
+	switch activation.Type {
+	case StartActivation:
+		startOffset := 0
+
+		// The activation of an actor receiving a delayed action starts where it arrives
+		if gb.lastAction != nil && gb.lastAction.To == actor && gb.lastActionRow == row-1 {
+			activationRow += gb.lastAction.Delay
+		}
+
+		// The bar of an actor created on the same row starts below the actor box
+		if gb.isCreatedOn(actor, activationRow) && actor.InHeader {
+			_, height := gb.actorBox(actor, graphbox.TopActorBox).Size()
+			startOffset = height/2 + gb.Style.ActorBox.Margin.Y
+		}
+
+		// Point an action to the actor at the new activation bar.  The bar of a self
+		// reference starts where the arrow returns to the lifeline.  Actions creating the
+		// actor continue to point to the actor box.
+		if gb.lastAction != nil && gb.lastAction.To == actor && gb.lastActionRow == row-1 && !gb.isCreatedOn(actor, row-1) {
+			fromCol, toCol := gb.actionCols(gb.lastAction)
+			gb.lastActivityLine.EndOffset = gb.activationEdge(len(activations)+1, toCol <= fromCol)
+
+			if gb.lastAction.From == actor {
+				startOffset = gb.Style.ActivityLine.SelfRefHeight
+			}
+		}
+
+		gb.openActivations[actor] = append(activations, openActivation{activationRow, startOffset})
+	case EndActivation:
+		if len(activations) == 0 {
+			return
+		}
+
+		// A self reference returns to the activation bar underneath the one being ended
+		if gb.lastAction != nil && gb.lastAction.From == actor && gb.lastAction.To == actor && gb.lastActionRow == row-1 {
+			gb.lastActivityLine.EndOffset = gb.activationEdge(len(activations)-1, true)
+		}
+
+		gb.endActivation(actor, activationRow)
+	}
+}
+
+// Records the row an actor is created on, which is the row of the next item
+func (gb *graphicBuilder) putCreation(row int, creation *Creation) {
+	if _, isCreated := gb.createdRows[creation.Actor]; !isCreated {
+		gb.createdRows[creation.Actor] = maxInt(minInt(row, gb.Graphic.Rows()-2), posObjectY)
+	}
+}
+
+// Records the row an actor is destroyed on, which is the row of the previous item.  Any
+// activations of the actor are ended there.
+func (gb *graphicBuilder) putDestruction(row int, destruction *Destruction) {
+	actor := destruction.Actor
+	if _, isDestroyed := gb.destroyedRows[actor]; isDestroyed {
+		return
+	}
+
+	// An actor destroyed by a delayed action is destroyed where the action arrives
+	destroyedRow := maxInt(row-1, posObjectY+1)
+	destroyedByLastAction := gb.lastAction != nil && gb.lastAction.To == actor && gb.lastAction.From != actor && gb.lastActionRow == destroyedRow
+	if destroyedByLastAction {
+		destroyedRow += gb.lastAction.Delay
+	}
+
+	for len(gb.openActivations[actor]) > 0 {
+		gb.endActivation(actor, destroyedRow)
+	}
+	gb.destroyedRows[actor] = destroyedRow
+
+	// Point an action destroying the actor at the side of the cross
+	if destroyedByLastAction {
+		if fromCol, toCol := gb.actionCols(gb.lastAction); toCol > fromCol {
+			gb.lastActivityLine.EndOffset = -gb.Style.LifeLine.CrossSize
+		} else {
+			gb.lastActivityLine.EndOffset = gb.Style.LifeLine.CrossSize
+		}
+	}
+}
+
+// Returns true if the actor is created on the given row
+func (gb *graphicBuilder) isCreatedOn(actor *Actor, row int) bool {
+	createdRow, isCreated := gb.createdRows[actor]
+	return isCreated && createdRow == row
+}
+
+// Ends the most recent activation of an actor at the given row
+func (gb *graphicBuilder) endActivation(actor *Actor, row int) {
+	activations := gb.openActivations[actor]
+	depth := len(activations) - 1
+	activation := activations[depth]
+	gb.openActivations[actor] = activations[:depth]
+
+	style := gb.Style.ActivationBar
+	style.Color = actor.Color
+
+	gb.activationBars = append(gb.activationBars, pendingActivationBar{
+		Row: activation.Row,
+		Col: gb.colOfActor(actor),
+		Bar: graphbox.NewActivationBar(row, depth, activation.StartOffset, style),
+	})
+}
+
+// Places the activation bars before the item at the given index, which will draw them
+// over the lifelines but underneath the other items.  Activations which are not ended
+// are ended at the last item.  Nested bars are placed after the bars they are stacked on.
+func (gb *graphicBuilder) putActivationBars(index int) {
+	lastItemRow := gb.Graphic.Rows() - 2
+	for _, actor := range gb.Diagram.Actors {
+		for len(gb.openActivations[actor]) > 0 {
+			gb.endActivation(actor, lastItemRow)
+		}
+	}
+
+	sort.SliceStable(gb.activationBars, func(i, j int) bool {
+		return gb.activationBars[i].Bar.Depth < gb.activationBars[j].Bar.Depth
+	})
+	for i, bar := range gb.activationBars {
+		gb.Graphic.PutBefore(index+i, bar.Row, bar.Col, bar.Bar)
+	}
+}
+
+// Returns the number of open activations of an actor which have started by the given row.
+// Activations started by a delayed action start after the rows of the actions following it.
+func (gb *graphicBuilder) activationsAt(actor *Actor, row int) int {
+	count := 0
+	for _, activation := range gb.openActivations[actor] {
+		if activation.Row <= row {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns the horizontal offset from the lifeline of the side of the topmost of the given
+// number of activation bars.  This is the side facing right if towardsRight is true.
+func (gb *graphicBuilder) activationEdge(activations int, towardsRight bool) int {
+	if activations == 0 {
+		return 0
+	}
+
+	style := gb.Style.ActivationBar
+	centre := (activations - 1) * style.NestOffset
+	if towardsRight {
+		return centre + style.Width/2 + style.ArrowGap
+	}
+	return centre - style.Width/2 - style.ArrowGap
+}
+
+// Starts, stops or resumes the automatic numbering of actions.  Starting numbering within
+// a nested block restarts the numbering of the block.
+func (gb *graphicBuilder) putAutoNumber(autoNumber *AutoNumber) {
+	switch autoNumber.Type {
+	case StartAutoNumber:
+		gb.autoNumber, gb.numberingStopped = autoNumber, false
+		gb.numbers[len(gb.numbers)-1] = autoNumber.Start - gb.numberStep()
+	case StopAutoNumber:
+		gb.numberingStopped = true
+	case ResumeAutoNumber:
+		if gb.autoNumber == nil {
+			gb.putAutoNumber(&AutoNumber{Type: StartAutoNumber, Start: 1, Step: 1})
+		}
+		gb.numberingStopped = false
+	}
+}
 
-	gb.Graphic.Put(row, fromCol, graphbox.NewActivityLine(toCol, fromCol == toCol, action.Message, style))
+// Returns the next number of an action, or an empty string if actions are not being
+// numbered
+func (gb *graphicBuilder) nextNumber() string {
+	if gb.autoNumber == nil || gb.numberingStopped {
+		return ""
+	}
+
+	gb.numbers[len(gb.numbers)-1] += gb.numberStep()
+
+	parts := make([]string, len(gb.numbers))
+	for i, n := range gb.numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	number := strings.Join(parts, ".")
+
+	if gb.autoNumber.Format == "" {
+		return number
+	}
+	return strings.ReplaceAll(gb.autoNumber.Format, "#", number)
+}
+
+// Returns the amount to increase the current number by.  Numbers within nested blocks
+// always increase by one.
+func (gb *graphicBuilder) numberStep() int {
+	if len(gb.numbers) > 1 {
+		return 1
+	}
+	return gb.autoNumber.Step
 }
 
 // Places a divider
@@ -208,17 +588,30 @@ func (gb *graphicBuilder) putDivider(row int, action *Divider) {
 	fromCol := 0
 	toCol := gb.Graphic.Cols() - 1
 	style := gb.Style.Divider[action.Type]
+	style.BorderColor, style.TextColor = action.Color, action.TextColor
 
 	gb.Graphic.Put(row, fromCol, graphbox.NewDivider(toCol, action.Message, style))
 }
 
 // Places a block
 func (gb *graphicBuilder) putBlock(row *int, depth int, action *Block) {
+	// With nested numbering, the block takes the next number and the actions within it
+	// are numbered beneath it
+	nested := gb.autoNumber != nil && gb.autoNumber.Nested && !gb.numberingStopped
+	if nested {
+		gb.nextNumber()
+		gb.numbers = append(gb.numbers, 0)
+	}
+
 	if action.Concurrent() {
 		gb.putBlockSegmentsConcurrently(row, depth, action)
 	} else {
 		gb.putBlockSegmentsSequentially(row, depth, action)
 	}
+
+	if nested {
+		gb.numbers = gb.numbers[:len(gb.numbers)-1]
+	}
 }
 
 func (gb *graphicBuilder) putBlockSegmentsConcurrently(row *int, depth int, action *Block) {
@@ -240,11 +633,21 @@ func getInnerRanksRecursive(subItems []SequenceItem) []int {
 	for _, subItem := range subItems {
 		switch s := subItem.(type) {
 		case *Action:
-			if s.From.rank == s.To.rank {
+			if s.To == LostActor {
+				ranks = append(ranks, s.From.rank, s.From.rank+1)
+			} else if s.From == FoundActor {
+				ranks = append(ranks, s.To.rank-1, s.To.rank)
+			} else if s.From.rank == s.To.rank {
 				ranks = append(ranks, s.From.rank, s.To.rank+1)
 			} else {
 				ranks = append(ranks, s.From.rank, s.To.rank)
 			}
+		case *Ref:
+			if s.Actor1 == s.Actor2 {
+				ranks = append(ranks, s.Actor1.rank, s.Actor1.rank+1)
+			} else {
+				ranks = append(ranks, s.Actor1.rank, s.Actor2.rank)
+			}
 		case *Block:
 			for _, segment := range s.Segments {
 				ranks = append(ranks, getInnerRanksRecursive(segment.SubItems)...)
@@ -280,8 +683,6 @@ func (gb *graphicBuilder) getStartAndEndColsBasedOnContent(subItems []SequenceIt
 }
 
 func (gb *graphicBuilder) putBlockSegmentsSequentially(row *int, depth int, action *Block) {
-	style := gb.Style.Block
-
 	var startRow, endRow int
 	startRow = *row
 	nestDepth := action.MaxNestDepth()
@@ -334,17 +735,38 @@ func (gb *graphicBuilder) putBlockSegmentsSequentially(row *int, depth int, acti
 			segPrefix = "opt"
 		case LoopSegmentType:
 			segPrefix = "loop"
+		case CriticalSegmentType:
+			segPrefix = "critical"
+		case BreakSegmentType:
+			segPrefix = "break"
+		case NegSegmentType:
+			segPrefix = "neg"
+		case IgnoreSegmentType:
+			segPrefix = "ignore"
+		case ConsiderSegmentType:
+			segPrefix = "consider"
+		case AssertSegmentType:
+			segPrefix = "assert"
+		case StrictSegmentType:
+			segPrefix = "strict"
+		case SeqSegmentType:
+			segPrefix = "seq"
 		case EmptySegmentType:
 			showPrefix = false
 		}
 
+		if len(seg.Messages) > 0 {
+			segPrefix += " {" + strings.Join(seg.Messages, ", ") + "}"
+		}
+
 		if seg.Prefix != "" {
 			segPrefix = seg.Prefix
 		}
 
 		block := graphbox.NewBlock(endRow, endCol, nestDepth, i == len(action.Segments)-1,
-			segPrefix, showPrefix, seg.Message, style)
+			segPrefix, showPrefix, seg.Message, gb.blockStyle(depth, seg))
 		gb.Graphic.Put(startRow, startCol, block)
+		gb.blockBackgrounds = append(gb.blockBackgrounds, pendingBlockBackground{startRow, startCol, depth, block.Background()})
 
 		startRow = endRow
 	}
@@ -389,61 +811,134 @@ func (gb *graphicBuilder) determineActorInfo() int {
 	return cols
 }
 
-// Add the object headers and footers
+// Add the object headers and footers.  These are placed before the other items.
 func (gb *graphicBuilder) addActors() {
 	// TODO: Proper styling
 	bottomRow := gb.Graphic.Rows() - 1
-	for rank, actor := range gb.Diagram.Actors {
-		var actorBoxPos graphbox.ActorBoxPos
-
-		switch rank {
-		case 0:
-			actorBoxPos = graphbox.LeftActorBox
-		case len(gb.Diagram.Actors) - 1:
-			actorBoxPos = graphbox.RightActorBox
-		default:
-			actorBoxPos = graphbox.MiddleActorBox
+	index := 0
+
+	put := func(row, col int, item graphbox.GraphboxItem) {
+		gb.Graphic.PutBefore(index, row, col, item)
+		index++
+	}
+
+	// Groups are placed first so that they are drawn behind the actors
+	for _, group := range gb.Diagram.Groups {
+		first, last := group.Actors[0], group.Actors[len(group.Actors)-1]
+		groupBox := graphbox.NewActorGroupBox(bottomRow, gb.colOfActor(last), group.Label, group.Color, gb.Style.ActorGroup)
+		firstWidth, _ := gb.actorBoxSize(first)
+		lastWidth, _ := gb.actorBoxSize(last)
+		groupBox.Left, groupBox.Right = firstWidth/2, lastWidth-lastWidth/2
+
+		for _, actor := range group.Actors {
+			_, height := gb.actorBoxSize(actor)
+			if actor.InHeader {
+				groupBox.Top = maxInt(groupBox.Top, height/2)
+			}
+			if actor.InFooter {
+				groupBox.Bottom = maxInt(groupBox.Bottom, height/2)
+			}
 		}
 
+		put(posObjectY, gb.colOfActor(first), groupBox)
+	}
+
+	// Block fills are placed over the groups but underneath the lifelines.  Blocks are
+	// placed after the blocks nested within them, so outer blocks are drawn first.
+	sort.SliceStable(gb.blockBackgrounds, func(i, j int) bool {
+		return gb.blockBackgrounds[i].Depth < gb.blockBackgrounds[j].Depth
+	})
+	for _, bg := range gb.blockBackgrounds {
+		put(bg.Row, bg.Col, bg.Background)
+	}
+
+	for _, actor := range gb.Diagram.Actors {
 		col := gb.colOfActor(actor)
 
-		if actor.Lifeline {
-			gb.Graphic.Put(posObjectY, col, &graphbox.LifeLine{
-				TR: bottomRow,
-				TC: col,
-				Style: graphbox.LifeLineStyle{
-					Color: actor.Color,
-				},
-			})
+		headerRow := posObjectY
+		if createdRow, isCreated := gb.createdRows[actor]; isCreated {
+			headerRow = createdRow
 		}
+		destroyedRow, isDestroyed := gb.destroyedRows[actor]
 
-		if actor.Icon != nil {
-			actorIconStyle := gb.Style.ActorIconBox
-			actorIconStyle.Color = actor.Color
-			actorIconStyle.TextColor = actor.TextColor
-
-			if actor.InHeader {
-				gb.Graphic.Put(posObjectY, col, graphbox.NewActorIconBox(actor.Label, actor.Icon.graphboxIcon(), actorIconStyle, actorBoxPos|graphbox.TopActorBox))
+		if actor.Lifeline {
+			lifeline := &graphbox.LifeLine{TR: bottomRow, TC: col, Style: gb.Style.LifeLine}
+			lifeline.Style.Color = actor.Color
+			if isDestroyed {
+				lifeline.TR, lifeline.Destroyed = destroyedRow, true
 			}
-		} else {
-			// Configure the style
-			actorStyle := gb.Style.ActorBox
-			actorStyle.Color = actor.Color
-			actorStyle.TextColor = actor.TextColor
 
+			put(headerRow, col, lifeline)
+		}
+
+		if actor.InHeader {
+			put(headerRow, col, gb.actorBox(actor, graphbox.TopActorBox))
+		}
+
+		// Actors drawn as icons and destroyed actors have no footer
+		if actor.InFooter && !isDestroyed && (actor.Icon == nil || gb.Style.ActorIconsAsBoxes) {
 			if actor.InHeader {
-				gb.Graphic.Put(posObjectY, col, graphbox.NewActorBox(actor.Label, actorStyle, actorBoxPos|graphbox.TopActorBox))
-				if actor.InFooter {
-					gb.Graphic.Put(bottomRow, col, graphbox.NewActorBox(actor.Label, actorStyle, actorBoxPos|graphbox.BottomActorBox))
-				}
-			} else if actor.InFooter {
+				put(bottomRow, col, gb.actorBox(actor, graphbox.BottomActorBox))
+			} else {
 				// Use the TopActorBox as that performs the layout
-				gb.Graphic.Put(bottomRow, col, graphbox.NewActorBox(actor.Label, actorStyle, actorBoxPos|graphbox.TopActorBox))
+				put(bottomRow, col, gb.actorBox(actor, graphbox.TopActorBox))
 			}
 		}
 	}
 }
 
+// Returns the size of the box drawn for an actor, or zero if the actor has no box
+func (gb *graphicBuilder) actorBoxSize(actor *Actor) (width, height int) {
+	if !actor.InHeader && !actor.InFooter {
+		return 0, 0
+	}
+	return gb.actorBox(actor, graphbox.TopActorBox).Size()
+}
+
+// Returns the box to draw for an actor at the top or bottom of the lifeline
+func (gb *graphicBuilder) actorBox(actor *Actor, vertPos graphbox.ActorBoxPos) actorBoxItem {
+	var actorBoxPos graphbox.ActorBoxPos
+
+	switch actor.rank {
+	case 0:
+		actorBoxPos = graphbox.LeftActorBox
+	case len(gb.Diagram.Actors) - 1:
+		actorBoxPos = graphbox.RightActorBox
+	default:
+		actorBoxPos = graphbox.MiddleActorBox
+	}
+
+	if actor.Icon != nil && !gb.Style.ActorIconsAsBoxes {
+		actorIconStyle := gb.Style.ActorIconBox
+		actorIconStyle.Color = actor.Color
+		actorIconStyle.TextColor = actor.TextColor
+
+		return graphbox.NewActorIconBox(actor.Label, actor.Icon.graphboxIcon(), actorIconStyle, actorBoxPos|vertPos)
+	}
+
+	// Configure the style
+	actorStyle := gb.Style.ActorBox
+	actorStyle.Color = actor.Color
+	actorStyle.TextColor = actor.TextColor
+
+	return graphbox.NewActorBox(actor.Label, actorStyle, actorBoxPos|vertPos)
+}
+
+// Returns the columns of the actors sending and receiving an action.  Lost actions end
+// at the column to the right of the sending actor, and found actions start at the column
+// to the left of the receiving actor.
+func (gb *graphicBuilder) actionCols(action *Action) (fromCol, toCol int) {
+	switch {
+	case action.To == LostActor:
+		fromCol = gb.colOfActor(action.From)
+		return fromCol, fromCol + 1
+	case action.From == FoundActor:
+		toCol = gb.colOfActor(action.To)
+		return toCol - 1, toCol
+	}
+	return gb.colOfActor(action.From), gb.colOfActor(action.To)
+}
+
 // Returns the column position of an actor
 func (gb *graphicBuilder) colOfActor(actor *Actor) int {
 	switch actor {
@@ -455,3 +950,31 @@ func (gb *graphicBuilder) colOfActor(actor *Actor) int {
 		return gb.actorInfos[actor.rank].Col
 	}
 }
+
+// Returns the style of a block segment.  Nested blocks which are not given a colour are
+// filled with the nested colour of the diagram style and white at alternating depths.
+func (gb *graphicBuilder) blockStyle(depth int, seg *BlockSegment) graphbox.BlockStyle {
+	style := gb.Style.Block
+	style.Color, style.BorderColor, style.TabColor = seg.Color, seg.BorderColor, seg.TabColor
+	if gb.Style.UnfilledBlocks {
+		style.Color = ""
+	} else if style.Color == "" && depth > 0 && style.NestedColor != "" {
+		if depth%2 == 1 {
+			style.Color = style.NestedColor
+		} else {
+			style.Color = "white"
+		}
+	}
+
+	switch seg.LineStyle {
+	case DottedBlockLine:
+		style.Dashes = []int{2, 4}
+	case SolidBlockLine:
+		style.Dashes = nil
+	}
+
+	if seg.FontSize > 0 {
+		style.FontSize = seg.FontSize
+	}
+	return style
+}
@@ -0,0 +1,652 @@
+package seqdiagram
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The JSON encoding of a diagram.  The format is described by the schema in
+// docs/diagram.schema.json.
+
+var jsonArrowStems = map[ArrowStem]string{
+	SolidArrowStem:  "solid",
+	DashedArrowStem: "dashed",
+	ThickArrowStem:  "thick",
+}
+
+var jsonArrowHeads = map[ArrowHead]string{
+	SolidArrowHead:     "solid",
+	OpenArrowHead:      "open",
+	BarbArrowHead:      "barb",
+	LowerBarbArrowHead: "lowerBarb",
+}
+
+// Activations are encoded as items with these types
+var jsonActivationTypes = map[ActivationType]string{
+	StartActivation: "activate",
+	EndActivation:   "deactivate",
+}
+
+// Changes to the automatic numbering are encoded as items with these types
+var jsonAutoNumberTypes = map[AutoNumberType]string{
+	StartAutoNumber:  "autonumber",
+	StopAutoNumber:   "stopAutonumber",
+	ResumeAutoNumber: "resumeAutonumber",
+}
+
+var jsonNoteAlignments = map[NoteAlignment]string{
+	LeftNoteAlignment:  "left",
+	RightNoteAlignment: "right",
+	OverNoteAlignment:  "over",
+}
+
+var jsonNoteShapes = map[NoteShape]string{
+	RectNoteShape:    "rect",
+	FoldedNoteShape:  "note",
+	RoundedNoteShape: "rounded",
+	HexagonNoteShape: "hexagon",
+	CloudNoteShape:   "cloud",
+}
+
+var jsonBlockLineStyles = map[BlockLineStyle]string{
+	DashedBlockLine: "dashed",
+	DottedBlockLine: "dotted",
+	SolidBlockLine:  "solid",
+}
+
+var jsonDividerTypes = map[DividerType]string{
+	DTSpacer: "spacer",
+	DTGap:    "gap",
+	DTFrame:  "frame",
+	DTLine:   "line",
+}
+
+var jsonSegmentTypes = map[SegmentType]string{
+	AltSegmentType:              "alt",
+	ElseSegmentType:             "else",
+	ParSegmentType:              "par",
+	ParElseSegmentType:          "parElse",
+	OptSegmentType:              "opt",
+	LoopSegmentType:             "loop",
+	ConcurrentSegmentType:       "concurrent",
+	ConcurrentWhilstSegmentType: "whilst",
+	CriticalSegmentType:         "critical",
+	BreakSegmentType:            "break",
+	NegSegmentType:              "neg",
+	IgnoreSegmentType:           "ignore",
+	ConsiderSegmentType:         "consider",
+	AssertSegmentType:           "assert",
+	StrictSegmentType:           "strict",
+	SeqSegmentType:              "seq",
+	EmptySegmentType:            "none",
+}
+
+// Actor references for the sides of the diagram and the ends of lost and found messages.
+// These start with the prefix, which is doubled in references to participants whose names
+// start with it, so that they cannot refer to a participant.
+const (
+	jsonPseudoActorPrefix = "@"
+	jsonLeftOffsideActor  = "@left"
+	jsonRightOffsideActor = "@right"
+	jsonLostActor         = "@lost"
+	jsonFoundActor        = "@found"
+)
+
+type jsonDiagram struct {
+	ProcessingInstructions []*jsonProcessingInstruction `json:"processingInstructions,omitempty"`
+	Title                  string                       `json:"title,omitempty"`
+	Actors                 []*jsonActor                 `json:"actors"`
+	Groups                 []*jsonGroup                 `json:"groups,omitempty"`
+	Items                  []*jsonItem                  `json:"items"`
+}
+
+type jsonProcessingInstruction struct {
+	Prefix string `json:"prefix"`
+	Value  string `json:"value"`
+}
+
+type jsonActor struct {
+	Name      string `json:"name"`
+	Label     string `json:"label,omitempty"`
+	Icon      string `json:"icon,omitempty"`
+	InHeader  bool   `json:"inHeader"`
+	InFooter  bool   `json:"inFooter"`
+	Lifeline  bool   `json:"lifeline"`
+	Color     string `json:"color,omitempty"`
+	TextColor string `json:"textColor,omitempty"`
+}
+
+// UnmarshalJSON decodes an actor, using the same defaults as a participant declaration
+// for any missing attributes.
+func (ja *jsonActor) UnmarshalJSON(data []byte) error {
+	type plainActor jsonActor
+
+	pa := plainActor{InHeader: true, InFooter: true, Lifeline: true, Color: "black"}
+	if err := json.Unmarshal(data, &pa); err != nil {
+		return err
+	}
+
+	if pa.Label == "" {
+		pa.Label = pa.Name
+	}
+	if pa.TextColor == "" {
+		pa.TextColor = pa.Color
+	}
+
+	*ja = jsonActor(pa)
+	return nil
+}
+
+type jsonGroup struct {
+	Label  string   `json:"label,omitempty"`
+	Color  string   `json:"color,omitempty"`
+	Actors []string `json:"actors"`
+}
+
+// A sequence item.  The type determines which of the other fields are used.
+type jsonItem struct {
+	Type string `json:"type"`
+
+	From  string     `json:"from,omitempty"`
+	To    string     `json:"to,omitempty"`
+	Arrow *jsonArrow `json:"arrow,omitempty"`
+	Delay int        `json:"delay,omitempty"`
+	Width int        `json:"width,omitempty"`
+
+	Color     string `json:"color,omitempty"`
+	TextColor string `json:"textColor,omitempty"`
+
+	Actor string `json:"actor,omitempty"`
+
+	Start  *int   `json:"start,omitempty"`
+	Step   *int   `json:"step,omitempty"`
+	Format string `json:"format,omitempty"`
+	Nested bool   `json:"nested,omitempty"`
+
+	Actor1 string `json:"actor1,omitempty"`
+	Actor2 string `json:"actor2,omitempty"`
+	Align  string `json:"align,omitempty"`
+
+	Shape       string `json:"shape,omitempty"`
+	BorderColor string `json:"borderColor,omitempty"`
+
+	Divider string `json:"divider,omitempty"`
+
+	Link string `json:"link,omitempty"`
+
+	Segments []*jsonSegment `json:"segments,omitempty"`
+
+	Message string `json:"message,omitempty"`
+}
+
+type jsonArrow struct {
+	Stem     string `json:"stem"`
+	Head     string `json:"head"`
+	TailHead bool   `json:"tailHead,omitempty"`
+}
+
+type jsonSegment struct {
+	Type      string   `json:"type"`
+	Prefix    string   `json:"prefix,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	FullWidth bool     `json:"fullWidth,omitempty"`
+	Messages  []string `json:"messages,omitempty"`
+
+	Color       string `json:"color,omitempty"`
+	BorderColor string `json:"borderColor,omitempty"`
+	TabColor    string `json:"tabColor,omitempty"`
+	LineStyle   string `json:"lineStyle,omitempty"`
+	FontSize    int    `json:"fontSize,omitempty"`
+
+	Items []*jsonItem `json:"items"`
+}
+
+// MarshalJSON encodes the diagram as JSON
+func (d *Diagram) MarshalJSON() ([]byte, error) {
+	jd := &jsonDiagram{
+		Title:  d.Title,
+		Actors: make([]*jsonActor, 0, len(d.Actors)),
+	}
+
+	for _, pi := range d.ProcessingInstructions {
+		jd.ProcessingInstructions = append(jd.ProcessingInstructions, &jsonProcessingInstruction{pi.Prefix, pi.Value})
+	}
+
+	for _, actor := range d.Actors {
+		ja := &jsonActor{
+			Name:      actor.Name,
+			Label:     actor.Label,
+			InHeader:  actor.InHeader,
+			InFooter:  actor.InFooter,
+			Lifeline:  actor.Lifeline,
+			Color:     actor.Color,
+			TextColor: actor.TextColor,
+		}
+		if actor.Icon != nil {
+			ja.Icon = actor.Icon.Name()
+		}
+		jd.Actors = append(jd.Actors, ja)
+	}
+
+	for _, group := range d.Groups {
+		jg := &jsonGroup{Label: group.Label, Color: group.Color, Actors: make([]string, 0, len(group.Actors))}
+		for _, actor := range group.Actors {
+			jg.Actors = append(jg.Actors, actor.Name)
+		}
+		jd.Groups = append(jd.Groups, jg)
+	}
+
+	items, err := itemsToJSON(d.Items)
+	if err != nil {
+		return nil, err
+	}
+	jd.Items = items
+
+	return json.Marshal(jd)
+}
+
+func itemsToJSON(items []SequenceItem) ([]*jsonItem, error) {
+	jsonItems := make([]*jsonItem, 0, len(items))
+	for _, item := range items {
+		ji, err := itemToJSON(item)
+		if err != nil {
+			return nil, err
+		}
+		jsonItems = append(jsonItems, ji)
+	}
+	return jsonItems, nil
+}
+
+func itemToJSON(item SequenceItem) (*jsonItem, error) {
+	switch it := item.(type) {
+	case *Action:
+		return &jsonItem{
+			Type:      "action",
+			From:      actorToJSON(it.From),
+			To:        actorToJSON(it.To),
+			Arrow:     &jsonArrow{jsonArrowStems[it.Arrow.Stem], jsonArrowHeads[it.Arrow.Head], it.Arrow.TailHead},
+			Delay:     it.Delay,
+			Width:     it.Width,
+			Color:     it.Color,
+			TextColor: it.TextColor,
+			Message:   it.Message,
+		}, nil
+	case *Activation:
+		return &jsonItem{
+			Type:  jsonActivationTypes[it.Type],
+			Actor: actorToJSON(it.Actor),
+		}, nil
+	case *Creation:
+		return &jsonItem{Type: "create", Actor: actorToJSON(it.Actor)}, nil
+	case *Destruction:
+		return &jsonItem{Type: "destroy", Actor: actorToJSON(it.Actor)}, nil
+	case *AutoNumber:
+		ji := &jsonItem{Type: jsonAutoNumberTypes[it.Type]}
+		if it.Type == StartAutoNumber {
+			start, step := it.Start, it.Step
+			ji.Start, ji.Step, ji.Format, ji.Nested = &start, &step, it.Format, it.Nested
+		}
+		return ji, nil
+	case *Note:
+		ji := &jsonItem{
+			Type:    "note",
+			Actor1:  actorToJSON(it.Actor1),
+			Align:   jsonNoteAlignments[it.Align],
+			Message: it.Message,
+
+			Color:       it.Color,
+			BorderColor: it.BorderColor,
+			TextColor:   it.TextColor,
+		}
+		if it.Actor2 != nil {
+			ji.Actor2 = actorToJSON(it.Actor2)
+		}
+		if it.Shape != RectNoteShape {
+			ji.Shape = jsonNoteShapes[it.Shape]
+		}
+		return ji, nil
+	case *Ref:
+		ji := &jsonItem{
+			Type:    "ref",
+			Actor1:  actorToJSON(it.Actor1),
+			Message: it.Message,
+			Link:    it.Link,
+		}
+		if it.Actor2 != it.Actor1 {
+			ji.Actor2 = actorToJSON(it.Actor2)
+		}
+		return ji, nil
+	case *Divider:
+		return &jsonItem{
+			Type:      "divider",
+			Divider:   jsonDividerTypes[it.Type],
+			Message:   it.Message,
+			Color:     it.Color,
+			TextColor: it.TextColor,
+		}, nil
+	case *Block:
+		ji := &jsonItem{Type: "block"}
+		for _, seg := range it.Segments {
+			subItems, err := itemsToJSON(seg.SubItems)
+			if err != nil {
+				return nil, err
+			}
+
+			js := &jsonSegment{
+				Type:        jsonSegmentTypes[seg.Type],
+				Prefix:      seg.Prefix,
+				Message:     seg.Message,
+				FullWidth:   seg.FullWidth,
+				Messages:    seg.Messages,
+				Color:       seg.Color,
+				BorderColor: seg.BorderColor,
+				TabColor:    seg.TabColor,
+				FontSize:    seg.FontSize,
+				Items:       subItems,
+			}
+			if seg.LineStyle != DashedBlockLine {
+				js.LineStyle = jsonBlockLineStyles[seg.LineStyle]
+			}
+			ji.Segments = append(ji.Segments, js)
+		}
+		return ji, nil
+	default:
+		return nil, fmt.Errorf("unsupported sequence item: %T", item)
+	}
+}
+
+func actorToJSON(actor *Actor) string {
+	switch actor {
+	case LeftOffsideActor:
+		return jsonLeftOffsideActor
+	case RightOffsideActor:
+		return jsonRightOffsideActor
+	case LostActor:
+		return jsonLostActor
+	case FoundActor:
+		return jsonFoundActor
+	}
+
+	if strings.HasPrefix(actor.Name, jsonPseudoActorPrefix) {
+		return jsonPseudoActorPrefix + actor.Name
+	}
+	return actor.Name
+}
+
+// UnmarshalJSON decodes a diagram from JSON.  Any existing actors and items of the diagram
+// are replaced.
+func (d *Diagram) UnmarshalJSON(data []byte) error {
+	var jd jsonDiagram
+	if err := json.Unmarshal(data, &jd); err != nil {
+		return err
+	}
+
+	*d = Diagram{Title: jd.Title}
+
+	for _, jpi := range jd.ProcessingInstructions {
+		d.ProcessingInstructions = append(d.ProcessingInstructions, &ProcessingInstruction{jpi.Prefix, jpi.Value})
+	}
+
+	for _, ja := range jd.Actors {
+		if ja.Name == "" {
+			return fmt.Errorf("actor is missing a name")
+		}
+
+		actor := d.GetOrAddActorWithOptions(ja.Name, ja.Label)
+		actor.InHeader = ja.InHeader
+		actor.InFooter = ja.InFooter
+		actor.Lifeline = ja.Lifeline
+		actor.Color = ja.Color
+		actor.TextColor = ja.TextColor
+
+		if ja.Icon != "" {
+			icon, err := LookupActorIcon(ja.Icon)
+			if err != nil {
+				return fmt.Errorf("error loading icon '%s': %s", ja.Icon, err.Error())
+			}
+			actor.Icon = icon
+		}
+	}
+
+	for _, jg := range jd.Groups {
+		group := &ActorGroup{Label: jg.Label, Color: jg.Color}
+		for _, name := range jg.Actors {
+			group.Actors = append(group.Actors, d.actorFromJSON(name))
+		}
+		if err := d.AddActorGroup(group); err != nil {
+			return err
+		}
+	}
+
+	items, err := d.itemsFromJSON(jd.Items)
+	if err != nil {
+		return err
+	}
+	d.Items = items
+
+	return nil
+}
+
+func (d *Diagram) itemsFromJSON(jsonItems []*jsonItem) ([]SequenceItem, error) {
+	items := make([]SequenceItem, 0, len(jsonItems))
+	for _, ji := range jsonItems {
+		item, err := d.itemFromJSON(ji)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *Diagram) itemFromJSON(ji *jsonItem) (SequenceItem, error) {
+	switch ji.Type {
+	case "action":
+		if ji.From == "" || ji.To == "" {
+			return nil, fmt.Errorf("action is missing an actor")
+		}
+
+		arrow := Arrow{SolidArrowStem, SolidArrowHead, false}
+		if ji.Arrow != nil {
+			var err error
+			if arrow.Stem, err = fromJSONName(jsonArrowStems, "arrow stem", ji.Arrow.Stem, SolidArrowStem); err != nil {
+				return nil, err
+			}
+			if arrow.Head, err = fromJSONName(jsonArrowHeads, "arrow head", ji.Arrow.Head, SolidArrowHead); err != nil {
+				return nil, err
+			}
+			arrow.TailHead = ji.Arrow.TailHead
+		}
+
+		from, to := d.actorFromJSON(ji.From), d.actorFromJSON(ji.To)
+		if err := checkLostAndFound(from, to); err != nil {
+			return nil, err
+		}
+		if ji.Width < 0 {
+			return nil, fmt.Errorf("the width of a message cannot be negative")
+		}
+		textColor := ji.TextColor
+		if textColor == "" {
+			textColor = ji.Color
+		}
+		action := &Action{from, to, arrow, ji.Message, ji.Delay, ji.Color, textColor, ji.Width}
+		if err := checkDelay(action); err != nil {
+			return nil, err
+		}
+		return action, nil
+	case jsonActivationTypes[StartActivation], jsonActivationTypes[EndActivation]:
+		if ji.Actor == "" {
+			return nil, fmt.Errorf("%s is missing an actor", ji.Type)
+		}
+
+		activationType, err := fromJSONName(jsonActivationTypes, "activation type", ji.Type, StartActivation)
+		if err != nil {
+			return nil, err
+		}
+
+		actor := d.actorFromJSON(ji.Actor)
+		if isLostOrFound(actor) {
+			return nil, fmt.Errorf("lost and found messages cannot be activated")
+		}
+		return &Activation{actor, activationType}, nil
+	case "create", "destroy":
+		if ji.Actor == "" {
+			return nil, fmt.Errorf("%s is missing an actor", ji.Type)
+		}
+
+		actor := d.actorFromJSON(ji.Actor)
+		if isLostOrFound(actor) {
+			return nil, fmt.Errorf("%s cannot refer to lost or found", ji.Type)
+		}
+
+		if ji.Type == "create" {
+			return &Creation{actor}, nil
+		}
+		return &Destruction{actor}, nil
+	case jsonAutoNumberTypes[StartAutoNumber], jsonAutoNumberTypes[StopAutoNumber], jsonAutoNumberTypes[ResumeAutoNumber]:
+		autoNumberType, err := fromJSONName(jsonAutoNumberTypes, "autonumber type", ji.Type, StartAutoNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		autoNumber := &AutoNumber{Type: autoNumberType, Start: 1, Step: 1, Format: ji.Format, Nested: ji.Nested}
+		if ji.Start != nil {
+			autoNumber.Start = *ji.Start
+		}
+		if ji.Step != nil {
+			autoNumber.Step = *ji.Step
+		}
+		return autoNumber, nil
+	case "note":
+		if ji.Actor1 == "" {
+			return nil, fmt.Errorf("note is missing an actor")
+		}
+
+		align, err := fromJSONName(jsonNoteAlignments, "note alignment", ji.Align, OverNoteAlignment)
+		if err != nil {
+			return nil, err
+		}
+
+		shape, err := fromJSONName(jsonNoteShapes, "note shape", ji.Shape, RectNoteShape)
+		if err != nil {
+			return nil, err
+		}
+
+		note := &Note{
+			Actor1:      d.actorFromJSON(ji.Actor1),
+			Align:       align,
+			Message:     ji.Message,
+			Shape:       shape,
+			Color:       ji.Color,
+			BorderColor: ji.BorderColor,
+			TextColor:   ji.TextColor,
+		}
+		if ji.Actor2 != "" {
+			note.Actor2 = d.actorFromJSON(ji.Actor2)
+		}
+
+		if isLostOrFound(note.Actor1) || isLostOrFound(note.Actor2) {
+			return nil, fmt.Errorf("notes cannot be placed against lost or found")
+		}
+		return note, nil
+	case "ref":
+		if ji.Actor1 == "" {
+			return nil, fmt.Errorf("ref is missing an actor")
+		}
+
+		ref := &Ref{Actor1: d.actorFromJSON(ji.Actor1), Message: ji.Message, Link: ji.Link}
+		ref.Actor2 = ref.Actor1
+		if ji.Actor2 != "" {
+			ref.Actor2 = d.actorFromJSON(ji.Actor2)
+		}
+
+		if ref.Actor1.rank < 0 || ref.Actor2.rank < 0 {
+			return nil, fmt.Errorf("references can only be placed over participants")
+		}
+		return ref, nil
+	case "divider":
+		dividerType, err := fromJSONName(jsonDividerTypes, "divider type", ji.Divider, DTGap)
+		if err != nil {
+			return nil, err
+		}
+		textColor := ji.TextColor
+		if textColor == "" {
+			textColor = ji.Color
+		}
+		return &Divider{ji.Message, dividerType, ji.Color, textColor}, nil
+	case "block":
+		block := &Block{}
+		for _, js := range ji.Segments {
+			segType, err := fromJSONName(jsonSegmentTypes, "segment type", js.Type, EmptySegmentType)
+			if err != nil {
+				return nil, err
+			}
+
+			lineStyle, err := fromJSONName(jsonBlockLineStyles, "line style", js.LineStyle, DashedBlockLine)
+			if err != nil {
+				return nil, err
+			}
+			if js.FontSize < 0 {
+				return nil, fmt.Errorf("the font size of a block cannot be negative")
+			}
+
+			subItems, err := d.itemsFromJSON(js.Items)
+			if err != nil {
+				return nil, err
+			}
+
+			block.Segments = append(block.Segments, &BlockSegment{
+				Type:        segType,
+				Prefix:      js.Prefix,
+				Message:     js.Message,
+				FullWidth:   js.FullWidth,
+				SubItems:    subItems,
+				Messages:    js.Messages,
+				Color:       js.Color,
+				BorderColor: js.BorderColor,
+				TabColor:    js.TabColor,
+				LineStyle:   lineStyle,
+				FontSize:    js.FontSize,
+			})
+		}
+		return block, nil
+	default:
+		return nil, fmt.Errorf("unrecognised item type: '%s'", ji.Type)
+	}
+}
+
+// Returns the actor for a reference.  Actors which are not declared are added to the
+// diagram, except for the references to the sides of the diagram and to the ends of lost
+// and found messages.
+func (d *Diagram) actorFromJSON(name string) *Actor {
+	switch name {
+	case jsonLeftOffsideActor:
+		return LeftOffsideActor
+	case jsonRightOffsideActor:
+		return RightOffsideActor
+	case jsonLostActor:
+		return LostActor
+	case jsonFoundActor:
+		return FoundActor
+	}
+
+	if strings.HasPrefix(name, jsonPseudoActorPrefix+jsonPseudoActorPrefix) {
+		name = name[len(jsonPseudoActorPrefix):]
+	}
+	return d.GetOrAddActor(name)
+}
+
+// Returns the value with the given JSON name, or the default if the name is empty
+func fromJSONName[T comparable](names map[T]string, what string, name string, def T) (T, error) {
+	if name == "" {
+		return def, nil
+	}
+
+	for value, n := range names {
+		if n == name {
+			return value, nil
+		}
+	}
+	return def, fmt.Errorf("unrecognised %s: '%s'", what, name)
+}
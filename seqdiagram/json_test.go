@@ -0,0 +1,45 @@
+package seqdiagram
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONActorsStartingWithAt(t *testing.T) {
+	d := NewDiagram()
+	admin := d.GetOrAddActor("@admin")
+	left := d.GetOrAddActor("@left")
+	d.AddSequenceItem(&Action{From: admin, To: left, Message: "hello"})
+	d.AddSequenceItem(&Action{From: LeftOffsideActor, To: admin, Message: "from the side"})
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"from":"@@admin","to":"@@left"`, `"from":"@left","to":"@@admin"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("want JSON to contain %s, got %s", want, data)
+		}
+	}
+
+	var decoded Diagram
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Actors) != 2 || decoded.Actors[0].Name != "@admin" || decoded.Actors[1].Name != "@left" {
+		t.Fatalf("want actors @admin and @left, got %v", decoded.Actors)
+	}
+
+	first := decoded.Items[0].(*Action)
+	if first.From != decoded.Actors[0] || first.To != decoded.Actors[1] {
+		t.Errorf("want message from @admin to @left, got %v to %v", first.From, first.To)
+	}
+
+	second := decoded.Items[1].(*Action)
+	if second.From != LeftOffsideActor || second.To != decoded.Actors[0] {
+		t.Errorf("want message from the left side to @admin, got %v to %v", second.From, second.To)
+	}
+}
@@ -0,0 +1,17 @@
+// Package mermaid converts sequence diagrams to and from Mermaid sequenceDiagram source.
+package mermaid
+
+import "fmt"
+
+// Warning describes part of a diagram which could not be converted exactly.
+type Warning struct {
+	// The line of the Mermaid source the warning relates to
+	Line int
+
+	// A description of the problem
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
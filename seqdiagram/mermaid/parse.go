@@ -0,0 +1,498 @@
+package mermaid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lmika/goseq/seqdiagram"
+	"golang.org/x/image/colornames"
+)
+
+// Icons for the participant keywords
+var participantKeywordIcons = map[string]string{
+	"participant": "",
+	"actor":       "human",
+}
+
+// Icons for the participant types set using the "@{...}" syntax
+var participantTypeIcons = map[string]string{
+	"participant": "",
+	"actor":       "human",
+	"database":    "cylinder",
+	"queue":       "horiz-cylinder",
+}
+
+var arrows = map[string]seqdiagram.Arrow{
+	"->>":  {Stem: seqdiagram.SolidArrowStem, Head: seqdiagram.SolidArrowHead},
+	"-->>": {Stem: seqdiagram.DashedArrowStem, Head: seqdiagram.SolidArrowHead},
+	"->":   {Stem: seqdiagram.SolidArrowStem, Head: seqdiagram.SolidArrowHead},
+	"-->":  {Stem: seqdiagram.DashedArrowStem, Head: seqdiagram.SolidArrowHead},
+	"-x":   {Stem: seqdiagram.SolidArrowStem, Head: seqdiagram.SolidArrowHead},
+	"--x":  {Stem: seqdiagram.DashedArrowStem, Head: seqdiagram.SolidArrowHead},
+	"-)":   {Stem: seqdiagram.SolidArrowStem, Head: seqdiagram.OpenArrowHead},
+	"--)":  {Stem: seqdiagram.DashedArrowStem, Head: seqdiagram.OpenArrowHead},
+}
+
+// Warnings for arrows which cannot be drawn exactly
+var arrowWarnings = map[string]string{
+	"->":  "arrows without heads are drawn with a solid head",
+	"-->": "arrows without heads are drawn with a solid head",
+	"-x":  "cross arrow heads are drawn as solid heads",
+	"--x": "cross arrow heads are drawn as solid heads",
+}
+
+// Segment types for the keywords which start a block
+var blockSegmentTypes = map[string]seqdiagram.SegmentType{
+	"alt":      seqdiagram.AltSegmentType,
+	"opt":      seqdiagram.OptSegmentType,
+	"loop":     seqdiagram.LoopSegmentType,
+	"par":      seqdiagram.ParSegmentType,
+	"critical": seqdiagram.CriticalSegmentType,
+	"break":    seqdiagram.BreakSegmentType,
+}
+
+// Segment types for the keywords which start the subsequent segments of a block
+var nextSegmentTypes = map[string]seqdiagram.SegmentType{
+	"else":   seqdiagram.ElseSegmentType,
+	"and":    seqdiagram.ParElseSegmentType,
+	"option": seqdiagram.ElseSegmentType,
+}
+
+// Statements which are not supported
+var unsupportedKeywords = map[string]bool{
+	"link":       true,
+	"links":      true,
+	"properties": true,
+	"details":    true,
+}
+
+var (
+	participantRegexp     = regexp.MustCompile(`^(participant|actor)\s+([^\s@]+)(?:@\{(.*)\})?(?:\s+as\s+(.*))?$`)
+	participantTypeRegexp = regexp.MustCompile(`"?type"?\s*:\s*"(\w+)"`)
+	messageRegexp         = regexp.MustCompile(`^([^\s<>:,+-]+)\s*(<<-->>|<<->>|-->>|->>|--x|-x|--\)|-\)|-->|->)\s*([+-]?)\s*([^\s<>:,+-]+)\s*(?::(.*))?$`)
+	noteRegexp            = regexp.MustCompile(`^(?i:note)\s+(left of|right of|over)\s+([^:]+):(.*)$`)
+	mirrorActorsRegexp    = regexp.MustCompile(`"?mirrorActors"?\s*:\s*false`)
+	entityRegexp          = regexp.MustCompile(`#(\d+);`)
+	entityPrefixRegexp    = regexp.MustCompile(`#\d+$`)
+	lineBreakRegexp       = regexp.MustCompile(`(?i)<br\s*/?>`)
+	hexColorRegexp        = regexp.MustCompile(`^#(?:[0-9A-Fa-f]{3}){1,2}$`)
+)
+
+// Parse reads a Mermaid sequenceDiagram and converts it to a diagram.  Constructs which
+// cannot be converted are left out and returned as warnings against the lines they
+// appear on.
+func Parse(r io.Reader) (*seqdiagram.Diagram, []Warning, error) {
+	mp := &parser{
+		diagram: seqdiagram.NewDiagram(),
+		scanner: bufio.NewScanner(r),
+	}
+
+	if err := mp.parse(); err != nil {
+		return nil, mp.warnings, err
+	}
+	return mp.diagram, mp.warnings, nil
+}
+
+type parser struct {
+	diagram  *seqdiagram.Diagram
+	scanner  *bufio.Scanner
+	lineNo   int
+	warnings []Warning
+
+	// The blocks which have not yet been ended, innermost last
+	blocks []*openBlock
+
+	// Participants to destroy after the next message
+	pendingDestructions []*seqdiagram.Actor
+
+	seenHeader  bool
+	hideFooters bool
+}
+
+// A block which has not yet been ended.  Blocks which only affect the appearance of the
+// diagram, such as "rect", have no model block.
+type openBlock struct {
+	block   *seqdiagram.Block
+	keyword string
+	lineNo  int
+
+	// The group of participants declared within a box
+	group *seqdiagram.ActorGroup
+}
+
+func (mp *parser) warn(format string, args ...interface{}) {
+	mp.warnings = append(mp.warnings, Warning{
+		Line:    mp.lineNo,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Reads the next line, with the surrounding whitespace removed.  Returns false at the
+// end of the input.
+func (mp *parser) nextLine() (string, bool) {
+	if !mp.scanner.Scan() {
+		return "", false
+	}
+	mp.lineNo++
+	return strings.TrimSpace(mp.scanner.Text()), true
+}
+
+func (mp *parser) parse() error {
+	for {
+		line, ok := mp.nextLine()
+		if !ok {
+			break
+		}
+
+		switch {
+		case line == "---" && !mp.seenHeader:
+			mp.parseFrontMatter()
+		case strings.HasPrefix(line, "%%{"):
+			if mirrorActorsRegexp.MatchString(line) {
+				mp.hideFooters = true
+			}
+		case line == "", strings.HasPrefix(line, "%%"):
+			continue
+		case !mp.seenHeader:
+			if line != "sequenceDiagram" {
+				return fmt.Errorf("%d: not a sequence diagram", mp.lineNo)
+			}
+			mp.seenHeader = true
+		default:
+			// Statements can be separated with semicolons
+			for _, stmt := range splitStatements(line) {
+				if stmt = strings.TrimSpace(stmt); stmt != "" {
+					mp.parseStatement(stmt)
+				}
+			}
+		}
+	}
+
+	if err := mp.scanner.Err(); err != nil {
+		return err
+	}
+	mp.addPendingDestructions()
+
+	for i := len(mp.blocks) - 1; i >= 0; i-- {
+		mp.warnings = append(mp.warnings, Warning{
+			Line:    mp.blocks[i].lineNo,
+			Message: fmt.Sprintf("%s block is missing an end", mp.blocks[i].keyword),
+		})
+		if group := mp.blocks[i].group; group != nil {
+			mp.addGroup(group)
+		}
+	}
+
+	if mp.hideFooters {
+		for _, actor := range mp.diagram.Actors {
+			actor.InFooter = false
+		}
+	}
+	return nil
+}
+
+// Parses the front matter.  Only the title is used.
+func (mp *parser) parseFrontMatter() {
+	for {
+		line, ok := mp.nextLine()
+		if !ok || line == "---" {
+			return
+		}
+
+		if title, isTitle := strings.CutPrefix(line, "title:"); isTitle {
+			title = strings.TrimSpace(title)
+			if unquoted, err := strconv.Unquote(title); err == nil {
+				title = unquoted
+			}
+			mp.diagram.Title = title
+		}
+	}
+}
+
+func (mp *parser) parseStatement(stmt string) {
+	keyword, rest, _ := strings.Cut(stmt, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch {
+	case keyword == "title" || keyword == "title:":
+		mp.diagram.Title = unescapeText(strings.TrimSpace(strings.TrimPrefix(rest, ":")))
+	case participantRegexp.MatchString(stmt):
+		actor := mp.parseParticipant(participantRegexp.FindStringSubmatch(stmt))
+		if group := mp.openGroup(); group != nil {
+			group.Actors = append(group.Actors, actor)
+		}
+	case noteRegexp.MatchString(stmt):
+		mp.parseNote(noteRegexp.FindStringSubmatch(stmt))
+	case hasBlockSegmentType(keyword):
+		mp.openBlock(keyword, rest)
+	case hasNextSegmentType(keyword):
+		mp.nextSegment(keyword, rest)
+	case keyword == "box":
+		mp.parseBox(rest)
+	case keyword == "rect":
+		mp.warn("%s is not supported", keyword)
+		mp.blocks = append(mp.blocks, &openBlock{nil, keyword, mp.lineNo, nil})
+	case stmt == "end":
+		mp.endBlock()
+	case keyword == "create" && participantRegexp.MatchString(rest):
+		actor := mp.parseParticipant(participantRegexp.FindStringSubmatch(rest))
+		mp.addItem(&seqdiagram.Creation{Actor: actor})
+	case keyword == "destroy" && rest != "":
+		mp.pendingDestructions = append(mp.pendingDestructions, mp.diagram.GetOrAddActor(rest))
+	case keyword == "activate" || keyword == "deactivate":
+		mp.parseActivation(keyword, rest)
+	case stmt == "autonumber":
+		// Numbering starts from the message following the statement
+		mp.addItem(&seqdiagram.AutoNumber{Type: seqdiagram.StartAutoNumber, Start: 1, Step: 1})
+	case unsupportedKeywords[keyword]:
+		mp.warn("%s is not supported", keyword)
+	case messageRegexp.MatchString(stmt):
+		mp.parseMessage(messageRegexp.FindStringSubmatch(stmt))
+	default:
+		mp.warn("unrecognised statement: %s", stmt)
+	}
+}
+
+// Adds an item to the innermost block, or the diagram if there are no blocks
+func (mp *parser) addItem(item seqdiagram.SequenceItem) {
+	for i := len(mp.blocks) - 1; i >= 0; i-- {
+		if block := mp.blocks[i].block; block != nil {
+			seg := block.Segments[len(block.Segments)-1]
+			seg.SubItems = append(seg.SubItems, item)
+			return
+		}
+	}
+	mp.diagram.AddSequenceItem(item)
+}
+
+func (mp *parser) parseParticipant(match []string) *seqdiagram.Actor {
+	keyword, name, properties, label := match[1], match[2], match[3], strings.TrimSpace(match[4])
+	if label == "" {
+		label = name
+	}
+
+	actor := mp.diagram.GetOrAddActorWithOptions(name, unescapeText(label))
+	actor.Label = unescapeText(label)
+
+	iconName := participantKeywordIcons[keyword]
+	if properties != "" {
+		if typeMatch := participantTypeRegexp.FindStringSubmatch(properties); typeMatch != nil {
+			if typeIcon, hasType := participantTypeIcons[typeMatch[1]]; hasType {
+				iconName = typeIcon
+			} else {
+				mp.warn("%s participants are not supported", typeMatch[1])
+			}
+		}
+	}
+
+	if iconName != "" {
+		if icon, err := seqdiagram.LookupActorIcon(iconName); err == nil {
+			actor.Icon = icon
+		}
+	}
+	return actor
+}
+
+func (mp *parser) parseNote(match []string) {
+	note := &seqdiagram.Note{Message: unescapeText(strings.TrimSpace(match[3]))}
+	switch match[1] {
+	case "left of":
+		note.Align = seqdiagram.LeftNoteAlignment
+	case "right of":
+		note.Align = seqdiagram.RightNoteAlignment
+	default:
+		note.Align = seqdiagram.OverNoteAlignment
+	}
+
+	names := strings.SplitN(match[2], ",", 2)
+	note.Actor1 = mp.diagram.GetOrAddActor(strings.TrimSpace(names[0]))
+	if len(names) > 1 {
+		note.Actor2 = mp.diagram.GetOrAddActor(strings.TrimSpace(names[1]))
+	}
+
+	mp.addItem(note)
+}
+
+func (mp *parser) parseMessage(match []string) {
+	fromName, arrowName, activation, toName, text := match[1], match[2], match[3], match[4], match[5]
+
+	tailHead := strings.HasPrefix(arrowName, "<<")
+	arrowName = strings.TrimPrefix(arrowName, "<<")
+	if arrowWarning, hasWarning := arrowWarnings[arrowName]; hasWarning {
+		mp.warn("%s", arrowWarning)
+	}
+
+	action := &seqdiagram.Action{
+		From:    mp.diagram.GetOrAddActor(fromName),
+		To:      mp.diagram.GetOrAddActor(toName),
+		Arrow:   arrows[arrowName],
+		Message: unescapeText(strings.TrimSpace(text)),
+	}
+	action.Arrow.TailHead = tailHead
+	mp.addItem(action)
+	mp.addPendingDestructions()
+
+	switch activation {
+	case "+":
+		mp.addItem(&seqdiagram.Activation{Actor: action.To, Type: seqdiagram.StartActivation})
+	case "-":
+		mp.addItem(&seqdiagram.Activation{Actor: action.From, Type: seqdiagram.EndActivation})
+	}
+}
+
+// Adds the destructions of participants destroyed by the last message.  Mermaid destroys
+// participants before the message which destroys them, while the destruction follows the
+// message in the model.
+func (mp *parser) addPendingDestructions() {
+	for _, actor := range mp.pendingDestructions {
+		mp.addItem(&seqdiagram.Destruction{Actor: actor})
+	}
+	mp.pendingDestructions = nil
+}
+
+// Parses an activate or deactivate statement
+func (mp *parser) parseActivation(keyword, name string) {
+	if name == "" {
+		mp.warn("%s is missing a participant", keyword)
+		return
+	}
+
+	activationType := seqdiagram.StartActivation
+	if keyword == "deactivate" {
+		activationType = seqdiagram.EndActivation
+	}
+	mp.addItem(&seqdiagram.Activation{Actor: mp.diagram.GetOrAddActor(name), Type: activationType})
+}
+
+func (mp *parser) openBlock(keyword, message string) {
+	seg := &seqdiagram.BlockSegment{
+		Type:    blockSegmentTypes[keyword],
+		Message: unescapeText(message),
+	}
+
+	block := &seqdiagram.Block{Segments: []*seqdiagram.BlockSegment{seg}}
+	mp.addItem(block)
+	mp.blocks = append(mp.blocks, &openBlock{block, keyword, mp.lineNo, nil})
+}
+
+func (mp *parser) nextSegment(keyword, message string) {
+	if len(mp.blocks) == 0 || mp.blocks[len(mp.blocks)-1].block == nil {
+		mp.warn("%s outside of a block", keyword)
+		return
+	}
+
+	block := mp.blocks[len(mp.blocks)-1].block
+	block.Segments = append(block.Segments, &seqdiagram.BlockSegment{
+		Type:    nextSegmentTypes[keyword],
+		Message: unescapeText(message),
+	})
+}
+
+func (mp *parser) endBlock() {
+	if len(mp.blocks) == 0 {
+		mp.warn("end outside of a block")
+		return
+	}
+
+	if group := mp.blocks[len(mp.blocks)-1].group; group != nil {
+		mp.addGroup(group)
+	}
+	mp.blocks = mp.blocks[:len(mp.blocks)-1]
+}
+
+// Parses the start of a box around participants.  The box starts with an optional colour,
+// followed by the label.
+func (mp *parser) parseBox(rest string) {
+	if mp.openGroup() != nil {
+		mp.warn("boxes cannot be nested")
+		mp.blocks = append(mp.blocks, &openBlock{nil, "box", mp.lineNo, nil})
+		return
+	}
+
+	color, label := splitBoxColor(rest)
+	if strings.HasPrefix(color, "rgba(") {
+		mp.warn("box colour is not supported: %s", color)
+		color = ""
+	} else if color == "transparent" {
+		color = ""
+	}
+
+	group := &seqdiagram.ActorGroup{Label: unescapeText(label), Color: color}
+	mp.blocks = append(mp.blocks, &openBlock{nil, "box", mp.lineNo, group})
+}
+
+// Returns the group of the innermost box, or nil if the participants are not in a box
+func (mp *parser) openGroup() *seqdiagram.ActorGroup {
+	for i := len(mp.blocks) - 1; i >= 0; i-- {
+		if group := mp.blocks[i].group; group != nil {
+			return group
+		}
+	}
+	return nil
+}
+
+// Adds the group of a box which has ended to the diagram
+func (mp *parser) addGroup(group *seqdiagram.ActorGroup) {
+	if len(group.Actors) == 0 {
+		mp.warn("boxes without participants are not supported")
+	} else if err := mp.diagram.AddActorGroup(group); err != nil {
+		mp.warn("%s", err.Error())
+	}
+}
+
+// Splits the colour from the start of a box declaration.  The first word is only taken as
+// the colour if it is a colour name, a hex colour or an rgb() colour.
+func splitBoxColor(s string) (color string, label string) {
+	if strings.HasPrefix(s, "rgb(") || strings.HasPrefix(s, "rgba(") {
+		if end := strings.Index(s, ")"); end >= 0 {
+			return strings.ReplaceAll(s[:end+1], " ", ""), strings.TrimSpace(s[end+1:])
+		}
+	}
+
+	first, rest, _ := strings.Cut(s, " ")
+	_, isNamed := colornames.Map[strings.ToLower(first)]
+	if hexColorRegexp.MatchString(first) || first == "transparent" || isNamed {
+		return strings.ToLower(first), strings.TrimSpace(rest)
+	}
+	return "", s
+}
+
+func hasBlockSegmentType(keyword string) bool {
+	_, exists := blockSegmentTypes[keyword]
+	return exists
+}
+
+func hasNextSegmentType(keyword string) bool {
+	_, exists := nextSegmentTypes[keyword]
+	return exists
+}
+
+// Splits a line into statements separated by semicolons.  Semicolons ending an entity
+// code, such as "#59;", do not separate statements.
+func splitStatements(line string) []string {
+	stmts := make([]string, 0, 1)
+	start := 0
+	for i, r := range line {
+		if r == ';' && !entityPrefixRegexp.MatchString(line[start:i]) {
+			stmts = append(stmts, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(stmts, line[start:])
+}
+
+// Converts line breaks and entity codes in text
+func unescapeText(text string) string {
+	text = lineBreakRegexp.ReplaceAllString(text, "\n")
+	return entityRegexp.ReplaceAllStringFunc(text, func(entity string) string {
+		code, err := strconv.Atoi(entity[1 : len(entity)-1])
+		if err != nil {
+			return entity
+		}
+		return string(rune(code))
+	})
+}
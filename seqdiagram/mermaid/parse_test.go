@@ -0,0 +1,223 @@
+package mermaid
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lmika/goseq/seqdiagram"
+)
+
+func TestParseWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Warning
+	}{
+		{
+			name: "supported diagram",
+			src:  "sequenceDiagram\n  A->>B: hello\n  B-->>A: world\n",
+			want: nil,
+		},
+		{
+			name: "unrecognised statement",
+			src:  "sequenceDiagram\n  A->>B: hello\n  this is not mermaid\n",
+			want: []Warning{{3, "unrecognised statement: this is not mermaid"}},
+		},
+		{
+			name: "unsupported keyword",
+			src:  "sequenceDiagram\n\n  link A: Docs @ https://example.com\n",
+			want: []Warning{{3, "link is not supported"}},
+		},
+		{
+			name: "arrow without a head",
+			src:  "sequenceDiagram\n  A->B: hi\n  A-->B: hi\n",
+			want: []Warning{{2, "arrows without heads are drawn with a solid head"}, {3, "arrows without heads are drawn with a solid head"}},
+		},
+		{
+			name: "cross arrow head",
+			src:  "sequenceDiagram\n  A-xB: hi\n",
+			want: []Warning{{2, "cross arrow heads are drawn as solid heads"}},
+		},
+		{
+			name: "unsupported participant type",
+			src:  "sequenceDiagram\n  participant A@{ \"type\": \"boundary\" }\n",
+			want: []Warning{{2, "boundary participants are not supported"}},
+		},
+		{
+			name: "statements on one line",
+			src:  "sequenceDiagram\n  A->>B: hi; rect rgb(0, 0, 0); end\n",
+			want: []Warning{{2, "rect is not supported"}},
+		},
+		{
+			name: "block without an end",
+			src:  "sequenceDiagram\n  alt yes\n  A->>B: hi\n  loop\n  A->>B: hi\n",
+			want: []Warning{{4, "loop block is missing an end"}, {2, "alt block is missing an end"}},
+		},
+		{
+			name: "else and end outside of a block",
+			src:  "sequenceDiagram\n  else\n  A->>B: hi\n  end\n",
+			want: []Warning{{2, "else outside of a block"}, {4, "end outside of a block"}},
+		},
+		{
+			name: "else in a rect",
+			src:  "sequenceDiagram\n  rect rgb(0, 0, 0)\n  option maybe\n  end\n",
+			want: []Warning{{2, "rect is not supported"}, {3, "option outside of a block"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, warnings, err := Parse(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(warnings, test.want) {
+				t.Errorf("want warnings %v, got %v", test.want, warnings)
+			}
+		})
+	}
+}
+
+func TestParseMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantFrom string
+		wantTo   string
+		wantStem seqdiagram.ArrowStem
+		wantHead seqdiagram.ArrowHead
+		wantText string
+	}{
+		{"solid", "A->>B: hi", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, "hi"},
+		{"dashed", "A-->>B", "A", "B", seqdiagram.DashedArrowStem, seqdiagram.SolidArrowHead, ""},
+		{"open", "A-)B: async", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.OpenArrowHead, "async"},
+		{"dashed open", "A--)B", "A", "B", seqdiagram.DashedArrowStem, seqdiagram.OpenArrowHead, ""},
+		{"line break", "A->>B: one<br/>two", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, "one\ntwo"},
+		{"entity code", "A->>B: semi#59; colon", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, "semi; colon"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, _, err := Parse(strings.NewReader("sequenceDiagram\n" + test.src + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(d.Items) != 1 {
+				t.Fatalf("want 1 item, got %d", len(d.Items))
+			}
+			action, isAction := d.Items[0].(*seqdiagram.Action)
+			if !isAction {
+				t.Fatalf("want an action, got %T", d.Items[0])
+			}
+
+			if action.From.Name != test.wantFrom || action.To.Name != test.wantTo {
+				t.Errorf("want message from %s to %s, got %s to %s", test.wantFrom, test.wantTo, action.From.Name, action.To.Name)
+			}
+			if action.Arrow.Stem != test.wantStem || action.Arrow.Head != test.wantHead {
+				t.Errorf("want arrow stem %v and head %v, got %v and %v", test.wantStem, test.wantHead, action.Arrow.Stem, action.Arrow.Head)
+			}
+			if action.Message != test.wantText {
+				t.Errorf("want message %q, got %q", test.wantText, action.Message)
+			}
+		})
+	}
+}
+
+func TestParseTwoHeadedMessages(t *testing.T) {
+	d, warnings, err := Parse(strings.NewReader("sequenceDiagram\n  A<<->>B: both\n  A<<-->>B: both\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("want no warnings, got %v", warnings)
+	}
+	if len(d.Items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(d.Items))
+	}
+	for _, item := range d.Items {
+		action := item.(*seqdiagram.Action)
+		if action.From.Name != "A" || action.To.Name != "B" || !action.Arrow.TailHead {
+			t.Errorf("want two headed message from A to B, got message from %s to %s with tail head %v",
+				action.From.Name, action.To.Name, action.Arrow.TailHead)
+		}
+	}
+	if stem := d.Items[1].(*seqdiagram.Action).Arrow.Stem; stem != seqdiagram.DashedArrowStem {
+		t.Errorf("want dashed arrow stem, got %v", stem)
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	src := "---\ntitle: \"Login flow\"\n---\n%%{init: {\"mirrorActors\": false}}%%\nsequenceDiagram\n  A->>B: hi\n"
+
+	d, _, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Title != "Login flow" {
+		t.Errorf("want title 'Login flow', got '%s'", d.Title)
+	}
+	for _, actor := range d.Actors {
+		if actor.InFooter {
+			t.Errorf("want actor %s to be hidden in the footer", actor.Name)
+		}
+	}
+}
+
+func TestParseAutoNumber(t *testing.T) {
+	d, _, err := Parse(strings.NewReader("sequenceDiagram\n  A->>B: before\n  autonumber\n  A->>B: after\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Items) != 3 {
+		t.Fatalf("want 3 items, got %d", len(d.Items))
+	}
+	if _, isAction := d.Items[0].(*seqdiagram.Action); !isAction {
+		t.Errorf("want the message before autonumber to come first, got %T", d.Items[0])
+	}
+	autoNumber, isAutoNumber := d.Items[1].(*seqdiagram.AutoNumber)
+	if !isAutoNumber {
+		t.Fatalf("want numbering to start after the first message, got %T", d.Items[1])
+	}
+	if autoNumber.Type != seqdiagram.StartAutoNumber || autoNumber.Start != 1 || autoNumber.Step != 1 {
+		t.Errorf("want numbering to start at 1, got %+v", autoNumber)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       io.Reader
+		wantErr string
+	}{
+		{"not a sequence diagram", strings.NewReader("%% comment\n\nflowchart LR\n  A --> B\n"), "3: not a sequence diagram"},
+		{"line too long", strings.NewReader("sequenceDiagram\nA->>B: " + strings.Repeat("x", bufio.MaxScanTokenSize)), "bufio.Scanner: token too long"},
+		{"read error", failingReader{}, "read failed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, _, err := Parse(test.r)
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("want error '%s', got %v", test.wantErr, err)
+			}
+			if d != nil {
+				t.Errorf("want no diagram on error")
+			}
+		})
+	}
+}
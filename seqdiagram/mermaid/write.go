@@ -0,0 +1,522 @@
+package mermaid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lmika/goseq/seqdiagram"
+)
+
+var arrowStemMapping = map[seqdiagram.ArrowStem]string{
+	seqdiagram.SolidArrowStem:  "-",
+	seqdiagram.DashedArrowStem: "--",
+	seqdiagram.ThickArrowStem:  "-",
+}
+
+var arrowHeadMapping = map[seqdiagram.ArrowHead]string{
+	seqdiagram.SolidArrowHead:     ">>",
+	seqdiagram.OpenArrowHead:      ")",
+	seqdiagram.BarbArrowHead:      ">>",
+	seqdiagram.LowerBarbArrowHead: ">>",
+}
+
+var activationKeywords = map[seqdiagram.ActivationType]string{
+	seqdiagram.StartActivation: "activate",
+	seqdiagram.EndActivation:   "deactivate",
+}
+
+var segmentKeywords = map[seqdiagram.SegmentType]string{
+	seqdiagram.AltSegmentType:              "alt",
+	seqdiagram.ElseSegmentType:             "else",
+	seqdiagram.ParSegmentType:              "par",
+	seqdiagram.ParElseSegmentType:          "and",
+	seqdiagram.OptSegmentType:              "opt",
+	seqdiagram.LoopSegmentType:             "loop",
+	seqdiagram.ConcurrentSegmentType:       "par",
+	seqdiagram.ConcurrentWhilstSegmentType: "and",
+	seqdiagram.CriticalSegmentType:         "critical",
+	seqdiagram.BreakSegmentType:            "break",
+	seqdiagram.NegSegmentType:              "opt",
+	seqdiagram.IgnoreSegmentType:           "opt",
+	seqdiagram.ConsiderSegmentType:         "opt",
+	seqdiagram.AssertSegmentType:           "opt",
+	seqdiagram.StrictSegmentType:           "opt",
+	seqdiagram.SeqSegmentType:              "opt",
+	seqdiagram.EmptySegmentType:            "opt",
+}
+
+// Names of the fragments which are not supported by Mermaid, and are written as opt
+var optSegmentNames = map[seqdiagram.SegmentType]string{
+	seqdiagram.NegSegmentType:      "neg",
+	seqdiagram.IgnoreSegmentType:   "ignore",
+	seqdiagram.ConsiderSegmentType: "consider",
+	seqdiagram.AssertSegmentType:   "assert",
+	seqdiagram.StrictSegmentType:   "strict",
+	seqdiagram.SeqSegmentType:      "seq",
+}
+
+// Keywords of the subsequent segments of a block, keyed by the keyword of the first segment
+var nextSegmentKeywords = map[string]string{
+	"alt":      "else",
+	"par":      "and",
+	"critical": "option",
+}
+
+// Characters which cannot appear in participant names
+var invalidNameCharsRegexp = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Characters which must be written as entity codes in text
+var textReplacer = strings.NewReplacer(
+	"\n", "<br/>",
+	"#", "#35;",
+	";", "#59;",
+)
+
+// Write writes the diagram as a Mermaid sequenceDiagram.  Parts of the diagram which cannot
+// be represented in Mermaid are approximated or left out, and are returned as warnings
+// against the lines of the written source.
+func Write(w io.Writer, d *seqdiagram.Diagram) ([]Warning, error) {
+	mw := &writer{diagram: d, names: make(map[*seqdiagram.Actor]string), created: make(map[*seqdiagram.Actor]bool)}
+	mw.writeDiagram()
+
+	bw := bufio.NewWriter(w)
+	for _, line := range mw.lines {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return mw.warnings, err
+		}
+	}
+	return mw.warnings, bw.Flush()
+}
+
+type writer struct {
+	diagram  *seqdiagram.Diagram
+	names    map[*seqdiagram.Actor]string
+	created  map[*seqdiagram.Actor]bool
+	lines    []string
+	warnings []Warning
+	indent   int
+}
+
+// Adds a line to the output
+func (mw *writer) println(format string, args ...interface{}) {
+	mw.lines = append(mw.lines, strings.Repeat("    ", mw.indent)+fmt.Sprintf(format, args...))
+}
+
+// Adds a warning against the line which will be written next
+func (mw *writer) warn(format string, args ...interface{}) {
+	mw.warnings = append(mw.warnings, Warning{
+		Line:    len(mw.lines) + 1,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (mw *writer) writeDiagram() {
+	if mw.hideFooters() {
+		mw.println(`%%%%{init: {"sequence": {"mirrorActors": false}}}%%%%`)
+	}
+
+	mw.println("sequenceDiagram")
+	mw.indent++
+
+	if mw.diagram.Title != "" {
+		if strings.Contains(mw.diagram.Title, "\n") {
+			mw.warn("multi-line titles are not supported")
+		}
+		mw.println("title %s", escapeText(strings.ReplaceAll(mw.diagram.Title, "\n", " ")))
+	}
+
+	mw.findCreatedActors(mw.diagram.Items)
+	mw.writeParticipants()
+	mw.writeItems(mw.diagram.Items)
+}
+
+// Writes the start of automatic numbering.  Mermaid numbers the messages following
+// autonumber from one, so the numbering cannot be changed or stopped.
+func (mw *writer) writeAutoNumber(autoNumber *seqdiagram.AutoNumber) {
+	if autoNumber.Type != seqdiagram.StartAutoNumber {
+		mw.warn("stopping and resuming numbering is not supported")
+		return
+	} else if autoNumber.Start != 1 || autoNumber.Step != 1 || autoNumber.Format != "" || autoNumber.Nested {
+		mw.warn("numbering options are not supported")
+	}
+	mw.println("autonumber")
+}
+
+// Finds the actors which are created part way through the diagram.  These are declared
+// where they are created, instead of with the other participants.
+func (mw *writer) findCreatedActors(items []seqdiagram.SequenceItem) {
+	for _, item := range items {
+		switch it := item.(type) {
+		case *seqdiagram.Creation:
+			mw.created[it.Actor] = true
+		case *seqdiagram.Block:
+			for _, seg := range it.Segments {
+				mw.findCreatedActors(seg.SubItems)
+			}
+		}
+	}
+}
+
+// Returns true if the participants should not be repeated at the bottom of the diagram
+func (mw *writer) hideFooters() bool {
+	hiddenFooters := 0
+	for _, actor := range mw.diagram.Actors {
+		if !actor.InFooter {
+			hiddenFooters++
+		}
+	}
+
+	if hiddenFooters > 0 && hiddenFooters < len(mw.diagram.Actors) {
+		mw.warn("footers can only be hidden for all participants")
+	}
+	return hiddenFooters > 0
+}
+
+func (mw *writer) writeParticipants() {
+	groupOfActor := make(map[*seqdiagram.Actor]*seqdiagram.ActorGroup)
+	for _, group := range mw.diagram.Groups {
+		for _, actor := range group.Actors {
+			groupOfActor[actor] = group
+		}
+	}
+
+	for _, actor := range mw.diagram.Actors {
+		if group, inGroup := groupOfActor[actor]; !inGroup {
+			mw.writeParticipant(actor)
+		} else if group.Actors[0] == actor {
+			mw.writeGroup(group)
+		}
+	}
+}
+
+// Writes the declaration of a participant, unless it is created part way through the diagram
+func (mw *writer) writeParticipant(actor *seqdiagram.Actor) {
+	if mw.created[actor] {
+		// Reserve the name, so that the names do not depend on where actors are created
+		mw.participantName(actor)
+		return
+	}
+	mw.println("%s", mw.participantDeclaration(actor))
+}
+
+// Writes a box around the participants of a group.  The colour is always written, so that
+// the first word of the label is not taken as the colour.
+func (mw *writer) writeGroup(group *seqdiagram.ActorGroup) {
+	color := group.Color
+	if color == "" {
+		color = "transparent"
+	}
+	mw.println("box %s", strings.TrimSpace(color+" "+escapeText(group.Label)))
+
+	mw.indent++
+	for _, actor := range group.Actors {
+		if mw.created[actor] {
+			mw.warn("participant %s: created participants cannot be placed within a box", actor.Name)
+		}
+		mw.writeParticipant(actor)
+	}
+	mw.indent--
+	mw.println("end")
+}
+
+// Returns the declaration of a participant
+func (mw *writer) participantDeclaration(actor *seqdiagram.Actor) string {
+	keyword := "participant"
+	if actor.Icon != nil {
+		if actor.Icon.Name() == "human" {
+			keyword = "actor"
+		} else {
+			mw.warn("participant %s: icon \"%s\" is not supported", actor.Name, actor.Icon.Name())
+		}
+	}
+
+	if !actor.InHeader {
+		mw.warn("participant %s: hiding the header is not supported", actor.Name)
+	}
+	if !actor.Lifeline {
+		mw.warn("participant %s: hiding the lifeline is not supported", actor.Name)
+	}
+	if actor.Color != "black" || actor.TextColor != "black" {
+		mw.warn("participant %s: colours are not supported", actor.Name)
+	}
+
+	name := mw.participantName(actor)
+	if actor.Label == name {
+		return keyword + " " + name
+	}
+	return keyword + " " + name + " as " + escapeText(actor.Label)
+}
+
+// Writes a list of items.  Mermaid destroys participants before the message destroying
+// them, so destructions following a message are written before it.
+func (mw *writer) writeItems(items []seqdiagram.SequenceItem) {
+	for i := 0; i < len(items); i++ {
+		action, isAction := items[i].(*seqdiagram.Action)
+		if !isAction {
+			mw.writeItem(items[i])
+			continue
+		}
+
+		for ; i+1 < len(items); i++ {
+			destruction, isDestruction := items[i+1].(*seqdiagram.Destruction)
+			if !isDestruction || (destruction.Actor != action.From && destruction.Actor != action.To) {
+				break
+			}
+			mw.println("destroy %s", mw.participantName(destruction.Actor))
+		}
+		mw.writeAction(action)
+	}
+}
+
+func (mw *writer) writeItem(item seqdiagram.SequenceItem) {
+	switch it := item.(type) {
+	case *seqdiagram.Action:
+		mw.writeAction(it)
+	case *seqdiagram.Activation:
+		mw.writeActivation(it)
+	case *seqdiagram.Creation:
+		mw.println("create %s", mw.participantDeclaration(it.Actor))
+	case *seqdiagram.Destruction:
+		mw.warn("destroying participant %s without a message is not supported", it.Actor.Name)
+	case *seqdiagram.AutoNumber:
+		mw.writeAutoNumber(it)
+	case *seqdiagram.Note:
+		mw.writeNote(it)
+	case *seqdiagram.Ref:
+		// Mermaid has no references, so they are written as notes over the same participants
+		mw.warn("references are written as notes")
+		if it.Link != "" {
+			mw.warn("links are not supported")
+		}
+		mw.writeNote(&seqdiagram.Note{Actor1: it.Actor1, Actor2: it.Actor2, Align: seqdiagram.OverNoteAlignment, Message: "ref: " + it.Message})
+	case *seqdiagram.Divider:
+		mw.writeDivider(it)
+	case *seqdiagram.Block:
+		mw.writeBlock(it)
+	default:
+		mw.warn("unsupported item: %T", item)
+	}
+}
+
+func (mw *writer) writeAction(action *seqdiagram.Action) {
+	if isOffside(action.From) || isOffside(action.To) {
+		mw.warn("messages to and from the sides of the diagram are not supported")
+		return
+	}
+	if action.To == seqdiagram.LostActor || action.From == seqdiagram.FoundActor {
+		mw.warn("lost and found messages are not supported")
+		return
+	}
+
+	switch action.Arrow.Stem {
+	case seqdiagram.ThickArrowStem:
+		mw.warn("thick arrow stems are not supported")
+	}
+	if action.Color != "" || action.TextColor != "" || action.Width > 0 {
+		mw.warn("message styles are not supported")
+	}
+	switch action.Arrow.Head {
+	case seqdiagram.BarbArrowHead, seqdiagram.LowerBarbArrowHead:
+		mw.warn("half arrow heads are not supported")
+	}
+	if action.Delay > 0 {
+		mw.warn("delayed messages are not supported")
+	}
+
+	arrow := arrowStemMapping[action.Arrow.Stem] + arrowHeadMapping[action.Arrow.Head]
+	if action.Arrow.TailHead {
+		if action.Arrow.Head == seqdiagram.OpenArrowHead {
+			mw.warn("open arrow heads at both ends are not supported")
+		} else {
+			arrow = "<<" + arrow
+		}
+	}
+	mw.println("%s%s%s: %s", mw.participantName(action.From), arrow, mw.participantName(action.To),
+		escapeText(action.Message))
+}
+
+func (mw *writer) writeActivation(activation *seqdiagram.Activation) {
+	if isOffside(activation.Actor) {
+		mw.warn("activations of the sides of the diagram are not supported")
+		return
+	}
+	mw.println("%s %s", activationKeywords[activation.Type], mw.participantName(activation.Actor))
+}
+
+func (mw *writer) writeNote(note *seqdiagram.Note) {
+	if len(mw.diagram.Actors) == 0 {
+		mw.warn("notes without any participants are not supported")
+		return
+	}
+
+	var position string
+	switch note.Align {
+	case seqdiagram.OverNoteAlignment:
+		first, last := mw.noteActors(note)
+		if first == last {
+			position = "over " + mw.participantName(first)
+		} else {
+			position = "over " + mw.participantName(first) + "," + mw.participantName(last)
+		}
+	case seqdiagram.LeftNoteAlignment:
+		first, _ := mw.noteActors(note)
+		position = "left of " + mw.participantName(first)
+	default:
+		_, last := mw.noteActors(note)
+		position = "right of " + mw.participantName(last)
+	}
+
+	if note.Shape != seqdiagram.RectNoteShape || note.Color != "" || note.BorderColor != "" || note.TextColor != "" {
+		mw.warn("note styles are not supported")
+	}
+	mw.println("Note %s: %s", position, escapeText(note.Message))
+}
+
+// Returns the leftmost and rightmost participants of a note.  Notes against the sides of
+// the diagram are placed against the outermost participants.
+func (mw *writer) noteActors(note *seqdiagram.Note) (*seqdiagram.Actor, *seqdiagram.Actor) {
+	first, last := note.Actor1, note.Actor2
+	if last == nil {
+		last = first
+	}
+	if mw.actorIndex(first) > mw.actorIndex(last) {
+		first, last = last, first
+	}
+
+	if isOffside(first) || isOffside(last) {
+		mw.warn("notes against the sides of the diagram are not supported")
+		first, last = mw.realActor(first), mw.realActor(last)
+	}
+	return first, last
+}
+
+// Returns the position of the actor from the left of the diagram
+func (mw *writer) actorIndex(actor *seqdiagram.Actor) int {
+	switch actor {
+	case seqdiagram.LeftOffsideActor:
+		return -1
+	case seqdiagram.RightOffsideActor:
+		return len(mw.diagram.Actors)
+	}
+
+	for i, a := range mw.diagram.Actors {
+		if a == actor {
+			return i
+		}
+	}
+	return -1
+}
+
+// Replaces offside actors with the outermost participant on that side
+func (mw *writer) realActor(actor *seqdiagram.Actor) *seqdiagram.Actor {
+	switch actor {
+	case seqdiagram.LeftOffsideActor:
+		return mw.diagram.Actors[0]
+	case seqdiagram.RightOffsideActor:
+		return mw.diagram.Actors[len(mw.diagram.Actors)-1]
+	}
+	return actor
+}
+
+// Writes a divider.  Mermaid has no dividers, so these are written as a note spanning
+// all the participants.
+func (mw *writer) writeDivider(divider *seqdiagram.Divider) {
+	if divider.Color != "" || divider.TextColor != "" {
+		mw.warn("divider colours are not supported")
+	}
+	switch {
+	case divider.Message == "":
+		mw.warn("dividers without a message are not supported")
+	case len(mw.diagram.Actors) == 0:
+		mw.warn("dividers without any participants are not supported")
+	case len(mw.diagram.Actors) == 1:
+		mw.println("Note over %s: %s", mw.participantName(mw.diagram.Actors[0]), escapeText(divider.Message))
+	default:
+		mw.println("Note over %s,%s: %s", mw.participantName(mw.diagram.Actors[0]),
+			mw.participantName(mw.diagram.Actors[len(mw.diagram.Actors)-1]), escapeText(divider.Message))
+	}
+}
+
+func (mw *writer) writeBlock(block *seqdiagram.Block) {
+	var firstKeyword string
+	for i, seg := range block.Segments {
+		if seg.FullWidth {
+			mw.warn("full width blocks are not supported")
+		}
+		if seg.Prefix != "" {
+			mw.warn("segment prefix \"%s\" is not supported", seg.Prefix)
+		}
+		if seg.Color != "" || seg.BorderColor != "" || seg.TabColor != "" || seg.LineStyle != seqdiagram.DashedBlockLine || seg.FontSize > 0 {
+			mw.warn("block styles are not supported")
+		}
+
+		keyword := segmentKeywords[seg.Type]
+		if i == 0 {
+			firstKeyword = keyword
+			if seg.Type == seqdiagram.EmptySegmentType {
+				mw.warn("blocks without a type are written as opt")
+			} else if name, isOpt := optSegmentNames[seg.Type]; isOpt {
+				mw.warn("%s blocks are written as opt", name)
+			}
+		} else if nextKeyword, hasNext := nextSegmentKeywords[firstKeyword]; hasNext {
+			keyword = nextKeyword
+		} else {
+			mw.warn("%s blocks can only have a single segment", firstKeyword)
+			keyword = "else"
+		}
+
+		if seg.Message != "" {
+			mw.println("%s %s", keyword, escapeText(seg.Message))
+		} else {
+			mw.println("%s", keyword)
+		}
+
+		mw.indent++
+		mw.writeItems(seg.SubItems)
+		mw.indent--
+	}
+	mw.println("end")
+}
+
+// Returns the name to use for the actor.  Characters which cannot be used in participant
+// names are replaced, with a suffix added if the result clashes with another participant.
+func (mw *writer) participantName(actor *seqdiagram.Actor) string {
+	if name, hasName := mw.names[actor]; hasName {
+		return name
+	}
+
+	base := invalidNameCharsRegexp.ReplaceAllString(actor.Name, "_")
+	if base == "" {
+		base = "_"
+	}
+
+	name := base
+	for n := 2; mw.nameInUse(name); n++ {
+		name = base + strconv.Itoa(n)
+	}
+
+	mw.names[actor] = name
+	return name
+}
+
+func (mw *writer) nameInUse(name string) bool {
+	for _, n := range mw.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isOffside(actor *seqdiagram.Actor) bool {
+	return actor == seqdiagram.LeftOffsideActor || actor == seqdiagram.RightOffsideActor
+}
+
+// Escapes text for use on a single line
+func escapeText(text string) string {
+	return textReplacer.Replace(text)
+}
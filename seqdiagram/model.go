@@ -4,8 +4,11 @@
 package seqdiagram
 
 import (
+	"errors"
+	"fmt"
 	"io"
 
+	"github.com/lmika/goseq/seqdiagram/graphbox"
 	"github.com/lmika/goseq/seqdiagram/parse"
 )
 
@@ -14,6 +17,7 @@ type Diagram struct {
 	ProcessingInstructions []*ProcessingInstruction
 	Title                  string
 	Actors                 []*Actor
+	Groups                 []*ActorGroup
 	Items                  []SequenceItem
 }
 
@@ -66,6 +70,51 @@ func (d *Diagram) GetOrAddActorWithOptions(name, label string) *Actor {
 	return na
 }
 
+// Adds a group of actors.  The actors of the group are moved so that they are adjacent,
+// in the order they appear in the group, starting at the position of the first of them.
+// An actor can only belong to one group.
+func (d *Diagram) AddActorGroup(group *ActorGroup) error {
+	if len(group.Actors) == 0 {
+		return errors.New("groups must contain at least one participant")
+	}
+
+	inGroup := make(map[*Actor]bool)
+	for _, actor := range group.Actors {
+		if actor.rank < 0 {
+			return errors.New("only participants can be added to a group")
+		} else if inGroup[actor] {
+			return fmt.Errorf("participant '%s' is added to the group more than once", actor.Name)
+		}
+		for _, g := range d.Groups {
+			for _, a := range g.Actors {
+				if a == actor {
+					return fmt.Errorf("participant '%s' is already within a group", actor.Name)
+				}
+			}
+		}
+		inGroup[actor] = true
+	}
+
+	// Rebuild the actor slice with the group placed at the first of its actors
+	actors := make([]*Actor, 0, len(d.Actors))
+	placed := false
+	for _, actor := range d.Actors {
+		if !inGroup[actor] {
+			actors = append(actors, actor)
+		} else if !placed {
+			actors = append(actors, group.Actors...)
+			placed = true
+		}
+	}
+	for i, actor := range actors {
+		actor.rank = i
+	}
+	d.Actors = actors
+
+	d.Groups = append(d.Groups, group)
+	return nil
+}
+
 // Adds a new sequence item
 func (d *Diagram) AddSequenceItem(item SequenceItem) {
 	d.Items = append(d.Items, item)
@@ -91,6 +140,68 @@ func (d *Diagram) WriteSVGWithOptions(w io.Writer, options *ImageOptions) error
 	return nil
 }
 
+// Write the diagram as a PNG image
+func (d *Diagram) WritePNG(w io.Writer) error {
+	return d.WritePNGWithOptions(w, DefaultOptions)
+}
+
+// Write the diagram as a PNG image using a specific style.  The image is drawn
+// natively and does not require any external tools.
+func (d *Diagram) WritePNGWithOptions(w io.Writer, options *ImageOptions) error {
+	gb, err := newGraphicBuilder(d, options.Style)
+	if err != nil {
+		return err
+	}
+
+	return gb.buildGraphic().DrawPNG(w)
+}
+
+// Write the diagram as a PDF document
+func (d *Diagram) WritePDF(w io.Writer) error {
+	return d.WritePDFWithOptions(w, DefaultOptions)
+}
+
+// Write the diagram as a single page PDF document using a specific style.  Shapes are
+// drawn as vectors and the fonts are embedded in the document.
+func (d *Diagram) WritePDFWithOptions(w io.Writer, options *ImageOptions) error {
+	gb, err := newGraphicBuilder(d, options.Style)
+	if err != nil {
+		return err
+	}
+
+	return gb.buildGraphic().DrawPDF(w)
+}
+
+// Lays out the diagram as a graphic using a specific style.  The graphic can be drawn
+// onto a canvas of any format with its Measure and Draw methods.
+func (d *Diagram) BuildGraphic(options *ImageOptions) (*graphbox.Graphic, error) {
+	gb, err := newGraphicBuilder(d, options.Style)
+	if err != nil {
+		return nil, err
+	}
+
+	return gb.buildGraphic(), nil
+}
+
+// Write the diagram as text art, using Unicode box drawing characters for the lines
+func (d *Diagram) WriteText(w io.Writer) error {
+	return d.writeTextArt(w, false)
+}
+
+// Write the diagram as text art, using only ASCII characters for the lines
+func (d *Diagram) WriteASCII(w io.Writer) error {
+	return d.writeTextArt(w, true)
+}
+
+func (d *Diagram) writeTextArt(w io.Writer, asciiOnly bool) error {
+	gb, err := newGraphicBuilder(d, TextArtStyle)
+	if err != nil {
+		return err
+	}
+
+	return gb.buildGraphic().DrawText(w, asciiOnly)
+}
+
 // Options for SVG image generation
 type ImageOptions struct {
 	// The diagram style
@@ -128,10 +239,57 @@ type Actor struct {
 	rank int
 }
 
+// A group of adjacent participants, drawn with a box around them
+type ActorGroup struct {
+	Label string
+	Color string
+
+	Actors []*Actor
+}
+
 // Special actors
 var LeftOffsideActor *Actor = &Actor{rank: -1}
 var RightOffsideActor *Actor = &Actor{rank: -2}
 
+// Special actors for lost and found messages.  Lost messages end at a circle to the right
+// of the sending actor, and found messages start at a circle to the left of the receiving
+// actor.
+var LostActor *Actor = &Actor{rank: -3}
+var FoundActor *Actor = &Actor{rank: -4}
+
+// Returns true if the actor is the end of a lost or found message
+func isLostOrFound(actor *Actor) bool {
+	return actor == LostActor || actor == FoundActor
+}
+
+// Returns an error if an action between the actors is not a valid lost or found message.
+// Lost messages must be sent by a participant, and found messages must be received by one.
+func checkLostAndFound(from, to *Actor) error {
+	switch {
+	case from == LostActor || to == FoundActor:
+		return errors.New("messages can only be sent to lost and received from found")
+	case to == LostActor && from.rank < 0, from == FoundActor && to.rank < 0:
+		return errors.New("lost and found messages must be sent or received by a participant")
+	}
+	return nil
+}
+
+// Returns an error if the delay of an action is invalid.  Only messages between two
+// different lifelines, or the sides of the diagram, can be delayed.
+func checkDelay(action *Action) error {
+	switch {
+	case action.Delay < 0:
+		return errors.New("the delay of a message cannot be negative")
+	case action.Delay == 0:
+		return nil
+	case isLostOrFound(action.From) || isLostOrFound(action.To):
+		return errors.New("lost and found messages cannot be delayed")
+	case action.From == action.To:
+		return errors.New("messages to the sending participant cannot be delayed")
+	}
+	return nil
+}
+
 // The supported arrow stems
 type ArrowStem int
 
@@ -155,6 +313,9 @@ const (
 type Arrow struct {
 	Stem ArrowStem
 	Head ArrowHead
+
+	// If true, the arrow also has a head at its tail
+	TailHead bool
 }
 
 // Note alignments
@@ -166,6 +327,17 @@ const (
 	OverNoteAlignment                = iota
 )
 
+// Note shapes
+type NoteShape int
+
+const (
+	RectNoteShape NoteShape = iota
+	FoldedNoteShape
+	RoundedNoteShape
+	HexagonNoteShape
+	CloudNoteShape
+)
+
 // A sequence item
 type SequenceItem interface{}
 
@@ -179,6 +351,26 @@ type Note struct {
 
 	// The message
 	Message string
+
+	// The shape of the note and its fill, border and text colours.  If empty, the note
+	// is filled with white and drawn in black.
+	Shape       NoteShape
+	Color       string
+	BorderColor string
+	TextColor   string
+}
+
+// A reference to another interaction, drawn as a frame over the lifelines of the actors
+// from Actor1 to Actor2.  Both actors are the same if the reference is over one actor.
+type Ref struct {
+	Actor1 *Actor
+	Actor2 *Actor
+
+	// The message
+	Message string
+
+	// If not empty, the URL the frame links to in SVG output
+	Link string
 }
 
 // Defines an action
@@ -194,6 +386,88 @@ type Action struct {
 
 	// The message
 	Message string
+
+	// The number of rows after the message is sent that it arrives.  Delayed messages are
+	// drawn as a sloped arrow, and the items following it are placed in the rows it spans.
+	Delay int
+
+	// The colour of the arrow and the message.  If empty, these are drawn in black.
+	Color     string
+	TextColor string
+
+	// The width of the arrow stem.  If zero, the width of the style is used.
+	Width int
+}
+
+// The type of activation change
+type ActivationType int
+
+const (
+	// Starts a new activation of the actor
+	StartActivation ActivationType = iota
+
+	// Ends the most recent activation of the actor
+	EndActivation
+)
+
+// Defines the start or end of an activation of an actor.  An actor is active while it
+// is handling a call, and this is drawn as a bar over the lifeline.  Activations can be
+// nested, in which case the bars are stacked.
+type Activation struct {
+	// The actor
+	Actor *Actor
+
+	// Whether the activation is started or ended
+	Type ActivationType
+}
+
+// Defines the creation of an actor part way through the diagram.  The actor box is drawn
+// at the row of the item following the creation, which is usually the message creating
+// the actor, and the lifeline starts from there.
+type Creation struct {
+	// The actor
+	Actor *Actor
+}
+
+// Defines the destruction of an actor.  The lifeline ends with a cross at the row of the
+// item preceding the destruction, which is usually the message destroying the actor.
+type Destruction struct {
+	// The actor
+	Actor *Actor
+}
+
+// The type of change to the automatic numbering of actions
+type AutoNumberType int
+
+const (
+	// Starts numbering the actions, or restarts numbering from a new start value
+	StartAutoNumber AutoNumberType = iota
+
+	// Stops numbering the actions
+	StopAutoNumber
+
+	// Resumes numbering the actions from where it was stopped
+	ResumeAutoNumber
+)
+
+// Defines a change to the automatic numbering of actions.  Numbered actions are drawn with
+// the number in a badge next to the message.
+type AutoNumber struct {
+	// Whether numbering is started, stopped or resumed
+	Type AutoNumberType
+
+	// The first number and the amount to increase each number by.  These are only used
+	// when numbering is started.
+	Start int
+	Step  int
+
+	// The format of the number, in which '#' is replaced by the number.  If empty, the
+	// number is used as is.
+	Format string
+
+	// If true, the actions within blocks are numbered beneath the number of the
+	// block, such as 3.1, 3.2, etc.
+	Nested bool
 }
 
 type DividerType int
@@ -212,6 +486,11 @@ type Divider struct {
 
 	// The divider type
 	Type DividerType
+
+	// The colour of the line or frame and the colour of the message.  If empty, these are
+	// drawn in black.
+	Color     string
+	TextColor string
 }
 
 // A framed block of sequence items.  Each block can have one or more segments,
@@ -272,9 +551,28 @@ const (
 	// of a concurrent block.
 	ConcurrentWhilstSegmentType
 
+	// The UML critical, break, neg, ignore, consider, assert, strict and seq segments
+	CriticalSegmentType
+	BreakSegmentType
+	NegSegmentType
+	IgnoreSegmentType
+	ConsiderSegmentType
+	AssertSegmentType
+	StrictSegmentType
+	SeqSegmentType
+
 	EmptySegmentType
 )
 
+// The line style of the frame of a block
+type BlockLineStyle int
+
+const (
+	DashedBlockLine BlockLineStyle = iota
+	DottedBlockLine
+	SolidBlockLine
+)
+
 // A segment within a block
 type BlockSegment struct {
 	Type      SegmentType
@@ -282,6 +580,20 @@ type BlockSegment struct {
 	Message   string
 	FullWidth bool
 	SubItems  []SequenceItem
+
+	// The messages of an ignore or consider segment
+	Messages []string
+
+	// The fill colour, the colour of the frame and the fill colour of the prefix.  If empty,
+	// the frame is drawn in black and nested blocks are filled with alternating colours.
+	Color       string
+	BorderColor string
+	TabColor    string
+	LineStyle   BlockLineStyle
+
+	// The font size of the prefix and message.  If zero, the font size of the diagram
+	// style is used.
+	FontSize int
 }
 
 // Returns the number of nested blocks
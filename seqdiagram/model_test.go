@@ -0,0 +1,53 @@
+package seqdiagram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lmika/goseq/seqdiagram/graphbox"
+)
+
+// A canvas which records the text drawn onto it
+type textRecordingCanvas struct {
+	texts []string
+}
+
+func (rc *textRecordingCanvas) Line(x1, y1, x2, y2 int, style string)         {}
+func (rc *textRecordingCanvas) Polyline(xs, ys []int, style string)           {}
+func (rc *textRecordingCanvas) Polygon(xs, ys []int, style string)            {}
+func (rc *textRecordingCanvas) Rect(x, y, w, h int, style string)             {}
+func (rc *textRecordingCanvas) Circle(x, y, r int, style string)              {}
+func (rc *textRecordingCanvas) Path(d string, transform string, style string) {}
+func (rc *textRecordingCanvas) Group(style string)                            {}
+func (rc *textRecordingCanvas) GroupEnd()                                     {}
+func (rc *textRecordingCanvas) StartLink(url string)                          {}
+func (rc *textRecordingCanvas) EndLink()                                      {}
+
+func (rc *textRecordingCanvas) Text(x, y int, text string, style graphbox.TextStyle) {
+	rc.texts = append(rc.texts, text)
+}
+
+func TestBuildGraphicDrawsOntoCanvas(t *testing.T) {
+	d, err := ParseDiagram(strings.NewReader("Client->Server: Request\n"), "test.seq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := d.BuildGraphic(DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w, h := g.Measure(); w <= 0 || h <= 0 {
+		t.Fatalf("want a non-empty graphic, got %dx%d", w, h)
+	}
+
+	canvas := new(textRecordingCanvas)
+	g.Draw(canvas)
+
+	want := []string{"Client", "Client", "Server", "Server", "Request"}
+	if !reflect.DeepEqual(canvas.texts, want) {
+		t.Errorf("want text %q, got %q", want, canvas.texts)
+	}
+}
@@ -0,0 +1,327 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var formatArrowStems = map[ArrowStemType]string{
+	SOLID_ARROW_STEM:  "-",
+	DASHED_ARROW_STEM: "--",
+	THICK_ARROW_STEM:  "=",
+}
+
+var formatArrowHeads = map[ArrowHeadType]string{
+	SOLID_ARROW_HEAD:        ">",
+	OPEN_ARROW_HEAD:         ">>",
+	BARBED_ARROW_HEAD:       "\\>",
+	LOWER_BARBED_ARROW_HEAD: "/>",
+}
+
+// formatArrow returns the arrow as it is written in the source.
+func formatArrow(arrow ArrowType) string {
+	switch {
+	case arrow.Reversed:
+		return "<" + formatArrowStems[arrow.Stem]
+	case arrow.Tail:
+		return "<" + formatArrowStems[arrow.Stem] + formatArrowHeads[arrow.Head]
+	default:
+		return formatArrowStems[arrow.Stem] + formatArrowHeads[arrow.Head]
+	}
+}
+
+var formatActionActivations = map[ActionActivation]string{
+	NO_ACTION_ACTIVATION: "",
+	ACTIVATE_TARGET:      "+",
+	DEACTIVATE_SOURCE:    "-",
+}
+
+var formatActivationTypes = map[ActivationType]string{
+	ACTIVATE:   "activate",
+	DEACTIVATE: "deactivate",
+}
+
+var formatAutoNumberTypes = map[AutoNumberType]string{
+	AUTONUMBER_START:  "autonumber",
+	AUTONUMBER_STOP:   "autonumber stop",
+	AUTONUMBER_RESUME: "autonumber resume",
+}
+
+var formatNotePositions = map[NoteAlignment]string{
+	LEFT_NOTE_ALIGNMENT:  "left of",
+	RIGHT_NOTE_ALIGNMENT: "right of",
+	OVER_NOTE_ALIGNMENT:  "over",
+}
+
+var formatGapTypes = map[GapType]string{
+	SPACER_GAP: "spacer",
+	EMPTY_GAP:  "gap",
+	LINE_GAP:   "line",
+	FRAME_GAP:  "frame",
+}
+
+// Keywords of the first segment of a block
+var formatBlockKeywords = map[SegmentType]string{
+	ALT_SEGMENT:        "alt",
+	PAR_SEGMENT:        "par",
+	OPT_SEGMENT:        "opt",
+	LOOP_SEGMENT:       "loop",
+	CONCURRENT_SEGMENT: "concurrent",
+	CRITICAL_SEGMENT:   "critical",
+	BREAK_SEGMENT:      "break",
+	NEG_SEGMENT:        "neg",
+	IGNORE_SEGMENT:     "ignore",
+	CONSIDER_SEGMENT:   "consider",
+	ASSERT_SEGMENT:     "assert",
+	STRICT_SEGMENT:     "strict",
+	SEQ_SEGMENT:        "seq",
+	NONE_SEGMENT:       "block",
+}
+
+// Keywords of the second and subsequent segments of a block
+var formatSegmentKeywords = map[SegmentType]string{
+	ALT_SEGMENT:               "elsealt",
+	ALT_ELSE_SEGMENT:          "else",
+	PAR_SEGMENT:               "elsepar",
+	PAR_ELSE_SEGMENT:          "else",
+	CONCURRENT_WHILST_SEGMENT: "whilst",
+}
+
+// Characters which must be escaped in messages
+var messageEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\n", "\\n",
+)
+
+// Format writes the node list as canonical diagram source.  Block segments are indented
+// by four spaces, attribute lists are written on a single line and multiple blank lines
+// are collapsed into one.  Comments and blank lines are kept if the node list was
+// produced by ParseWithComments.
+func Format(w io.Writer, nodeList *NodeList) error {
+	f := &formatter{}
+	f.formatNodes(nodeList)
+
+	// Drop any trailing blank lines
+	lines := f.lines
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+type formatter struct {
+	lines  []string
+	indent int
+}
+
+// Adds a line to the output
+func (f *formatter) println(format string, args ...interface{}) {
+	f.lines = append(f.lines, strings.Repeat("    ", f.indent)+fmt.Sprintf(format, args...))
+}
+
+// Adds a blank line to the output, unless the previous line is blank
+func (f *formatter) printBlankLine() {
+	if len(f.lines) == 0 || f.lines[len(f.lines)-1] == "" {
+		return
+	}
+	f.lines = append(f.lines, "")
+}
+
+// Appends text to the last line of output
+func (f *formatter) appendToLine(text string) {
+	if len(f.lines) == 0 {
+		f.println("%s", text)
+		return
+	}
+	f.lines[len(f.lines)-1] += " " + text
+}
+
+func (f *formatter) formatNodes(nodeList *NodeList) {
+	for nl := nodeList; nl != nil; nl = nl.Tail {
+		// Blank lines at the start or end of a block segment are dropped
+		if _, isBlank := nl.Head.(*BlankLineNode); isBlank && (nl == nodeList || nl.Tail == nil) {
+			continue
+		}
+		f.formatNode(nl.Head)
+	}
+}
+
+func (f *formatter) formatNode(node Node) {
+	switch n := node.(type) {
+	case *CommentNode:
+		if n.Trailing {
+			f.appendToLine(n.Text)
+		} else {
+			f.println("%s", n.Text)
+		}
+	case *BlankLineNode:
+		f.printBlankLine()
+	case *ProcessInstructionNode:
+		f.println("#!%s %s", n.Prefix, n.Value)
+	case *IncludeNode:
+		f.println("include %s", strconv.Quote(n.Path))
+	case *TitleNode:
+		f.println("title%s", formatMessage(n.Title))
+	case *StyleNode:
+		f.println("style %s %s", n.Name, formatAttributes(n.Attributes))
+	case *ActorNode:
+		line := "participant " + n.Ident
+		if n.Attributes != nil {
+			line += " " + formatAttributes(n.Attributes)
+		}
+		if n.HasDescr {
+			line += formatMessage(n.Descr)
+		}
+		f.println("%s", line)
+	case *ActionNode:
+		creation := ""
+		if n.Create {
+			creation = "*"
+		}
+		delay := ""
+		if n.Delay > 0 {
+			delay = fmt.Sprintf("(%d)", n.Delay)
+		}
+		attrs := ""
+		if n.Attributes != nil {
+			attrs = " " + formatAttributes(n.Attributes)
+		}
+		f.println("%s%s%s%s%s%s%s%s", formatActorRef(n.From), formatArrow(n.Arrow), creation, formatActionActivations[n.Activation], delay,
+			formatActorRef(n.To), attrs, formatMessage(n.Descr))
+	case *ActivationNode:
+		f.println("%s %s", formatActivationTypes[n.Type], formatActorRef(n.Actor))
+	case *CreateNode:
+		f.println("create %s", formatActorRef(n.Actor))
+	case *DestroyNode:
+		f.println("destroy %s", formatActorRef(n.Actor))
+	case *AutoNumberNode:
+		line := formatAutoNumberTypes[n.Type]
+		if n.Attributes != nil {
+			line += " " + formatAttributes(n.Attributes)
+		}
+		f.println("%s", line)
+	case *NoteNode:
+		actors := formatActorRef(n.Actor1)
+		if n.Actor2 != nil {
+			actors += ", " + formatActorRef(n.Actor2)
+		}
+		if n.Attributes != nil {
+			actors += " " + formatAttributes(n.Attributes)
+		}
+		f.println("note %s %s%s", formatNotePositions[n.Position], actors, formatMessage(n.Descr))
+	case *RefNode:
+		actors := formatActorRef(n.Actor1)
+		if n.Actor2 != nil {
+			actors += ", " + formatActorRef(n.Actor2)
+		}
+		if n.Attributes != nil {
+			actors += " " + formatAttributes(n.Attributes)
+		}
+		f.println("ref over %s%s", actors, formatMessage(n.Descr))
+	case *GapNode:
+		line := "horizontal " + formatGapTypes[n.Type]
+		if n.Attributes != nil {
+			line += " " + formatAttributes(n.Attributes)
+		}
+		if n.Descr != "" {
+			line += formatMessage(n.Descr)
+		}
+		f.println("%s", line)
+	case *BlockNode:
+		f.formatBlock(n)
+	case *BoxNode:
+		line := "box"
+		if n.Label != "" {
+			line += " " + strconv.Quote(n.Label)
+		}
+		if n.Attributes != nil {
+			line += " " + formatAttributes(n.Attributes)
+		}
+		f.println("%s", line)
+
+		f.indent++
+		f.formatNodes(n.SubNodes)
+		f.indent--
+		f.println("end")
+	case *DefineNode:
+		f.println("define %s(%s)", n.Name, strings.Join(n.Params, ", "))
+
+		f.indent++
+		f.formatNodes(n.SubNodes)
+		f.indent--
+		f.println("end")
+	case *UseNode:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = formatActorRef(arg)
+		}
+		line := fmt.Sprintf("use %s(%s)", n.Name, strings.Join(args, ", "))
+		if n.Attributes != nil {
+			line += " " + formatAttributes(n.Attributes)
+		}
+		if n.Descr != "" {
+			line += formatMessage(n.Descr)
+		}
+		f.println("%s", line)
+	}
+}
+
+func (f *formatter) formatBlock(block *BlockNode) {
+	for sl := block.Segments; sl != nil; sl = sl.Tail {
+		seg := sl.Head
+
+		keyword := formatSegmentKeywords[seg.Type]
+		if sl == block.Segments {
+			keyword = formatBlockKeywords[seg.Type]
+		}
+		if len(seg.Messages) > 0 {
+			keyword += " " + strings.Join(seg.Messages, ", ")
+		}
+		if seg.AttributeList != nil {
+			keyword += " " + formatAttributes(seg.AttributeList)
+		}
+		f.println("%s%s", keyword, formatMessage(seg.Message))
+
+		f.indent++
+		f.formatNodes(seg.SubNodes)
+		f.indent--
+	}
+	f.println("end")
+}
+
+// Returns the attribute list in the form '(name="value", ...)'
+func formatAttributes(attrs *AttributeList) string {
+	parts := make([]string, 0)
+	for al := attrs; al != nil; al = al.Tail {
+		parts = append(parts, al.Head.Name+"="+strconv.Quote(al.Head.Value))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func formatActorRef(ref ActorRef) string {
+	switch r := ref.(type) {
+	case NormalActorRef:
+		return string(r)
+	case PseudoActorRef:
+		return string(r)
+	}
+	return ""
+}
+
+// Returns the message, including the leading colon
+func formatMessage(msg string) string {
+	if msg == "" {
+		return ":"
+	}
+	return ": " + messageEscaper.Replace(msg)
+}
@@ -8,9 +8,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 var DualRunes = map[string]int{
@@ -21,25 +24,36 @@ var DualRunes = map[string]int{
 	"-":  DASH,
 	"=":  EQUAL,
 
+	"<": ANGL,
+
 	">>":  DOUBLEANGR,
 	">":   ANGR,
 	"/>":  SLASHANGR,
 	"\\>": BACKSLASHANGR,
+
+	"+": PLUS,
+	"*": STAR,
 }
 
 type yySymType struct {
-	yys          int
-	nodeList     *NodeList
-	node         Node
-	arrow        ArrowType
-	arrowStem    ArrowStemType
-	arrowHead    ArrowHeadType
-	actorRef     ActorRef
-	noteAlign    NoteAlignment
-	dividerType  GapType
-	blockSegList *BlockSegmentList
-	attrList     *AttributeList
-	attr         *Attribute
+	yys              int
+	nodeList         *NodeList
+	node             Node
+	arrow            ArrowType
+	arrowStem        ArrowStemType
+	arrowHead        ArrowHeadType
+	actorRef         ActorRef
+	noteAlign        NoteAlignment
+	dividerType      GapType
+	actionActivation ActionActivation
+	bval             bool
+	ival             int
+	blockSegList     *BlockSegmentList
+	attrList         *AttributeList
+	attr             *Attribute
+	idents           []string
+	actorRefs        []ActorRef
+	segmentType      SegmentType
 
 	sval string
 }
@@ -68,20 +82,49 @@ const K_PAR = 57366
 const K_ELSEPAR = 57367
 const K_CONCURRENT = 57368
 const K_WHILST = 57369
-const DASH = 57370
-const DOUBLEDASH = 57371
-const DOT = 57372
-const EQUAL = 57373
-const COMMA = 57374
-const ANGR = 57375
-const DOUBLEANGR = 57376
-const BACKSLASHANGR = 57377
-const SLASHANGR = 57378
-const PARL = 57379
-const PARR = 57380
-const STRING = 57381
-const MESSAGE = 57382
-const IDENT = 57383
+const K_ACTIVATE = 57370
+const K_DEACTIVATE = 57371
+const K_CREATE = 57372
+const K_DESTROY = 57373
+const K_AUTONUMBER = 57374
+const K_STOP = 57375
+const K_RESUME = 57376
+const K_LOST = 57377
+const K_FOUND = 57378
+const K_BOX = 57379
+const K_REF = 57380
+const K_INCLUDE = 57381
+const K_DEFINE = 57382
+const K_USE = 57383
+const K_CRITICAL = 57384
+const K_BREAK = 57385
+const K_NEG = 57386
+const K_IGNORE = 57387
+const K_CONSIDER = 57388
+const K_ASSERT = 57389
+const K_STRICT = 57390
+const K_SEQ = 57391
+const DASH = 57392
+const DOUBLEDASH = 57393
+const DOT = 57394
+const EQUAL = 57395
+const COMMA = 57396
+const PLUS = 57397
+const STAR = 57398
+const ANGL = 57399
+const ANGR = 57400
+const DOUBLEANGR = 57401
+const BACKSLASHANGR = 57402
+const SLASHANGR = 57403
+const PARL = 57404
+const PARR = 57405
+const BLANKLINE = 57406
+const STRING = 57407
+const MESSAGE = 57408
+const IDENT = 57409
+const INT = 57410
+const COMMENT = 57411
+const TRAILINGCOMMENT = 57412
 
 var yyToknames = [...]string{
 	"$end",
@@ -111,20 +154,49 @@ var yyToknames = [...]string{
 	"K_ELSEPAR",
 	"K_CONCURRENT",
 	"K_WHILST",
+	"K_ACTIVATE",
+	"K_DEACTIVATE",
+	"K_CREATE",
+	"K_DESTROY",
+	"K_AUTONUMBER",
+	"K_STOP",
+	"K_RESUME",
+	"K_LOST",
+	"K_FOUND",
+	"K_BOX",
+	"K_REF",
+	"K_INCLUDE",
+	"K_DEFINE",
+	"K_USE",
+	"K_CRITICAL",
+	"K_BREAK",
+	"K_NEG",
+	"K_IGNORE",
+	"K_CONSIDER",
+	"K_ASSERT",
+	"K_STRICT",
+	"K_SEQ",
 	"DASH",
 	"DOUBLEDASH",
 	"DOT",
 	"EQUAL",
 	"COMMA",
+	"PLUS",
+	"STAR",
+	"ANGL",
 	"ANGR",
 	"DOUBLEANGR",
 	"BACKSLASHANGR",
 	"SLASHANGR",
 	"PARL",
 	"PARR",
+	"BLANKLINE",
 	"STRING",
 	"MESSAGE",
 	"IDENT",
+	"INT",
+	"COMMENT",
+	"TRAILINGCOMMENT",
 }
 
 var yyStatenames = [...]string{}
@@ -141,36 +213,152 @@ type parseState struct {
 	//diagram     *Diagram
 	procInstrs []string
 	nodeList   *NodeList
+
+	// When true, comments and blank lines are returned as tokens
+	keepComments bool
+	parenDepth   int
+	tokLine      int
+	prevTokLine  int
+	lastTok      int
+	lastLine     int
+	pending      []pendingToken
+
+	// The line of the last autonumber keyword
+	autoNumberLine int
+
+	// The files including this one, from the innermost include statement outwards, and
+	// any error parsing an included file
+	includedFrom []includePos
+	includeErr   error
 }
 
-func newParseState(src io.Reader, filename string) *parseState {
-	ps := &parseState{}
+// The position of an include statement
+type includePos struct {
+	filename string
+	path     string // The absolute path of the file, used to detect cycles
+	line     int
+}
+
+// A token which is to be returned by the next call to Lex
+type pendingToken struct {
+	tok  int
+	sval string
+	ival int
+}
+
+// Tokens which can end a declaration
+var declEndTokens = map[int]bool{
+	MESSAGE: true, PARR: true, IDENT: true, K_END: true, K_BOX: true, STRING: true,
+	K_SPACER: true, K_GAP: true, K_LINE: true, K_FRAME: true,
+	K_AUTONUMBER: true, K_STOP: true, K_RESUME: true,
+	COMMENT: true, TRAILINGCOMMENT: true,
+}
+
+// Tokens which can start a declaration or a block segment
+var declStartTokens = map[int]bool{
+	IDENT: true, K_LEFT: true, K_RIGHT: true, K_LOST: true, K_FOUND: true,
+	K_TITLE: true, K_PARTICIPANT: true, K_NOTE: true, K_STYLE: true, K_HORIZONTAL: true,
+	K_BLOCK: true, K_ALT: true, K_ELSEALT: true, K_ELSE: true, K_END: true, K_LOOP: true,
+	K_OPT: true, K_PAR: true, K_ELSEPAR: true, K_CONCURRENT: true, K_WHILST: true,
+	K_ACTIVATE: true, K_DEACTIVATE: true, K_CREATE: true, K_DESTROY: true,
+	K_AUTONUMBER: true, K_BOX: true, K_REF: true, K_INCLUDE: true,
+	K_DEFINE: true, K_USE: true, K_CRITICAL: true, K_BREAK: true, K_NEG: true, K_IGNORE: true,
+	K_CONSIDER: true, K_ASSERT: true, K_STRICT: true, K_SEQ: true, COMMENT: true,
+}
+
+func newParseState(src io.Reader, filename string, keepComments bool) *parseState {
+	ps := &parseState{keepComments: keepComments}
 	ps.S.Init(src)
 	ps.S.Position.Filename = filename
 	//    ps.diagram = &Diagram{}
 
+	if keepComments {
+		ps.S.Mode &^= scanner.SkipComments
+	}
+
 	return ps
 }
 
 func (ps *parseState) Lex(lval *yySymType) int {
+	if len(ps.pending) > 0 {
+		pt := ps.pending[0]
+		ps.pending = ps.pending[1:]
+		lval.sval = pt.sval
+		lval.ival = pt.ival
+		return pt.tok
+	}
+
+	tok := ps.scanToken(lval)
+	ps.prevTokLine = ps.tokLine
+	if ps.keepComments && tok != 0 {
+		return ps.layoutToken(tok, lval)
+	}
+	return tok
+}
+
+// Tracks the layout of the source when keeping comments.  Comments which follow a
+// declaration on the same line are returned as trailing comments, and blank lines between
+// declarations are returned before the token following them.
+func (ps *parseState) layoutToken(tok int, lval *yySymType) int {
+	startLine := ps.tokLine
+	endLine := startLine
+
+	switch tok {
+	case COMMENT:
+		endLine += strings.Count(lval.sval, "\n")
+		if ps.lastLine > 0 && startLine == ps.lastLine {
+			tok = TRAILINGCOMMENT
+		}
+	}
+
+	isBlank := ps.lastLine > 0 && startLine > ps.lastLine+1 && ps.parenDepth == 0 &&
+		declEndTokens[ps.lastTok] && declStartTokens[tok]
+	ps.lastTok, ps.lastLine = tok, endLine
+
+	if isBlank {
+		ps.pending = append(ps.pending, pendingToken{tok, lval.sval, lval.ival})
+		return BLANKLINE
+	}
+	return tok
+}
+
+func (ps *parseState) scanToken(lval *yySymType) int {
 	if ps.atEof {
 		return 0
 	}
 	for {
 		tok := ps.S.Scan()
+		ps.tokLine = ps.S.Position.Line
+
 		switch tok {
 		case scanner.EOF:
 			ps.atEof = true
 			return 0
-		case '#':
-			ps.scanComment()
+		case '#', scanner.Comment:
+			var text string
+			if tok == '#' {
+				text = ps.scanComment()
+			} else {
+				text = ps.S.TokenText()
+			}
+
+			if !ps.keepComments {
+				// Discard the comment
+			} else if ps.parenDepth > 0 {
+				ps.Error("Comments within attribute lists cannot be kept")
+			} else {
+				lval.sval = text
+				return COMMENT
+			}
 		case ':':
 			return ps.scanMessage(lval)
 		case '(':
+			ps.parenDepth++
 			return PARL
 		case ')':
+			ps.parenDepth--
 			return PARR
-		case '-', '>', '*', '=', '/', '\\', '.', ',':
+		case '-', '<', '>', '*', '=', '/', '\\', '.', ',', '+':
 			if res, isTok := ps.handleDoubleRune(tok); isTok {
 				return res
 			} else {
@@ -184,6 +372,14 @@ func (ps *parseState) Lex(lval *yySymType) int {
 			} else {
 				ps.Error("Invalid string: " + scanner.TokenString(tok) + ": " + err.Error())
 			}
+		case scanner.Int:
+			tokVal := ps.S.TokenText()
+			if res, err := strconv.Atoi(tokVal); err == nil {
+				lval.ival = res
+				return INT
+			} else {
+				ps.Error("Invalid number: " + tokVal)
+			}
 		case scanner.Ident:
 			return ps.scanKeywordOrIdent(lval)
 		default:
@@ -226,6 +422,16 @@ func (ps *parseState) scanKeywordOrIdent(lval *yySymType) int {
 		return K_LEFT
 	case "right":
 		return K_RIGHT
+	case "lost", "found":
+		// These are only keywords in lower case, so that participants named "Lost" or
+		// "Found" are not drawn as lost or found messages
+		if tokVal == "lost" {
+			return K_LOST
+		} else if tokVal == "found" {
+			return K_FOUND
+		}
+		lval.sval = tokVal
+		return IDENT
 	case "over":
 		return K_OVER
 	case "of":
@@ -238,6 +444,18 @@ func (ps *parseState) scanKeywordOrIdent(lval *yySymType) int {
 		return K_FRAME
 	case "block":
 		return K_BLOCK
+	case "box":
+		return ps.statementKeyword(tokVal, K_BOX, lval)
+	case "ref":
+		return ps.statementKeyword(tokVal, K_REF, lval)
+	case "include":
+		return ps.statementKeyword(tokVal, K_INCLUDE, lval)
+	case "define":
+		lval.ival = ps.S.Position.Line
+		return ps.statementKeyword(tokVal, K_DEFINE, lval)
+	case "use":
+		lval.ival = ps.S.Position.Line
+		return ps.statementKeyword(tokVal, K_USE, lval)
 	case "line":
 		return K_LINE
 	case "style":
@@ -258,18 +476,83 @@ func (ps *parseState) scanKeywordOrIdent(lval *yySymType) int {
 		return K_END
 	case "loop":
 		return K_LOOP
+	case "critical":
+		return ps.statementKeyword(tokVal, K_CRITICAL, lval)
+	case "break":
+		return ps.statementKeyword(tokVal, K_BREAK, lval)
+	case "neg":
+		return ps.statementKeyword(tokVal, K_NEG, lval)
+	case "ignore":
+		return ps.statementKeyword(tokVal, K_IGNORE, lval)
+	case "consider":
+		return ps.statementKeyword(tokVal, K_CONSIDER, lval)
+	case "assert":
+		return ps.statementKeyword(tokVal, K_ASSERT, lval)
+	case "strict":
+		return ps.statementKeyword(tokVal, K_STRICT, lval)
+	case "seq":
+		return ps.statementKeyword(tokVal, K_SEQ, lval)
 	case "opt":
 		return K_OPT
 	case "concurrent":
 		return K_CONCURRENT
 	case "whilst":
 		return K_WHILST
+	case "activate":
+		return ps.statementKeyword(tokVal, K_ACTIVATE, lval)
+	case "deactivate":
+		return ps.statementKeyword(tokVal, K_DEACTIVATE, lval)
+	case "create":
+		return ps.statementKeyword(tokVal, K_CREATE, lval)
+	case "destroy":
+		return ps.statementKeyword(tokVal, K_DESTROY, lval)
+	case "autonumber":
+		tok := ps.statementKeyword(tokVal, K_AUTONUMBER, lval)
+		if tok == K_AUTONUMBER {
+			ps.autoNumberLine = ps.tokLine
+		}
+		return tok
+	case "stop", "resume":
+		// These are only keywords when they follow autonumber on the same line, so that
+		// they can still be used as actor names
+		if ps.tokLine == ps.autoNumberLine {
+			if strings.ToLower(tokVal) == "stop" {
+				return K_STOP
+			}
+			return K_RESUME
+		}
+		lval.sval = tokVal
+		return IDENT
 	default:
 		lval.sval = tokVal
 		return IDENT
 	}
 }
 
+// Returns the keyword token if the identifier starts a statement which is not a message,
+// otherwise returns the identifier.  This allows keywords added to the language later to
+// still be used as participant names.
+func (ps *parseState) statementKeyword(tokVal string, tok int, lval *yySymType) int {
+	if ps.tokLine > ps.prevTokLine && ps.parenDepth == 0 && !ps.arrowFollows() {
+		return tok
+	}
+	lval.sval = tokVal
+	return IDENT
+}
+
+// Returns true if the next token starts an arrow.  Any blanks before it are skipped.
+func (ps *parseState) arrowFollows() bool {
+	for r := ps.S.Peek(); r == ' ' || r == '\t'; r = ps.S.Peek() {
+		ps.NextRune()
+	}
+
+	switch ps.S.Peek() {
+	case '-', '=', '<':
+		return true
+	}
+	return false
+}
+
 // Scans a message.  A message is all characters up to the new line
 func (ps *parseState) scanMessage(lval *yySymType) int {
 	buf := new(bytes.Buffer)
@@ -295,27 +578,24 @@ func (ps *parseState) scanMessage(lval *yySymType) int {
 	return MESSAGE
 }
 
-// Scans a comment.  This ignores all characters up to the new line.
-func (ps *parseState) scanComment() {
-	var buf *bytes.Buffer
+// Scans a comment.  This reads all characters up to the new line and returns the
+// comment text.  Processing instructions are recorded unless comments are being kept.
+func (ps *parseState) scanComment() string {
+	buf := bytes.NewBufferString("#")
 
 	r := ps.NextRune()
-	if r == '!' {
-		// This starts a processor instruction
-		buf = new(bytes.Buffer)
-		r = ps.NextRune()
-	}
+	isProcInstr := (r == '!')
 
 	for (r != '\n') && (r != scanner.EOF) {
-		if buf != nil {
-			buf.WriteRune(r)
-		}
+		buf.WriteRune(r)
 		r = ps.NextRune()
 	}
 
-	if buf != nil {
-		ps.procInstrs = append(ps.procInstrs, strings.TrimSpace(buf.String()))
+	text := strings.TrimRightFunc(buf.String(), unicode.IsSpace)
+	if isProcInstr && !ps.keepComments {
+		ps.procInstrs = append(ps.procInstrs, strings.TrimSpace(text[2:]))
 	}
+	return text
 }
 
 func (ps *parseState) NextRune() rune {
@@ -332,12 +612,96 @@ func (ps *parseState) NextRune() rune {
 }
 
 func (ps *parseState) Error(err string) {
-	errMsg := fmt.Sprintf("%s:%d: %s", ps.S.Position.Filename, ps.S.Position.Line, err)
+	line := ps.S.Position.Line
+	if line == 0 {
+		// The position is not valid after reading a message, so use the line of the last token
+		line = ps.tokLine
+	}
+	errMsg := fmt.Sprintf("%s:%d: %s", ps.S.Position.Filename, line, err)
+	for _, from := range ps.includedFrom {
+		errMsg += fmt.Sprintf("\n\tincluded from %s:%d", from.filename, from.line)
+	}
 	ps.err = errors.New(errMsg)
 }
 
+// Parses an included file and returns its nodes.  The path is relative to the directory of
+// the including file.  When keeping comments, the include statement is returned as a node.
+func (ps *parseState) include(path string) *NodeList {
+	if ps.keepComments {
+		return &NodeList{&IncludeNode{path}, nil}
+	} else if ps.includeErr != nil {
+		return nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(ps.S.Position.Filename), path)
+	}
+
+	// Check that the file is not already being parsed
+	from := includePos{ps.S.Position.Filename, absPath(ps.S.Position.Filename), ps.S.Position.Line}
+	includedFrom := append([]includePos{from}, ps.includedFrom...)
+	chain := []string{path}
+	for _, inc := range includedFrom {
+		chain = append([]string{inc.filename}, chain...)
+		if inc.path == absPath(path) {
+			ps.Error("Include cycle: " + strings.Join(chain, " -> "))
+			return nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		ps.Error("Cannot include file: " + err.Error())
+		return nil
+	}
+	defer f.Close()
+
+	incState := newParseState(f, path, false)
+	incState.includedFrom = includedFrom
+	nodeList, err := parse(incState)
+	if err != nil {
+		// Stop parsing so that the error is reported with the include chain
+		ps.includeErr = err
+		ps.atEof = true
+		return nil
+	}
+	return nodeList
+}
+
+// Returns the position of a declaration starting at the given line of the file being parsed
+func (ps *parseState) position(line int) Position {
+	return Position{ps.S.Position.Filename, line}
+}
+
+// Returns the absolute form of a path, or the path itself if it cannot be made absolute
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Returns a node list with the nodes of the first list followed by the second list
+func appendNodeList(first, second *NodeList) *NodeList {
+	if first == nil {
+		return second
+	}
+	return &NodeList{first.Head, appendNodeList(first.Tail, second)}
+}
+
+// Parses a diagram.  Comments are discarded.
 func Parse(reader io.Reader, filename string) (*NodeList, error) {
-	ps := newParseState(reader, filename)
+	return parse(newParseState(reader, filename, false))
+}
+
+// Parses a diagram, keeping comments and blank lines between declarations as nodes.
+// Processing instructions are kept as comments.  Comments within attribute lists are
+// not supported.
+func ParseWithComments(reader io.Reader, filename string) (*NodeList, error) {
+	return parse(newParseState(reader, filename, true))
+}
+
+func parse(ps *parseState) (*NodeList, error) {
 	yyParse(ps)
 
 	// Add processing instructions to the start of the node list
@@ -347,7 +711,9 @@ func Parse(reader io.Reader, filename string) (*NodeList, error) {
 		ps.nodeList = &NodeList{&ProcessInstructionNode{name, value}, ps.nodeList}
 	}
 
-	if ps.err != nil {
+	if ps.includeErr != nil {
+		return nil, ps.includeErr
+	} else if ps.err != nil {
 		return nil, ps.err
 	} else {
 		return ps.nodeList, nil
@@ -362,96 +728,163 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 124
-
-var yyAct = [...]int8{
-	2, 97, 72, 88, 31, 34, 19, 74, 16, 18,
-	20, 17, 29, 30, 29, 30, 21, 83, 36, 113,
-	112, 27, 22, 110, 108, 82, 25, 24, 23, 104,
-	26, 103, 81, 80, 79, 77, 76, 71, 70, 57,
-	101, 35, 54, 32, 61, 28, 85, 28, 51, 67,
-	63, 64, 65, 66, 52, 75, 53, 86, 78, 39,
-	40, 87, 41, 94, 89, 99, 98, 69, 111, 90,
-	109, 107, 84, 55, 56, 106, 58, 91, 92, 105,
-	95, 102, 43, 44, 45, 60, 68, 33, 59, 100,
-	96, 47, 48, 49, 50, 73, 93, 46, 42, 62,
-	38, 37, 13, 12, 114, 115, 15, 14, 11, 116,
-	10, 9, 8, 117, 118, 7, 6, 5, 120, 119,
-	121, 4, 3, 1,
+const yyLast = 300
+
+var yyAct = [...]uint8{
+	2, 189, 186, 125, 66, 67, 30, 119, 109, 77,
+	89, 71, 72, 207, 127, 54, 55, 173, 86, 54,
+	55, 110, 90, 73, 169, 114, 113, 110, 75, 234,
+	233, 230, 229, 228, 227, 226, 225, 220, 82, 83,
+	84, 85, 56, 57, 195, 184, 56, 57, 182, 170,
+	159, 147, 140, 139, 138, 136, 135, 134, 101, 102,
+	103, 104, 133, 106, 107, 108, 111, 105, 69, 181,
+	175, 205, 90, 74, 53, 112, 141, 68, 53, 224,
+	204, 115, 87, 88, 152, 202, 90, 158, 124, 120,
+	121, 122, 123, 156, 116, 90, 141, 179, 128, 146,
+	145, 90, 131, 118, 90, 153, 137, 79, 80, 154,
+	81, 90, 143, 150, 78, 132, 79, 80, 149, 81,
+	165, 190, 188, 187, 130, 232, 191, 218, 142, 217,
+	213, 144, 151, 210, 160, 161, 162, 163, 200, 166,
+	167, 168, 198, 197, 196, 172, 194, 155, 193, 192,
+	157, 171, 129, 177, 174, 46, 95, 180, 97, 98,
+	99, 100, 45, 183, 176, 185, 92, 93, 94, 70,
+	126, 199, 164, 178, 201, 117, 148, 96, 91, 76,
+	21, 18, 17, 20, 19, 206, 16, 15, 24, 23,
+	13, 22, 25, 14, 203, 12, 216, 11, 10, 9,
+	8, 7, 208, 219, 209, 6, 211, 212, 5, 214,
+	215, 3, 222, 4, 1, 0, 0, 0, 0, 231,
+	0, 0, 0, 221, 0, 223, 0, 0, 235, 236,
+	237, 238, 0, 27, 29, 36, 28, 54, 55, 239,
+	240, 38, 0, 0, 0, 0, 44, 39, 0, 0,
+	0, 42, 41, 40, 0, 43, 0, 31, 32, 33,
+	34, 35, 0, 0, 56, 57, 47, 37, 26, 48,
+	49, 58, 59, 60, 64, 65, 61, 62, 63, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 52, 0, 0, 53, 0, 50, 51,
 }
 
 var yyPact = [...]int16{
-	4, -1000, -1000, 4, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, 3, 0, -23, 31,
-	74, 78, 19, 2, 19, 19, -1, 19, -1000, -1000,
-	-1000, -1000, -1000, 19, -1000, -1000, 19, 6, 17, -1000,
-	-1000, -1000, 6, 75, 56, -1000, -2, -1000, -1000, -1000,
-	-1000, -3, -1000, -34, 4, -4, -5, 4, -6, -1000,
-	-7, -8, -1000, -1000, -1000, -1000, -1000, -15, -1000, -1000,
-	-1000, 4, 8, 25, 30, 44, 4, 4, 36, 4,
-	-1000, -1000, -1000, 6, 46, -1000, -34, 1, 60, -9,
-	-11, 58, 54, 50, -16, 49, -17, 47, -20, -21,
-	-1000, -1000, -1000, 4, 4, -1000, -1000, -1000, 4, -1000,
-	-1000, -1000, 4, 4, -1000, 44, 46, -1000, 46, -1000,
-	-1000, -1000,
+	229, -1000, -1000, 229, 229, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, 12, 2, 6, -39,
+	57, 11, 11, 11, 11, 49, 158, 146, 145, 24,
+	24, 24, 24, 1, 24, 24, -40, 10, -41, -42,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	24, -1000, -1000, -1000, -1000, 24, 47, 31, 66, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-53, 11, 141, 113, -1000, 11, 24, -1000, -1000, -1000,
+	-1000, -4, -9, -10, -11, 229, -12, -13, -14, 42,
+	-1000, 229, 24, 38, 37, -1000, -15, 63, -1000, -1000,
+	-1000, -1000, -1000, -1000, 31, 21, 51, 56, 39, -1000,
+	-1000, 33, -16, 229, 229, 229, 229, 93, 229, 229,
+	229, -43, -17, 130, 229, -46, 7, -1000, 35, -1000,
+	-1000, -1000, -1000, -53, 4, -18, 11, -21, 11, -1000,
+	103, 101, 128, 127, 125, -22, 123, 122, 121, -1000,
+	229, -1000, 117, 229, 22, 24, 17, -1000, 11, -55,
+	-1000, -1000, -1000, 24, -1000, 24, 112, 24, 24, 109,
+	24, 24, -1000, -1000, -1000, 229, -1000, -1000, -1000, 108,
+	-1000, 106, 229, -29, 24, 11, 24, 16, -30, -31,
+	-1000, -32, -33, -1000, -34, -35, 103, -1000, -1000, 104,
+	-1000, -36, -1000, -37, -1000, -1000, -1000, 229, 229, 229,
+	229, -1000, -1000, -1000, -1000, -1000, 103, -1000, 101, -1000,
+	-1000,
 }
 
-var yyPgo = [...]int8{
-	0, 123, 0, 122, 121, 117, 116, 115, 112, 111,
-	110, 108, 107, 106, 103, 102, 101, 6, 100, 99,
-	98, 97, 1, 3, 96, 48, 2, 54, 95, 87,
+var yyPgo = [...]uint8{
+	0, 214, 0, 213, 211, 208, 205, 201, 200, 199,
+	198, 197, 195, 193, 192, 191, 190, 189, 188, 187,
+	186, 184, 183, 182, 181, 180, 179, 6, 9, 7,
+	178, 177, 176, 175, 173, 2, 1, 172, 18, 3,
+	10, 170, 169, 8, 164, 162, 155,
 }
 
 var yyR1 = [...]int8{
-	0, 1, 2, 2, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 4, 5, 29, 29,
-	25, 25, 27, 26, 26, 26, 28, 6, 6, 7,
-	8, 8, 17, 17, 17, 9, 9, 13, 10, 22,
-	22, 22, 11, 23, 23, 23, 14, 15, 12, 24,
-	24, 21, 21, 21, 21, 20, 20, 20, 16, 18,
-	18, 18, 19, 19, 19, 19,
+	0, 1, 2, 2, 2, 3, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 5, 14, 14,
+	14, 6, 42, 42, 42, 42, 38, 38, 40, 39,
+	39, 39, 41, 7, 7, 8, 33, 33, 32, 32,
+	32, 34, 34, 9, 9, 10, 10, 11, 11, 11,
+	12, 12, 27, 27, 27, 27, 27, 13, 13, 16,
+	16, 15, 15, 17, 17, 43, 43, 18, 18, 18,
+	18, 44, 44, 22, 25, 25, 25, 45, 45, 45,
+	45, 45, 45, 46, 46, 19, 35, 35, 35, 20,
+	36, 36, 36, 23, 24, 21, 37, 37, 31, 31,
+	31, 31, 30, 30, 30, 26, 26, 26, 28, 28,
+	28, 29, 29, 29, 29,
 }
 
 var yyR2 = [...]int8{
-	0, 1, 0, 2, 1, 1, 1, 1, 1, 1,
-	1, 1, 1, 1, 1, 1, 2, 3, 1, 1,
-	0, 1, 3, 0, 1, 3, 3, 3, 4, 4,
-	4, 6, 1, 1, 1, 2, 3, 5, 6, 0,
-	3, 4, 5, 0, 3, 4, 5, 5, 5, 0,
-	4, 1, 1, 1, 1, 2, 2, 1, 2, 1,
-	1, 1, 1, 1, 1, 1,
+	0, 1, 0, 2, 2, 2, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 2, 1, 1,
+	1, 3, 1, 1, 1, 1, 0, 1, 3, 0,
+	1, 3, 3, 3, 4, 8, 0, 1, 0, 1,
+	1, 0, 3, 2, 2, 2, 2, 2, 2, 2,
+	5, 7, 1, 1, 1, 1, 1, 3, 4, 5,
+	7, 4, 5, 6, 7, 1, 3, 5, 6, 6,
+	7, 1, 3, 5, 5, 5, 6, 1, 1, 1,
+	1, 1, 1, 1, 1, 6, 0, 4, 5, 6,
+	0, 4, 5, 5, 5, 5, 0, 4, 1, 1,
+	1, 1, 2, 2, 1, 2, 3, 2, 1, 1,
+	1, 1, 1, 1, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -2, -3, -4, -5, -6, -7, -8, -9,
-	-10, -11, -14, -15, -12, -13, 4, 7, 5, -17,
-	6, 12, 18, 24, 23, 22, 26, 17, 41, 8,
-	9, -2, 40, -29, 5, 41, 41, -16, -18, 28,
-	29, 31, -20, 8, 9, 10, -21, 13, 14, 15,
-	16, -25, -27, 37, 40, -25, -25, 40, -25, -27,
-	-25, -17, -19, 33, 34, 35, 36, -17, 11, 11,
-	40, 40, -26, -28, 41, -2, 40, 40, -2, 40,
-	40, 40, 40, 32, -2, 38, 32, 31, -23, 20,
-	25, -2, -2, -24, 27, -2, -17, -22, 20, 19,
-	-26, 39, 21, 40, 40, 21, 21, 21, 40, 21,
-	40, 21, 40, 40, -2, -2, -2, -2, -2, -23,
-	-22, -22,
+	-1000, -1, -2, -4, -3, -5, -6, -7, -8, -9,
+	-10, -11, -12, -16, -13, -19, -20, -23, -24, -21,
+	-22, -25, -15, -17, -18, -14, 39, 4, 7, 5,
+	-27, 28, 29, 30, 31, 32, 6, 38, 12, 18,
+	24, 23, 22, 26, 17, -45, -46, 37, 40, 41,
+	69, 70, 64, 67, 8, 9, 35, 36, 42, 43,
+	44, 47, 48, 49, 45, 46, -2, -2, 65, 66,
+	-42, 5, 6, 17, 67, 67, -26, -28, 57, 50,
+	51, 53, -27, -27, -27, -27, -38, 33, 34, -40,
+	62, -30, 8, 9, 10, 10, -31, 13, 14, 15,
+	16, -38, -38, -38, -38, 66, -38, -38, -38, -43,
+	67, -38, 65, 67, 67, -40, -38, -33, 56, -29,
+	58, 59, 60, 61, -28, -39, -41, 67, -27, 11,
+	11, -27, -38, 66, 66, 66, 66, -2, 66, 66,
+	66, 54, -38, -2, -38, 62, 62, 66, -32, 55,
+	50, -29, 63, 54, 53, -38, 54, -38, 54, 66,
+	-2, -2, -2, -2, -37, 27, -2, -2, -2, 67,
+	66, 21, -2, 63, -43, 63, -44, -27, -34, 62,
+	-39, 65, 66, -27, 66, -27, -35, 20, 19, -36,
+	20, 25, 21, 21, 21, 66, 21, 21, 21, -2,
+	21, -2, 63, -38, 63, 54, -27, 68, -38, -38,
+	21, -38, -38, 21, -38, -38, -2, 21, 21, -2,
+	66, -38, -27, -38, 63, 66, 66, 66, 66, 66,
+	66, -35, 21, 66, 66, -2, -2, -2, -2, -35,
+	-36,
 }
 
 var yyDef = [...]int8{
-	2, -2, 1, 2, 4, 5, 6, 7, 8, 9,
-	10, 11, 12, 13, 14, 15, 0, 0, 0, 0,
-	0, 0, 20, 0, 20, 20, 0, 20, 32, 33,
-	34, 3, 16, 0, 18, 19, 20, 0, 0, 59,
-	60, 61, 0, 0, 0, 57, 35, 51, 52, 53,
-	54, 0, 21, 23, 2, 0, 0, 2, 0, 17,
-	27, 0, 58, 62, 63, 64, 65, 0, 55, 56,
-	36, 2, 0, 24, 0, 43, 2, 2, 49, 2,
-	28, 29, 30, 0, 39, 22, 23, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	25, 26, 42, 2, 2, 46, 47, 48, 2, 37,
-	31, 38, 2, 2, 44, 43, 39, 40, 39, 45,
-	50, 41,
+	2, -2, 1, 2, 2, 6, 7, 8, 9, 10,
+	11, 12, 13, 14, 15, 16, 17, 18, 19, 20,
+	21, 22, 23, 24, 25, 26, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 36, 0, 0, 0, 36,
+	36, 36, 36, 0, 36, 36, 36, 36, 0, 0,
+	28, 29, 30, 62, 63, 64, 65, 66, 87, 88,
+	89, 90, 91, 92, 93, 94, 3, 4, 5, 27,
+	0, 32, 33, 34, 35, 36, 46, 0, 0, 118,
+	119, 120, 53, 54, 55, 56, 57, 58, 59, 37,
+	39, 0, 0, 0, 114, 0, 36, 108, 109, 110,
+	111, 0, 0, 0, 0, 2, 0, 0, 0, 36,
+	75, 2, 36, 0, 0, 31, 43, 48, 47, 115,
+	121, 122, 123, 124, 117, 0, 40, 0, 36, 112,
+	113, 36, 67, 2, 2, 2, 2, 106, 2, 2,
+	2, 0, 0, 0, 2, 0, 0, 44, 51, 49,
+	50, 116, 38, 39, 0, 0, 0, 0, 0, 68,
+	96, 100, 0, 0, 0, 0, 0, 0, 0, 76,
+	2, 71, 0, 2, 0, 36, 0, 81, 0, 0,
+	41, 42, 60, 36, 69, 36, 0, 36, 36, 0,
+	36, 36, 103, 104, 105, 2, 83, 84, 85, 0,
+	72, 0, 2, 77, 36, 0, 36, 0, 0, 0,
+	95, 0, 0, 99, 0, 0, 96, 86, 73, 0,
+	78, 79, 82, 0, 52, 61, 70, 2, 2, 2,
+	2, 107, 74, 80, 45, 97, 96, 101, 100, 98,
+	102,
 }
 
 var yyTok1 = [...]int8{
@@ -463,6 +896,9 @@ var yyTok2 = [...]int8{
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
+	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
+	62, 63, 64, 65, 66, 67, 68, 69, 70,
 }
 
 var yyTok3 = [...]int8{
@@ -819,252 +1255,502 @@ yydefault:
 		{
 			yyVAL.nodeList = &NodeList{yyDollar[1].node, yyDollar[2].nodeList}
 		}
-	case 16:
+	case 4:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.nodeList = appendNodeList(yyDollar[1].nodeList, yyDollar[2].nodeList)
+		}
+	case 5:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.nodeList = yylex.(*parseState).include(yyDollar[2].sval)
+		}
+	case 27:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.node = &TitleNode{yyDollar[2].sval}
 		}
-	case 17:
+	case 28:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.node = &CommentNode{yyDollar[1].sval, false}
+		}
+	case 29:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.node = &CommentNode{yyDollar[1].sval, true}
+		}
+	case 30:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.node = &BlankLineNode{}
+		}
+	case 31:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.node = &StyleNode{yyDollar[2].sval, yyDollar[3].attrList}
 		}
-	case 18:
+	case 32:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.sval = "participant"
 		}
-	case 19:
+	case 33:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.sval = "note"
+		}
+	case 34:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.sval = "block"
+		}
+	case 35:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.sval = yyDollar[1].sval
 		}
-	case 20:
+	case 36:
 		yyDollar = yyS[yypt-0 : yypt+1]
 		{
 			yyVAL.attrList = nil
 		}
-	case 21:
+	case 37:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.attrList = yyDollar[1].attrList
 		}
-	case 22:
+	case 38:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.attrList = yyDollar[2].attrList
 		}
-	case 23:
+	case 39:
 		yyDollar = yyS[yypt-0 : yypt+1]
 		{
 			yyVAL.attrList = nil
 		}
-	case 24:
+	case 40:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.attrList = &AttributeList{yyDollar[1].attr, nil}
 		}
-	case 25:
+	case 41:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.attrList = &AttributeList{yyDollar[1].attr, yyDollar[3].attrList}
 		}
-	case 26:
+	case 42:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.attr = &Attribute{yyDollar[1].sval, yyDollar[3].sval}
 		}
-	case 27:
+	case 43:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.node = &ActorNode{yyDollar[2].sval, false, "", yyDollar[3].attrList}
 		}
-	case 28:
+	case 44:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
 			yyVAL.node = &ActorNode{yyDollar[2].sval, true, yyDollar[4].sval, yyDollar[3].attrList}
 		}
-	case 29:
-		yyDollar = yyS[yypt-4 : yypt+1]
+	case 45:
+		yyDollar = yyS[yypt-8 : yypt+1]
 		{
-			yyVAL.node = &ActionNode{yyDollar[1].actorRef, yyDollar[3].actorRef, yyDollar[2].arrow, yyDollar[4].sval}
+			yyVAL.node = &ActionNode{yyDollar[1].actorRef, yyDollar[6].actorRef, yyDollar[2].arrow, yyDollar[8].sval, yyDollar[4].actionActivation, yyDollar[3].bval, yyDollar[5].ival, yyDollar[7].attrList}
 		}
-	case 30:
-		yyDollar = yyS[yypt-4 : yypt+1]
+	case 46:
+		yyDollar = yyS[yypt-0 : yypt+1]
 		{
-			yyVAL.node = &NoteNode{yyDollar[3].actorRef, nil, yyDollar[2].noteAlign, yyDollar[4].sval}
+			yyVAL.bval = false
 		}
-	case 31:
-		yyDollar = yyS[yypt-6 : yypt+1]
+	case 47:
+		yyDollar = yyS[yypt-1 : yypt+1]
 		{
-			yyVAL.node = &NoteNode{yyDollar[3].actorRef, yyDollar[5].actorRef, yyDollar[2].noteAlign, yyDollar[6].sval}
+			yyVAL.bval = true
 		}
-	case 32:
+	case 48:
+		yyDollar = yyS[yypt-0 : yypt+1]
+		{
+			yyVAL.actionActivation = NO_ACTION_ACTIVATION
+		}
+	case 49:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.actionActivation = ACTIVATE_TARGET
+		}
+	case 50:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.actionActivation = DEACTIVATE_SOURCE
+		}
+	case 51:
+		yyDollar = yyS[yypt-0 : yypt+1]
+		{
+			yyVAL.ival = 0
+		}
+	case 52:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.ival = yyDollar[2].ival
+		}
+	case 53:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &ActivationNode{yyDollar[2].actorRef, ACTIVATE}
+		}
+	case 54:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &ActivationNode{yyDollar[2].actorRef, DEACTIVATE}
+		}
+	case 55:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &CreateNode{yyDollar[2].actorRef}
+		}
+	case 56:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &DestroyNode{yyDollar[2].actorRef}
+		}
+	case 57:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &AutoNumberNode{AUTONUMBER_START, yyDollar[2].attrList}
+		}
+	case 58:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &AutoNumberNode{AUTONUMBER_STOP, nil}
+		}
+	case 59:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = &AutoNumberNode{AUTONUMBER_RESUME, nil}
+		}
+	case 60:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.node = &NoteNode{yyDollar[3].actorRef, nil, yyDollar[2].noteAlign, yyDollar[4].attrList, yyDollar[5].sval}
+		}
+	case 61:
+		yyDollar = yyS[yypt-7 : yypt+1]
+		{
+			yyVAL.node = &NoteNode{yyDollar[3].actorRef, yyDollar[5].actorRef, yyDollar[2].noteAlign, yyDollar[6].attrList, yyDollar[7].sval}
+		}
+	case 62:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.actorRef = NormalActorRef(yyDollar[1].sval)
 		}
-	case 33:
+	case 63:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.actorRef = PseudoActorRef("left")
 		}
-	case 34:
+	case 64:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.actorRef = PseudoActorRef("right")
 		}
-	case 35:
-		yyDollar = yyS[yypt-2 : yypt+1]
+	case 65:
+		yyDollar = yyS[yypt-1 : yypt+1]
 		{
-			yyVAL.node = &GapNode{yyDollar[2].dividerType, ""}
+			yyVAL.actorRef = PseudoActorRef("lost")
 		}
-	case 36:
+	case 66:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.actorRef = PseudoActorRef("found")
+		}
+	case 67:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.node = &GapNode{yyDollar[2].dividerType, yyDollar[3].sval}
+			yyVAL.node = &GapNode{yyDollar[2].dividerType, yyDollar[3].attrList, ""}
 		}
-	case 37:
+	case 68:
+		yyDollar = yyS[yypt-4 : yypt+1]
+		{
+			yyVAL.node = &GapNode{yyDollar[2].dividerType, yyDollar[3].attrList, yyDollar[4].sval}
+		}
+	case 69:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{NONE_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList}, nil}}
+			yyVAL.node = &RefNode{yyDollar[3].actorRef, nil, yyDollar[4].attrList, yyDollar[5].sval}
 		}
-	case 38:
+	case 70:
+		yyDollar = yyS[yypt-7 : yypt+1]
+		{
+			yyVAL.node = &RefNode{yyDollar[3].actorRef, yyDollar[5].actorRef, yyDollar[6].attrList, yyDollar[7].sval}
+		}
+	case 71:
+		yyDollar = yyS[yypt-4 : yypt+1]
+		{
+			yyVAL.node = &BoxNode{"", yyDollar[2].attrList, yyDollar[3].nodeList}
+		}
+	case 72:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.node = &BoxNode{yyDollar[2].sval, yyDollar[3].attrList, yyDollar[4].nodeList}
+		}
+	case 73:
 		yyDollar = yyS[yypt-6 : yypt+1]
 		{
-			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList}, yyDollar[5].blockSegList}}
+			yyVAL.node = &DefineNode{yyDollar[2].sval, nil, yyDollar[5].nodeList, yylex.(*parseState).position(yyDollar[1].ival)}
 		}
-	case 39:
-		yyDollar = yyS[yypt-0 : yypt+1]
+	case 74:
+		yyDollar = yyS[yypt-7 : yypt+1]
 		{
-			yyVAL.blockSegList = nil
+			yyVAL.node = &DefineNode{yyDollar[2].sval, yyDollar[4].idents, yyDollar[6].nodeList, yylex.(*parseState).position(yyDollar[1].ival)}
 		}
-	case 40:
+	case 75:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.idents = []string{yyDollar[1].sval}
+		}
+	case 76:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
-			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{ALT_ELSE_SEGMENT, "", yyDollar[2].sval, nil, yyDollar[3].nodeList}, nil}
+			yyVAL.idents = append(yyDollar[1].idents, yyDollar[3].sval)
 		}
-	case 41:
-		yyDollar = yyS[yypt-4 : yypt+1]
+	case 77:
+		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", yyDollar[2].sval, nil, yyDollar[3].nodeList}, yyDollar[4].blockSegList}
+			yyVAL.node = &UseNode{yyDollar[2].sval, nil, yyDollar[5].attrList, "", yylex.(*parseState).position(yyDollar[1].ival)}
 		}
-	case 42:
+	case 78:
+		yyDollar = yyS[yypt-6 : yypt+1]
+		{
+			yyVAL.node = &UseNode{yyDollar[2].sval, nil, yyDollar[5].attrList, yyDollar[6].sval, yylex.(*parseState).position(yyDollar[1].ival)}
+		}
+	case 79:
+		yyDollar = yyS[yypt-6 : yypt+1]
+		{
+			yyVAL.node = &UseNode{yyDollar[2].sval, yyDollar[4].actorRefs, yyDollar[6].attrList, "", yylex.(*parseState).position(yyDollar[1].ival)}
+		}
+	case 80:
+		yyDollar = yyS[yypt-7 : yypt+1]
+		{
+			yyVAL.node = &UseNode{yyDollar[2].sval, yyDollar[4].actorRefs, yyDollar[6].attrList, yyDollar[7].sval, yylex.(*parseState).position(yyDollar[1].ival)}
+		}
+	case 81:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.actorRefs = []ActorRef{yyDollar[1].actorRef}
+		}
+	case 82:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.actorRefs = append(yyDollar[1].actorRefs, yyDollar[3].actorRef)
+		}
+	case 83:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", yyDollar[2].sval, nil, yyDollar[3].nodeList}, yyDollar[4].blockSegList}}
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{NONE_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}}
 		}
-	case 43:
+	case 84:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{yyDollar[1].segmentType, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}}
+		}
+	case 85:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{yyDollar[1].segmentType, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}}
+		}
+	case 86:
+		yyDollar = yyS[yypt-6 : yypt+1]
+		{
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{yyDollar[1].segmentType, "", yyDollar[4].sval, yyDollar[3].attrList, yyDollar[5].nodeList, yyDollar[2].idents}, nil}}
+		}
+	case 87:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = CRITICAL_SEGMENT
+		}
+	case 88:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = BREAK_SEGMENT
+		}
+	case 89:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = NEG_SEGMENT
+		}
+	case 90:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = ASSERT_SEGMENT
+		}
+	case 91:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = STRICT_SEGMENT
+		}
+	case 92:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = SEQ_SEGMENT
+		}
+	case 93:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = IGNORE_SEGMENT
+		}
+	case 94:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.segmentType = CONSIDER_SEGMENT
+		}
+	case 95:
+		yyDollar = yyS[yypt-6 : yypt+1]
+		{
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, yyDollar[5].blockSegList}}
+		}
+	case 96:
 		yyDollar = yyS[yypt-0 : yypt+1]
 		{
 			yyVAL.blockSegList = nil
 		}
-	case 44:
-		yyDollar = yyS[yypt-3 : yypt+1]
+	case 97:
+		yyDollar = yyS[yypt-4 : yypt+1]
 		{
-			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{PAR_ELSE_SEGMENT, "", yyDollar[2].sval, nil, yyDollar[3].nodeList}, nil}
+			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{ALT_ELSE_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}
 		}
-	case 45:
+	case 98:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, yyDollar[5].blockSegList}
+		}
+	case 99:
+		yyDollar = yyS[yypt-6 : yypt+1]
+		{
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, yyDollar[5].blockSegList}}
+		}
+	case 100:
+		yyDollar = yyS[yypt-0 : yypt+1]
+		{
+			yyVAL.blockSegList = nil
+		}
+	case 101:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
-			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", yyDollar[2].sval, nil, yyDollar[3].nodeList}, yyDollar[4].blockSegList}
+			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{PAR_ELSE_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}
 		}
-	case 46:
+	case 102:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{OPT_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList}, nil}}
+			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, yyDollar[5].blockSegList}
 		}
-	case 47:
+	case 103:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{LOOP_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList}, nil}}
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{OPT_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}}
 		}
-	case 48:
+	case 104:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
-			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{CONCURRENT_SEGMENT, "", "", nil, yyDollar[3].nodeList}, yyDollar[4].blockSegList}}
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{LOOP_SEGMENT, "", yyDollar[3].sval, yyDollar[2].attrList, yyDollar[4].nodeList, nil}, nil}}
 		}
-	case 49:
+	case 105:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.node = &BlockNode{&BlockSegmentList{&BlockSegment{CONCURRENT_SEGMENT, "", "", nil, yyDollar[3].nodeList, nil}, yyDollar[4].blockSegList}}
+		}
+	case 106:
 		yyDollar = yyS[yypt-0 : yypt+1]
 		{
 			yyVAL.blockSegList = nil
 		}
-	case 50:
+	case 107:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
-			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{CONCURRENT_WHILST_SEGMENT, "", "", nil, yyDollar[3].nodeList}, yyDollar[4].blockSegList}
+			yyVAL.blockSegList = &BlockSegmentList{&BlockSegment{CONCURRENT_WHILST_SEGMENT, "", "", nil, yyDollar[3].nodeList, nil}, yyDollar[4].blockSegList}
 		}
-	case 51:
+	case 108:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.dividerType = SPACER_GAP
 		}
-	case 52:
+	case 109:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.dividerType = EMPTY_GAP
 		}
-	case 53:
+	case 110:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.dividerType = LINE_GAP
 		}
-	case 54:
+	case 111:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.dividerType = FRAME_GAP
 		}
-	case 55:
+	case 112:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.noteAlign = LEFT_NOTE_ALIGNMENT
 		}
-	case 56:
+	case 113:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.noteAlign = RIGHT_NOTE_ALIGNMENT
 		}
-	case 57:
+	case 114:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.noteAlign = OVER_NOTE_ALIGNMENT
 		}
-	case 58:
+	case 115:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
-			yyVAL.arrow = ArrowType{yyDollar[1].arrowStem, yyDollar[2].arrowHead}
+			yyVAL.arrow = ArrowType{Stem: yyDollar[1].arrowStem, Head: yyDollar[2].arrowHead}
 		}
-	case 59:
+	case 116:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.arrow = ArrowType{Stem: yyDollar[2].arrowStem, Head: yyDollar[3].arrowHead, Tail: true}
+		}
+	case 117:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.arrow = ArrowType{Stem: yyDollar[2].arrowStem, Head: SOLID_ARROW_HEAD, Reversed: true}
+		}
+	case 118:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowStem = SOLID_ARROW_STEM
 		}
-	case 60:
+	case 119:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowStem = DASHED_ARROW_STEM
 		}
-	case 61:
+	case 120:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowStem = THICK_ARROW_STEM
 		}
-	case 62:
+	case 121:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowHead = SOLID_ARROW_HEAD
 		}
-	case 63:
+	case 122:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowHead = OPEN_ARROW_HEAD
 		}
-	case 64:
+	case 123:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowHead = BARBED_ARROW_HEAD
 		}
-	case 65:
+	case 124:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.arrowHead = LOWER_BARBED_ARROW_HEAD
@@ -7,12 +7,15 @@ package parse
 
 import (
     "io"
+    "os"
+    "path/filepath"
     "bytes"
     "errors"
     "strings"
     "fmt"
     "strconv"
     "text/scanner"
+    "unicode"
 )
 
 var DualRunes = map[string]int {
@@ -23,10 +26,15 @@ var DualRunes = map[string]int {
     "-":    DASH,
     "=":    EQUAL,
 
+    "<":    ANGL,
+
     ">>":   DOUBLEANGR,
     ">":    ANGR,
     "/>":   SLASHANGR,
     "\\>":  BACKSLASHANGR,
+
+    "+":    PLUS,
+    "*":    STAR,
 }
 
 
@@ -41,9 +49,15 @@ var DualRunes = map[string]int {
     actorRef        ActorRef
     noteAlign       NoteAlignment
     dividerType     GapType
+    actionActivation ActionActivation
+    bval            bool
+    ival            int
     blockSegList    *BlockSegmentList
     attrList        *AttributeList
     attr            *Attribute
+    idents          []string
+    actorRefs       []ActorRef
+    segmentType     SegmentType
 
     sval            string
 }
@@ -54,27 +68,44 @@ var DualRunes = map[string]int {
 %token  K_ALT   K_ELSEALT   K_ELSE   K_END  K_LOOP K_OPT
 %token  K_PAR K_ELSEPAR
 %token  K_CONCURRENT K_WHILST
-
-%token  DASH    DOUBLEDASH      DOT                 EQUAL       COMMA
-%token  ANGR    DOUBLEANGR      BACKSLASHANGR       SLASHANGR
+%token  K_ACTIVATE K_DEACTIVATE
+%token  K_CREATE K_DESTROY
+%token  K_AUTONUMBER K_STOP K_RESUME
+%token  K_LOST K_FOUND
+%token  K_BOX K_REF
+%token  K_INCLUDE
+%token  <ival>  K_DEFINE K_USE
+%token  K_CRITICAL K_BREAK K_NEG K_IGNORE K_CONSIDER K_ASSERT K_STRICT K_SEQ
+
+%token  DASH    DOUBLEDASH      DOT                 EQUAL       COMMA       PLUS        STAR
+%token  ANGL    ANGR    DOUBLEANGR      BACKSLASHANGR       SLASHANGR
 %token  PARL    PARR
+%token  BLANKLINE
 
 %token  <sval>  STRING MESSAGE
 %token  <sval>  IDENT
+%token  <ival>  INT
+%token  <sval>  COMMENT TRAILINGCOMMENT
 
-%type   <nodeList>      top decls
+%type   <nodeList>      top decls include
 %type   <node>          decl
-%type   <node>          title style actor action note gap altblock parblock parallelblock genericblock optblock loopblock
+%type   <node>          title style actor action activation lifecycle autonumber note gap comment box ref define use altblock parblock parallelblock genericblock optblock loopblock fragmentblock
 %type   <arrow>         arrow
 %type   <actorRef>      actorref
 %type   <arrowStem>     arrowStem
 %type   <arrowHead>     arrowHead
 %type   <noteAlign>     noteplace
 %type   <dividerType>   dividerType
+%type   <actionActivation>  actionActivation
+%type   <bval>          actionCreation
+%type   <ival>          actionDelay
 %type   <blockSegList>  altblocklist parblocklist parallelblocklist
 %type   <attrList>      maybeattrs attrs attrset
 %type   <attr>          attr
 %type   <sval>          styleidentifier
+%type   <idents>        idents
+%type   <actorRefs>     actorrefs
+%type   <segmentType>   fragmenttype messagefragmenttype
 
 %%
 
@@ -94,6 +125,17 @@ decls
     {
         $$ = &NodeList{$1, $2}
     }
+    |   include decls
+    {
+        $$ = appendNodeList($1, $2)
+    }
+    ;
+
+include
+    :   K_INCLUDE STRING
+    {
+        $$ = yylex.(*parseState).include($2)
+    }
     ;
 
 decl
@@ -101,7 +143,11 @@ decl
     |   style
     |   actor
     |   action
+    |   activation
+    |   lifecycle
+    |   autonumber
     |   note
+    |   ref
     |   gap
     |   altblock
     |   parblock
@@ -109,6 +155,11 @@ decl
     |   loopblock
     |   parallelblock
     |   genericblock
+    |   fragmentblock
+    |   box
+    |   define
+    |   use
+    |   comment
      ;
 
 title
@@ -118,6 +169,21 @@ title
     }
     ;
 
+comment
+    :   COMMENT
+    {
+        $$ = &CommentNode{$1, false}
+    }
+    |   TRAILINGCOMMENT
+    {
+        $$ = &CommentNode{$1, true}
+    }
+    |   BLANKLINE
+    {
+        $$ = &BlankLineNode{}
+    }
+    ;
+
 style
     :   K_STYLE styleidentifier attrset
     {
@@ -127,6 +193,8 @@ style
 
 styleidentifier
     :   K_PARTICIPANT   { $$ = "participant"; }
+    |   K_NOTE          { $$ = "note"; }
+    |   K_BLOCK         { $$ = "block"; }
     |   IDENT           { $$ = $1; }
     ;
 
@@ -182,20 +250,73 @@ actor
     ;
 
 action
-    :   actorref arrow actorref MESSAGE
+    :   actorref arrow actionCreation actionActivation actionDelay actorref maybeattrs MESSAGE
+    {
+        $$ = &ActionNode{$1, $6, $2, $8, $4, $3, $5, $7}
+    }
+    ;
+
+actionCreation
+    :   /* empty */         { $$ = false }
+    |   STAR                { $$ = true }
+    ;
+
+actionActivation
+    :   /* empty */         { $$ = NO_ACTION_ACTIVATION }
+    |   PLUS                { $$ = ACTIVATE_TARGET }
+    |   DASH                { $$ = DEACTIVATE_SOURCE }
+    ;
+
+actionDelay
+    :   /* empty */         { $$ = 0 }
+    |   PARL INT PARR       { $$ = $2 }
+    ;
+
+activation
+    :   K_ACTIVATE actorref
+    {
+        $$ = &ActivationNode{$2, ACTIVATE}
+    }
+    |   K_DEACTIVATE actorref
     {
-        $$ = &ActionNode{$1, $3, $2, $4}
+        $$ = &ActivationNode{$2, DEACTIVATE}
+    }
+    ;
+
+lifecycle
+    :   K_CREATE actorref
+    {
+        $$ = &CreateNode{$2}
+    }
+    |   K_DESTROY actorref
+    {
+        $$ = &DestroyNode{$2}
+    }
+    ;
+
+autonumber
+    :   K_AUTONUMBER maybeattrs
+    {
+        $$ = &AutoNumberNode{AUTONUMBER_START, $2}
+    }
+    |   K_AUTONUMBER K_STOP
+    {
+        $$ = &AutoNumberNode{AUTONUMBER_STOP, nil}
+    }
+    |   K_AUTONUMBER K_RESUME
+    {
+        $$ = &AutoNumberNode{AUTONUMBER_RESUME, nil}
     }
     ;
 
 note
-    :   K_NOTE noteplace actorref MESSAGE
+    :   K_NOTE noteplace actorref maybeattrs MESSAGE
     {
-        $$ = &NoteNode{$3, nil, $2, $4}
+        $$ = &NoteNode{$3, nil, $2, $4, $5}
     }
-    |   K_NOTE noteplace actorref COMMA actorref MESSAGE
+    |   K_NOTE noteplace actorref COMMA actorref maybeattrs MESSAGE
     {
-        $$ = &NoteNode{$3, $5, $2, $6}
+        $$ = &NoteNode{$3, $5, $2, $6, $7}
     }
     ;
 
@@ -212,30 +333,165 @@ actorref
     {
         $$ = PseudoActorRef("right")
     }
+    |   K_LOST
+    {
+        $$ = PseudoActorRef("lost")
+    }
+    |   K_FOUND
+    {
+        $$ = PseudoActorRef("found")
+    }
     ;
 
 gap
-    :   K_HORIZONTAL dividerType
+    :   K_HORIZONTAL dividerType maybeattrs
     {
-        $$ = &GapNode{$2, ""}
+        $$ = &GapNode{$2, $3, ""}
     }
-    |   K_HORIZONTAL dividerType MESSAGE
+    |   K_HORIZONTAL dividerType maybeattrs MESSAGE
     {
-        $$ = &GapNode{$2, $3}
+        $$ = &GapNode{$2, $3, $4}
+    }
+    ;
+
+ref
+    :   K_REF K_OVER actorref maybeattrs MESSAGE
+    {
+        $$ = &RefNode{$3, nil, $4, $5}
+    }
+    |   K_REF K_OVER actorref COMMA actorref maybeattrs MESSAGE
+    {
+        $$ = &RefNode{$3, $5, $6, $7}
+    }
+    ;
+
+box
+    :   K_BOX maybeattrs decls K_END
+    {
+        $$ = &BoxNode{"", $2, $3}
+    }
+    |   K_BOX STRING maybeattrs decls K_END
+    {
+        $$ = &BoxNode{$2, $3, $4}
+    }
+    ;
+
+define
+    :   K_DEFINE IDENT PARL PARR decls K_END
+    {
+        $$ = &DefineNode{$2, nil, $5, yylex.(*parseState).position($1)}
+    }
+    |   K_DEFINE IDENT PARL idents PARR decls K_END
+    {
+        $$ = &DefineNode{$2, $4, $6, yylex.(*parseState).position($1)}
+    }
+    ;
+
+idents
+    :   IDENT
+    {
+        $$ = []string{$1}
+    }
+    |   idents COMMA IDENT
+    {
+        $$ = append($1, $3)
+    }
+    ;
+
+use
+    :   K_USE IDENT PARL PARR maybeattrs
+    {
+        $$ = &UseNode{$2, nil, $5, "", yylex.(*parseState).position($1)}
+    }
+    |   K_USE IDENT PARL PARR maybeattrs MESSAGE
+    {
+        $$ = &UseNode{$2, nil, $5, $6, yylex.(*parseState).position($1)}
+    }
+    |   K_USE IDENT PARL actorrefs PARR maybeattrs
+    {
+        $$ = &UseNode{$2, $4, $6, "", yylex.(*parseState).position($1)}
+    }
+    |   K_USE IDENT PARL actorrefs PARR maybeattrs MESSAGE
+    {
+        $$ = &UseNode{$2, $4, $6, $7, yylex.(*parseState).position($1)}
+    }
+    ;
+
+actorrefs
+    :   actorref
+    {
+        $$ = []ActorRef{$1}
+    }
+    |   actorrefs COMMA actorref
+    {
+        $$ = append($1, $3)
     }
     ;
 
 genericblock
     :   K_BLOCK maybeattrs MESSAGE decls K_END
     {
-        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{NONE_SEGMENT, "", $3, $2, $4}, nil}}
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{NONE_SEGMENT, "", $3, $2, $4, nil}, nil}}
+    }
+    ;
+
+fragmentblock
+    :   fragmenttype maybeattrs MESSAGE decls K_END
+    {
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{$1, "", $3, $2, $4, nil}, nil}}
+    }
+    |   messagefragmenttype maybeattrs MESSAGE decls K_END
+    {
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{$1, "", $3, $2, $4, nil}, nil}}
+    }
+    |   messagefragmenttype idents maybeattrs MESSAGE decls K_END
+    {
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{$1, "", $4, $3, $5, $2}, nil}}
+    }
+    ;
+
+fragmenttype
+    :   K_CRITICAL
+    {
+        $$ = CRITICAL_SEGMENT
+    }
+    |   K_BREAK
+    {
+        $$ = BREAK_SEGMENT
+    }
+    |   K_NEG
+    {
+        $$ = NEG_SEGMENT
+    }
+    |   K_ASSERT
+    {
+        $$ = ASSERT_SEGMENT
+    }
+    |   K_STRICT
+    {
+        $$ = STRICT_SEGMENT
+    }
+    |   K_SEQ
+    {
+        $$ = SEQ_SEGMENT
+    }
+    ;
+
+messagefragmenttype
+    :   K_IGNORE
+    {
+        $$ = IGNORE_SEGMENT
+    }
+    |   K_CONSIDER
+    {
+        $$ = CONSIDER_SEGMENT
     }
     ;
 
 altblock
     :   K_ALT maybeattrs MESSAGE decls altblocklist K_END
     {
-        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", $3, $2, $4}, $5}}
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", $3, $2, $4, nil}, $5}}
     }
     ;
 
@@ -244,20 +500,20 @@ altblocklist
     {
         $$ = nil
     }
-    |   K_ELSE MESSAGE decls
+    |   K_ELSE maybeattrs MESSAGE decls
     {
-        $$ = &BlockSegmentList{&BlockSegment{ALT_ELSE_SEGMENT, "", $2, nil, $3}, nil}
+        $$ = &BlockSegmentList{&BlockSegment{ALT_ELSE_SEGMENT, "", $3, $2, $4, nil}, nil}
     }
-    |   K_ELSEALT MESSAGE decls altblocklist
+    |   K_ELSEALT maybeattrs MESSAGE decls altblocklist
     {
-        $$ = &BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", $2, nil, $3}, $4}
+        $$ = &BlockSegmentList{&BlockSegment{ALT_SEGMENT, "", $3, $2, $4, nil}, $5}
     }
     ;
 
 parblock
-    :   K_PAR MESSAGE decls parblocklist K_END
+    :   K_PAR maybeattrs MESSAGE decls parblocklist K_END
     {
-        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", $2, nil, $3}, $4}}
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", $3, $2, $4, nil}, $5}}
     }
     ;
 
@@ -266,34 +522,34 @@ parblocklist
     {
         $$ = nil
     }
-    |   K_ELSE MESSAGE decls
+    |   K_ELSE maybeattrs MESSAGE decls
     {
-        $$ = &BlockSegmentList{&BlockSegment{PAR_ELSE_SEGMENT, "", $2, nil, $3}, nil}
+        $$ = &BlockSegmentList{&BlockSegment{PAR_ELSE_SEGMENT, "", $3, $2, $4, nil}, nil}
     }
-    |   K_ELSEPAR MESSAGE decls parblocklist
+    |   K_ELSEPAR maybeattrs MESSAGE decls parblocklist
     {
-        $$ = &BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", $2, nil, $3}, $4}
+        $$ = &BlockSegmentList{&BlockSegment{PAR_SEGMENT, "", $3, $2, $4, nil}, $5}
     }
     ;
 
 optblock
     :   K_OPT maybeattrs MESSAGE decls K_END
     {
-        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{OPT_SEGMENT, "", $3, $2, $4}, nil}}
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{OPT_SEGMENT, "", $3, $2, $4, nil}, nil}}
     }
     ;
 
 loopblock
     :   K_LOOP maybeattrs MESSAGE decls K_END
     {
-        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{LOOP_SEGMENT, "", $3, $2, $4}, nil}}
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{LOOP_SEGMENT, "", $3, $2, $4, nil}, nil}}
     }
     ;
 
 parallelblock
     :   K_CONCURRENT MESSAGE decls parallelblocklist K_END
     {
-        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{CONCURRENT_SEGMENT, "", "", nil, $3}, $4}}
+        $$ = &BlockNode{&BlockSegmentList{&BlockSegment{CONCURRENT_SEGMENT, "", "", nil, $3, nil}, $4}}
     }
     ;
 
@@ -304,7 +560,7 @@ parallelblocklist
     }
     |   K_WHILST MESSAGE decls altblocklist
     {
-        $$ = &BlockSegmentList{&BlockSegment{CONCURRENT_WHILST_SEGMENT, "", "", nil, $3}, $4}
+        $$ = &BlockSegmentList{&BlockSegment{CONCURRENT_WHILST_SEGMENT, "", "", nil, $3, nil}, $4}
     }
     ;
 
@@ -324,7 +580,15 @@ noteplace
 arrow
     :   arrowStem   arrowHead
     {
-        $$ = ArrowType{$1, $2}
+        $$ = ArrowType{Stem: $1, Head: $2}
+    }
+    |   ANGL arrowStem arrowHead
+    {
+        $$ = ArrowType{Stem: $2, Head: $3, Tail: true}
+    }
+    |   ANGL arrowStem
+    {
+        $$ = ArrowType{Stem: $2, Head: SOLID_ARROW_HEAD, Reversed: true}
     }
     ;
 
@@ -350,36 +614,152 @@ type parseState struct {
     //diagram     *Diagram
     procInstrs  []string
     nodeList    *NodeList
+
+    // When true, comments and blank lines are returned as tokens
+    keepComments    bool
+    parenDepth      int
+    tokLine         int
+    prevTokLine     int
+    lastTok         int
+    lastLine        int
+    pending         []pendingToken
+
+    // The line of the last autonumber keyword
+    autoNumberLine  int
+
+    // The files including this one, from the innermost include statement outwards, and
+    // any error parsing an included file
+    includedFrom    []includePos
+    includeErr      error
+}
+
+// The position of an include statement
+type includePos struct {
+    filename    string
+    path        string      // The absolute path of the file, used to detect cycles
+    line        int
+}
+
+// A token which is to be returned by the next call to Lex
+type pendingToken struct {
+    tok     int
+    sval    string
+    ival    int
+}
+
+// Tokens which can end a declaration
+var declEndTokens = map[int]bool {
+    MESSAGE: true, PARR: true, IDENT: true, K_END: true, K_BOX: true, STRING: true,
+    K_SPACER: true, K_GAP: true, K_LINE: true, K_FRAME: true,
+    K_AUTONUMBER: true, K_STOP: true, K_RESUME: true,
+    COMMENT: true, TRAILINGCOMMENT: true,
 }
 
-func newParseState(src io.Reader, filename string) *parseState {
-    ps := &parseState{}
+// Tokens which can start a declaration or a block segment
+var declStartTokens = map[int]bool {
+    IDENT: true, K_LEFT: true, K_RIGHT: true, K_LOST: true, K_FOUND: true,
+    K_TITLE: true, K_PARTICIPANT: true, K_NOTE: true, K_STYLE: true, K_HORIZONTAL: true,
+    K_BLOCK: true, K_ALT: true, K_ELSEALT: true, K_ELSE: true, K_END: true, K_LOOP: true,
+    K_OPT: true, K_PAR: true, K_ELSEPAR: true, K_CONCURRENT: true, K_WHILST: true,
+    K_ACTIVATE: true, K_DEACTIVATE: true, K_CREATE: true, K_DESTROY: true,
+    K_AUTONUMBER: true, K_BOX: true, K_REF: true, K_INCLUDE: true,
+    K_DEFINE: true, K_USE: true, K_CRITICAL: true, K_BREAK: true, K_NEG: true, K_IGNORE: true,
+    K_CONSIDER: true, K_ASSERT: true, K_STRICT: true, K_SEQ: true, COMMENT: true,
+}
+
+func newParseState(src io.Reader, filename string, keepComments bool) *parseState {
+    ps := &parseState{keepComments: keepComments}
     ps.S.Init(src)
     ps.S.Position.Filename = filename
 //    ps.diagram = &Diagram{}
 
+    if keepComments {
+        ps.S.Mode &^= scanner.SkipComments
+    }
+
     return ps
 }
 
 func (ps *parseState) Lex(lval *yySymType) int {
+    if len(ps.pending) > 0 {
+        pt := ps.pending[0]
+        ps.pending = ps.pending[1:]
+        lval.sval = pt.sval
+        lval.ival = pt.ival
+        return pt.tok
+    }
+
+    tok := ps.scanToken(lval)
+    ps.prevTokLine = ps.tokLine
+    if ps.keepComments && tok != 0 {
+        return ps.layoutToken(tok, lval)
+    }
+    return tok
+}
+
+// Tracks the layout of the source when keeping comments.  Comments which follow a
+// declaration on the same line are returned as trailing comments, and blank lines between
+// declarations are returned before the token following them.
+func (ps *parseState) layoutToken(tok int, lval *yySymType) int {
+    startLine := ps.tokLine
+    endLine := startLine
+
+    switch tok {
+    case COMMENT:
+        endLine += strings.Count(lval.sval, "\n")
+        if ps.lastLine > 0 && startLine == ps.lastLine {
+            tok = TRAILINGCOMMENT
+        }
+    }
+
+    isBlank := ps.lastLine > 0 && startLine > ps.lastLine + 1 && ps.parenDepth == 0 &&
+        declEndTokens[ps.lastTok] && declStartTokens[tok]
+    ps.lastTok, ps.lastLine = tok, endLine
+
+    if isBlank {
+        ps.pending = append(ps.pending, pendingToken{tok, lval.sval, lval.ival})
+        return BLANKLINE
+    }
+    return tok
+}
+
+func (ps *parseState) scanToken(lval *yySymType) int {
     if ps.atEof {
         return 0
     }
     for {
         tok := ps.S.Scan()
+        ps.tokLine = ps.S.Position.Line
+
         switch tok {
         case scanner.EOF:
             ps.atEof = true
             return 0
-        case '#':
-            ps.scanComment()
+        case '#', scanner.Comment:
+            var text string
+            if tok == '#' {
+                text = ps.scanComment()
+            } else {
+                text = ps.S.TokenText()
+            }
+
+            if !ps.keepComments {
+                // Discard the comment
+            } else if ps.parenDepth > 0 {
+                ps.Error("Comments within attribute lists cannot be kept")
+            } else {
+                lval.sval = text
+                return COMMENT
+            }
         case ':':
             return ps.scanMessage(lval)
         case '(':
+            ps.parenDepth++
             return PARL
         case ')':
+            ps.parenDepth--
             return PARR
-        case '-', '>', '*', '=', '/', '\\', '.', ',':
+        case '-', '<', '>', '*', '=', '/', '\\', '.', ',', '+':
             if res, isTok := ps.handleDoubleRune(tok) ; isTok {
                 return res
             } else {
@@ -393,6 +773,14 @@ func (ps *parseState) Lex(lval *yySymType) int {
             } else {
                 ps.Error("Invalid string: " + scanner.TokenString(tok) + ": " + err.Error())
             }
+        case scanner.Int:
+            tokVal := ps.S.TokenText()
+            if res, err := strconv.Atoi(tokVal) ; err == nil {
+                lval.ival = res
+                return INT
+            } else {
+                ps.Error("Invalid number: " + tokVal)
+            }
         case scanner.Ident:
             return ps.scanKeywordOrIdent(lval)
         default:
@@ -435,6 +823,16 @@ func (ps *parseState) scanKeywordOrIdent(lval *yySymType) int {
         return K_LEFT
     case "right":
         return K_RIGHT
+    case "lost", "found":
+        // These are only keywords in lower case, so that participants named "Lost" or
+        // "Found" are not drawn as lost or found messages
+        if tokVal == "lost" {
+            return K_LOST
+        } else if tokVal == "found" {
+            return K_FOUND
+        }
+        lval.sval = tokVal
+        return IDENT
     case "over":
         return K_OVER
     case "of":
@@ -447,6 +845,18 @@ func (ps *parseState) scanKeywordOrIdent(lval *yySymType) int {
         return K_FRAME
     case "block":
         return K_BLOCK
+    case "box":
+        return ps.statementKeyword(tokVal, K_BOX, lval)
+    case "ref":
+        return ps.statementKeyword(tokVal, K_REF, lval)
+    case "include":
+        return ps.statementKeyword(tokVal, K_INCLUDE, lval)
+    case "define":
+        lval.ival = ps.S.Position.Line
+        return ps.statementKeyword(tokVal, K_DEFINE, lval)
+    case "use":
+        lval.ival = ps.S.Position.Line
+        return ps.statementKeyword(tokVal, K_USE, lval)
     case "line":
         return K_LINE
     case "style":
@@ -467,18 +877,83 @@ func (ps *parseState) scanKeywordOrIdent(lval *yySymType) int {
         return K_END
     case "loop":
         return K_LOOP
+    case "critical":
+        return ps.statementKeyword(tokVal, K_CRITICAL, lval)
+    case "break":
+        return ps.statementKeyword(tokVal, K_BREAK, lval)
+    case "neg":
+        return ps.statementKeyword(tokVal, K_NEG, lval)
+    case "ignore":
+        return ps.statementKeyword(tokVal, K_IGNORE, lval)
+    case "consider":
+        return ps.statementKeyword(tokVal, K_CONSIDER, lval)
+    case "assert":
+        return ps.statementKeyword(tokVal, K_ASSERT, lval)
+    case "strict":
+        return ps.statementKeyword(tokVal, K_STRICT, lval)
+    case "seq":
+        return ps.statementKeyword(tokVal, K_SEQ, lval)
     case "opt":
         return K_OPT
     case "concurrent":
         return K_CONCURRENT
     case "whilst":
         return K_WHILST
+    case "activate":
+        return ps.statementKeyword(tokVal, K_ACTIVATE, lval)
+    case "deactivate":
+        return ps.statementKeyword(tokVal, K_DEACTIVATE, lval)
+    case "create":
+        return ps.statementKeyword(tokVal, K_CREATE, lval)
+    case "destroy":
+        return ps.statementKeyword(tokVal, K_DESTROY, lval)
+    case "autonumber":
+        tok := ps.statementKeyword(tokVal, K_AUTONUMBER, lval)
+        if tok == K_AUTONUMBER {
+            ps.autoNumberLine = ps.tokLine
+        }
+        return tok
+    case "stop", "resume":
+        // These are only keywords when they follow autonumber on the same line, so that
+        // they can still be used as actor names
+        if ps.tokLine == ps.autoNumberLine {
+            if strings.ToLower(tokVal) == "stop" {
+                return K_STOP
+            }
+            return K_RESUME
+        }
+        lval.sval = tokVal
+        return IDENT
     default:
         lval.sval = tokVal
         return IDENT
     }
 }
 
+// Returns the keyword token if the identifier starts a statement which is not a message,
+// otherwise returns the identifier.  This allows keywords added to the language later to
+// still be used as participant names.
+func (ps *parseState) statementKeyword(tokVal string, tok int, lval *yySymType) int {
+    if ps.tokLine > ps.prevTokLine && ps.parenDepth == 0 && !ps.arrowFollows() {
+        return tok
+    }
+    lval.sval = tokVal
+    return IDENT
+}
+
+// Returns true if the next token starts an arrow.  Any blanks before it are skipped.
+func (ps *parseState) arrowFollows() bool {
+    for r := ps.S.Peek(); r == ' ' || r == '\t'; r = ps.S.Peek() {
+        ps.NextRune()
+    }
+
+    switch ps.S.Peek() {
+    case '-', '=', '<':
+        return true
+    }
+    return false
+}
+
 // Scans a message.  A message is all characters up to the new line
 func (ps *parseState) scanMessage(lval *yySymType) int {
     buf := new(bytes.Buffer)
@@ -504,27 +979,24 @@ func (ps *parseState) scanMessage(lval *yySymType) int {
     return MESSAGE
 }
 
-// Scans a comment.  This ignores all characters up to the new line.
-func (ps *parseState) scanComment() {
-    var buf *bytes.Buffer
+// Scans a comment.  This reads all characters up to the new line and returns the
+// comment text.  Processing instructions are recorded unless comments are being kept.
+func (ps *parseState) scanComment() string {
+    buf := bytes.NewBufferString("#")
 
     r := ps.NextRune()
-    if (r == '!') {
-        // This starts a processor instruction
-        buf = new(bytes.Buffer)
-        r = ps.NextRune()
-    }
+    isProcInstr := (r == '!')
 
     for ((r != '\n') && (r != scanner.EOF)) {
-        if buf != nil {
-            buf.WriteRune(r)
-        }
+        buf.WriteRune(r)
         r = ps.NextRune()
     }
 
-    if buf != nil {
-        ps.procInstrs = append(ps.procInstrs, strings.TrimSpace(buf.String()))
+    text := strings.TrimRightFunc(buf.String(), unicode.IsSpace)
+    if isProcInstr && !ps.keepComments {
+        ps.procInstrs = append(ps.procInstrs, strings.TrimSpace(text[2:]))
     }
+    return text
 }
 
 func (ps *parseState) NextRune() rune {
@@ -541,13 +1013,97 @@ func (ps *parseState) NextRune() rune {
 }
 
 func (ps *parseState) Error(err string) {
-    errMsg := fmt.Sprintf("%s:%d: %s", ps.S.Position.Filename, ps.S.Position.Line, err)
+    line := ps.S.Position.Line
+    if line == 0 {
+        // The position is not valid after reading a message, so use the line of the last token
+        line = ps.tokLine
+    }
+    errMsg := fmt.Sprintf("%s:%d: %s", ps.S.Position.Filename, line, err)
+    for _, from := range ps.includedFrom {
+        errMsg += fmt.Sprintf("\n\tincluded from %s:%d", from.filename, from.line)
+    }
     ps.err = errors.New(errMsg)
 }
 
+// Parses an included file and returns its nodes.  The path is relative to the directory of
+// the including file.  When keeping comments, the include statement is returned as a node.
+func (ps *parseState) include(path string) *NodeList {
+    if ps.keepComments {
+        return &NodeList{&IncludeNode{path}, nil}
+    } else if ps.includeErr != nil {
+        return nil
+    }
+
+    if !filepath.IsAbs(path) {
+        path = filepath.Join(filepath.Dir(ps.S.Position.Filename), path)
+    }
+
+    // Check that the file is not already being parsed
+    from := includePos{ps.S.Position.Filename, absPath(ps.S.Position.Filename), ps.S.Position.Line}
+    includedFrom := append([]includePos{from}, ps.includedFrom...)
+    chain := []string{path}
+    for _, inc := range includedFrom {
+        chain = append([]string{inc.filename}, chain...)
+        if inc.path == absPath(path) {
+            ps.Error("Include cycle: " + strings.Join(chain, " -> "))
+            return nil
+        }
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        ps.Error("Cannot include file: " + err.Error())
+        return nil
+    }
+    defer f.Close()
+
+    incState := newParseState(f, path, false)
+    incState.includedFrom = includedFrom
+    nodeList, err := parse(incState)
+    if err != nil {
+        // Stop parsing so that the error is reported with the include chain
+        ps.includeErr = err
+        ps.atEof = true
+        return nil
+    }
+    return nodeList
+}
+
+// Returns the position of a declaration starting at the given line of the file being parsed
+func (ps *parseState) position(line int) Position {
+    return Position{ps.S.Position.Filename, line}
+}
+
+// Returns the absolute form of a path, or the path itself if it cannot be made absolute
+func absPath(path string) string {
+    if abs, err := filepath.Abs(path); err == nil {
+        return abs
+    }
+    return path
+}
+
+// Returns a node list with the nodes of the first list followed by the second list
+func appendNodeList(first, second *NodeList) *NodeList {
+    if first == nil {
+        return second
+    }
+    return &NodeList{first.Head, appendNodeList(first.Tail, second)}
+}
+
 
+// Parses a diagram.  Comments are discarded.
 func Parse(reader io.Reader, filename string) (*NodeList, error) {
-    ps := newParseState(reader, filename)
+    return parse(newParseState(reader, filename, false))
+}
+
+// Parses a diagram, keeping comments and blank lines between declarations as nodes.
+// Processing instructions are kept as comments.  Comments within attribute lists are
+// not supported.
+func ParseWithComments(reader io.Reader, filename string) (*NodeList, error) {
+    return parse(newParseState(reader, filename, true))
+}
+
+func parse(ps *parseState) (*NodeList, error) {
     yyParse(ps)
 
     // Add processing instructions to the start of the node list
@@ -557,7 +1113,9 @@ func Parse(reader io.Reader, filename string) (*NodeList, error) {
         ps.nodeList = &NodeList{&ProcessInstructionNode{name, value}, ps.nodeList}
     }
 
-    if ps.err != nil {
+    if ps.includeErr != nil {
+        return nil, ps.includeErr
+    } else if ps.err != nil {
         return nil, ps.err
     } else {
         return ps.nodeList, nil
@@ -30,12 +30,26 @@ const (
 	LOOP_SEGMENT                          = iota
 	CONCURRENT_SEGMENT                    = iota
 	CONCURRENT_WHILST_SEGMENT             = iota
+	CRITICAL_SEGMENT                      = iota
+	BREAK_SEGMENT                         = iota
+	NEG_SEGMENT                           = iota
+	IGNORE_SEGMENT                        = iota
+	CONSIDER_SEGMENT                      = iota
+	ASSERT_SEGMENT                        = iota
+	STRICT_SEGMENT                        = iota
+	SEQ_SEGMENT                           = iota
 	NONE_SEGMENT
 )
 
 type ArrowType struct {
 	Stem ArrowStemType
 	Head ArrowHeadType
+
+	// Tail is true if the arrow has a head at both ends, as in '<->'
+	Tail bool
+
+	// Reversed is true if the arrow is written from the receiver to the sender, as in '<-'
+	Reversed bool
 }
 
 // A list of declaration node
@@ -47,12 +61,36 @@ type NodeList struct {
 // A type of declaration node
 type Node interface{}
 
+// The position of a declaration in the source
+type Position struct {
+	Filename string
+	Line     int
+}
+
 // A processing instruction node
 type ProcessInstructionNode struct {
 	Prefix string
 	Value  string
 }
 
+// A comment node.  These are only produced by ParseWithComments.
+type CommentNode struct {
+	// The comment text, including the comment markers
+	Text string
+
+	// True if the comment follows a declaration on the same line
+	Trailing bool
+}
+
+// A blank line between declarations.  These are only produced by ParseWithComments.
+type BlankLineNode struct{}
+
+// An include statement.  These are only produced by ParseWithComments, as Parse replaces
+// them with the nodes of the included file.
+type IncludeNode struct {
+	Path string
+}
+
 // A title declaration node
 type TitleNode struct {
 	Title string
@@ -98,12 +136,62 @@ type NormalActorRef string
 // A reference to a pseudo actor
 type PseudoActorRef string
 
+// Changes to the activation of the actors made by an action
+type ActionActivation int
+
+const (
+	NO_ACTION_ACTIVATION ActionActivation = iota
+	ACTIVATE_TARGET
+	DEACTIVATE_SOURCE
+)
+
 // An action node
 type ActionNode struct {
-	From  ActorRef
-	To    ActorRef
-	Arrow ArrowType
-	Descr string
+	From       ActorRef
+	To         ActorRef
+	Arrow      ArrowType
+	Descr      string
+	Activation ActionActivation
+	Create     bool
+	Delay      int
+	Attributes *AttributeList
+}
+
+// Activation node
+type ActivationType int
+
+const (
+	ACTIVATE ActivationType = iota
+	DEACTIVATE
+)
+
+type ActivationNode struct {
+	Actor ActorRef
+	Type  ActivationType
+}
+
+// Creation node
+type CreateNode struct {
+	Actor ActorRef
+}
+
+// Destruction node
+type DestroyNode struct {
+	Actor ActorRef
+}
+
+// Automatic numbering node
+type AutoNumberType int
+
+const (
+	AUTONUMBER_START AutoNumberType = iota
+	AUTONUMBER_STOP
+	AUTONUMBER_RESUME
+)
+
+type AutoNumberNode struct {
+	Type       AutoNumberType
+	Attributes *AttributeList
 }
 
 // Note node
@@ -119,8 +207,17 @@ type NoteNode struct {
 	Actor1 ActorRef
 	Actor2 ActorRef // Can be nil
 
-	Position NoteAlignment
-	Descr    string
+	Position   NoteAlignment
+	Attributes *AttributeList
+	Descr      string
+}
+
+// A reference to another interaction, drawn over one or two actors
+type RefNode struct {
+	Actor1     ActorRef
+	Actor2     ActorRef // Can be nil
+	Attributes *AttributeList
+	Descr      string
 }
 
 // Gap node
@@ -134,8 +231,9 @@ const (
 )
 
 type GapNode struct {
-	Type  GapType
-	Descr string
+	Type       GapType
+	Attributes *AttributeList
+	Descr      string
 }
 
 // A block node.  Each block can have one or more segments
@@ -143,6 +241,32 @@ type BlockNode struct {
 	Segments *BlockSegmentList
 }
 
+// A definition of a sequence of declarations which can be used elsewhere in the diagram.
+// The parameters are replaced with the actors given when the sequence is used.
+type DefineNode struct {
+	Name     string
+	Params   []string
+	SubNodes *NodeList
+	Pos      Position
+}
+
+// A use of a defined sequence
+type UseNode struct {
+	Name       string
+	Args       []ActorRef
+	Attributes *AttributeList
+	Descr      string
+	Pos        Position
+}
+
+// A box drawn around a group of participants.  The sub nodes are the participant
+// declarations within the box.
+type BoxNode struct {
+	Label      string
+	Attributes *AttributeList
+	SubNodes   *NodeList
+}
+
 type BlockSegmentList struct {
 	Head *BlockSegment
 	Tail *BlockSegmentList
@@ -154,6 +278,9 @@ type BlockSegment struct {
 	Message       string
 	AttributeList *AttributeList
 	SubNodes      *NodeList
+
+	// The messages of an ignore or consider segment
+	Messages []string
 }
 
 // Attributes
@@ -0,0 +1,82 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+
+		// The expected error, in which "$DIR/" is replaced with the directory of the files
+		wantErr string
+	}{
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"main.seq": "include \"a.seq\"\n",
+				"a.seq":    "A->B: x\ninclude \"b.seq\"\n",
+				"b.seq":    "include \"a.seq\"\n",
+			},
+			wantErr: "$DIR/b.seq:1: Include cycle: $DIR/a.seq -> $DIR/b.seq -> $DIR/a.seq\n" +
+				"\tincluded from $DIR/a.seq:2\n" +
+				"\tincluded from $DIR/main.seq:1",
+		},
+		{
+			name: "file including itself",
+			files: map[string]string{
+				"main.seq": "A->B: x\n\ninclude \"main.seq\"\n",
+			},
+			wantErr: "$DIR/main.seq:3: Include cycle: $DIR/main.seq -> $DIR/main.seq",
+		},
+		{
+			name: "error in included file",
+			files: map[string]string{
+				"main.seq": "title: Main\n\ninclude \"a.seq\"\nA->B: x\n",
+				"a.seq":    "A->B: x\ninclude \"b.seq\"\n",
+				"b.seq":    "A->B: x\nA->: missing actor\n",
+			},
+			wantErr: "$DIR/b.seq:2: syntax error\n" +
+				"\tincluded from $DIR/a.seq:2\n" +
+				"\tincluded from $DIR/main.seq:3",
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"main.seq": "include \"missing.seq\"\n",
+			},
+			wantErr: "$DIR/main.seq:1: Cannot include file: open $DIR/missing.seq: no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, src := range test.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mainFile := filepath.Join(dir, "main.seq")
+			f, err := os.Open(mainFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			wantErr := strings.ReplaceAll(test.wantErr, "$DIR/", dir+string(filepath.Separator))
+			nodes, err := Parse(f, mainFile)
+			if err == nil || err.Error() != wantErr {
+				t.Errorf("want error:\n%s\ngot:\n%v", wantErr, err)
+			}
+			if nodes != nil {
+				t.Errorf("want no nodes on error")
+			}
+		})
+	}
+}
@@ -0,0 +1,947 @@
+package plantuml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lmika/goseq/seqdiagram"
+)
+
+// Icons for the participant keywords
+var participantKeywordIcons = map[string]string{
+	"participant": "",
+	"actor":       "human",
+	"database":    "cylinder",
+	"queue":       "horiz-cylinder",
+	"boundary":    "",
+	"control":     "",
+	"entity":      "",
+	"collections": "",
+}
+
+// Segment types for the keywords which start a block
+var blockSegmentTypes = map[string]seqdiagram.SegmentType{
+	"alt":      seqdiagram.AltSegmentType,
+	"opt":      seqdiagram.OptSegmentType,
+	"loop":     seqdiagram.LoopSegmentType,
+	"par":      seqdiagram.ParSegmentType,
+	"group":    seqdiagram.EmptySegmentType,
+	"break":    seqdiagram.BreakSegmentType,
+	"critical": seqdiagram.CriticalSegmentType,
+}
+
+var rightArrowHeads = map[string]seqdiagram.ArrowHead{
+	">":    seqdiagram.SolidArrowHead,
+	">>":   seqdiagram.OpenArrowHead,
+	"\\":   seqdiagram.BarbArrowHead,
+	"\\\\": seqdiagram.BarbArrowHead,
+	"/":    seqdiagram.LowerBarbArrowHead,
+	"//":   seqdiagram.LowerBarbArrowHead,
+}
+
+var leftArrowHeads = map[string]seqdiagram.ArrowHead{
+	"<":    seqdiagram.SolidArrowHead,
+	"<<":   seqdiagram.OpenArrowHead,
+	"/":    seqdiagram.BarbArrowHead,
+	"//":   seqdiagram.BarbArrowHead,
+	"\\":   seqdiagram.LowerBarbArrowHead,
+	"\\\\": seqdiagram.LowerBarbArrowHead,
+}
+
+// Multi-line constructs which are not supported, keyed by their first word, along with
+// the line which ends them
+var skippedSections = map[string]*regexp.Regexp{
+	"legend": regexp.MustCompile(`^end\s*legend$`),
+	"header": regexp.MustCompile(`^end\s*header$`),
+	"footer": regexp.MustCompile(`^end\s*footer$`),
+}
+
+// Single line statements which are not supported
+var unsupportedKeywords = map[string]bool{
+	"autoactivate": true,
+	"caption":      true,
+	"footer":       true,
+	"header":       true,
+	"hide":         true,
+	"legend":       true,
+	"mainframe":    true,
+	"newpage":      true,
+	"return":       true,
+	"scale":        true,
+	"show":         true,
+	"skinparam":    true,
+}
+
+var (
+	noteRegexp       = regexp.MustCompile(`^[hr]?note\s+(left|right|over|across)\b(?:\s+of\b)?([^:]*)(?::(.*))?$`)
+	endNoteRegexp    = regexp.MustCompile(`^end\s*[hr]?note$`)
+	endTitleRegexp   = regexp.MustCompile(`^end\s*title$`)
+	refRegexp        = regexp.MustCompile(`^ref\s+over\b([^:]*)(?::(.*))?$`)
+	endRefRegexp     = regexp.MustCompile(`^end\s*ref$`)
+	spacerRegexp     = regexp.MustCompile(`^\|\|\d*\|\|$`)
+	colorRegexp      = regexp.MustCompile(`#\w+`)
+	arrowStyleRegexp = regexp.MustCompile(`\[[^\]]*\]`)
+	textColorRegexp  = regexp.MustCompile(`^<color:([^>]+)>(.*)</color>$`)
+	blockColorRegexp = regexp.MustCompile(`^(#\w+)\s*(.*)$`)
+	autoNumberRegexp = regexp.MustCompile(`^(?:(stop|resume)\b\s*)?(\d+)?\s*(\d+)?\s*(?:"(.*)")?$`)
+	htmlTagRegexp    = regexp.MustCompile(`<[^>]*>`)
+	digitsRegexp     = regexp.MustCompile(`[0#]+`)
+	slantRegexp      = regexp.MustCompile(`^\((\d+)\)`)
+)
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t")
+
+// Parse reads a PlantUML sequence diagram and converts it to a diagram.  Constructs which
+// cannot be converted are left out and returned as warnings against the lines they
+// appear on.
+func Parse(r io.Reader) (*seqdiagram.Diagram, []Warning, error) {
+	pp := &parser{
+		diagram: seqdiagram.NewDiagram(),
+		scanner: bufio.NewScanner(r),
+	}
+
+	if err := pp.parse(); err != nil {
+		return nil, pp.warnings, err
+	}
+	return pp.diagram, pp.warnings, nil
+}
+
+type parser struct {
+	diagram  *seqdiagram.Diagram
+	scanner  *bufio.Scanner
+	lineNo   int
+	warnings []Warning
+
+	// The blocks which have not yet been ended, innermost last
+	blocks []*openBlock
+
+	// The last message, which notes without a participant are placed against
+	lastAction *seqdiagram.Action
+
+	// The box which has not yet been ended, and the line it started on
+	group       *seqdiagram.ActorGroup
+	groupLineNo int
+
+	hideFootbox bool
+}
+
+// A block which has not yet been ended
+type openBlock struct {
+	block   *seqdiagram.Block
+	keyword string
+	lineNo  int
+}
+
+func (pp *parser) warn(format string, args ...interface{}) {
+	pp.warnings = append(pp.warnings, Warning{
+		Line:    pp.lineNo,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Reads the next line, with the surrounding whitespace removed.  Returns false at the
+// end of the input.
+func (pp *parser) nextLine() (string, bool) {
+	if !pp.scanner.Scan() {
+		return "", false
+	}
+	pp.lineNo++
+	return strings.TrimSpace(pp.scanner.Text()), true
+}
+
+func (pp *parser) parse() error {
+	for {
+		line, ok := pp.nextLine()
+		if !ok {
+			break
+		}
+		pp.parseLine(line)
+	}
+
+	if err := pp.scanner.Err(); err != nil {
+		return err
+	}
+
+	if pp.group != nil {
+		pp.warnings = append(pp.warnings, Warning{Line: pp.groupLineNo, Message: "box is missing an end"})
+		pp.endBox()
+	}
+
+	for i := len(pp.blocks) - 1; i >= 0; i-- {
+		pp.warnings = append(pp.warnings, Warning{
+			Line:    pp.blocks[i].lineNo,
+			Message: fmt.Sprintf("%s block is missing an end", pp.blocks[i].keyword),
+		})
+	}
+
+	if pp.hideFootbox {
+		for _, actor := range pp.diagram.Actors {
+			actor.InFooter = false
+		}
+	}
+	return nil
+}
+
+func (pp *parser) parseLine(line string) {
+	keyword, rest := splitKeyword(line)
+
+	switch {
+	case line == "", strings.HasPrefix(line, "'"), strings.HasPrefix(line, "@"):
+		return
+	case strings.HasPrefix(line, "/'"):
+		pp.skipComment(line)
+	case strings.HasPrefix(line, "==") && strings.HasSuffix(line, "==") && len(line) >= 4:
+		pp.addItem(&seqdiagram.Divider{
+			Message: unescapeText(strings.TrimSpace(strings.Trim(line, "="))),
+			Type:    seqdiagram.DTLine,
+		})
+	case strings.HasPrefix(line, "..."):
+		pp.addItem(&seqdiagram.Divider{
+			Message: unescapeText(strings.TrimSpace(strings.Trim(line, "."))),
+			Type:    seqdiagram.DTGap,
+		})
+	case line == "|||" || spacerRegexp.MatchString(line):
+		pp.addItem(&seqdiagram.Divider{Type: seqdiagram.DTSpacer})
+	case keyword == "title":
+		pp.parseTitle(rest)
+	case participantKeywordExists(keyword):
+		if actor := pp.parseParticipant(keyword, rest); actor != nil && pp.group != nil {
+			pp.group.Actors = append(pp.group.Actors, actor)
+		}
+	case keyword == "box":
+		pp.parseBox(rest)
+	case keyword == "create":
+		pp.parseCreate(rest)
+	case keyword == "destroy":
+		if name, _, _ := scanName(rest); name != "" {
+			pp.addItem(&seqdiagram.Destruction{Actor: pp.diagram.GetOrAddActor(name)})
+		} else {
+			pp.warn("destroy is missing a participant")
+		}
+	case keyword == "note" || keyword == "hnote" || keyword == "rnote":
+		pp.parseNote(line)
+	case keyword == "ref":
+		pp.parseRef(line)
+	case keyword == "activate" || keyword == "deactivate":
+		pp.parseActivation(keyword, rest)
+	case keyword == "autonumber":
+		pp.parseAutoNumber(rest)
+	case keyword == "else":
+		pp.parseElse(rest)
+	case keyword == "end":
+		pp.parseEnd(rest)
+	case hasBlockSegmentType(keyword):
+		pp.openBlock(keyword, rest)
+	case line == "hide footbox":
+		pp.hideFootbox = true
+	case keyword == "skinparam" && strings.HasSuffix(line, "{"):
+		pp.warn("skinparam is not supported")
+		pp.skipUntil(func(l string) bool { return l == "}" })
+	case startsSkippedSection(keyword, rest):
+		pp.warn("%s is not supported", keyword)
+		pp.skipUntil(skippedSections[keyword].MatchString)
+	case unsupportedKeywords[keyword] || strings.HasPrefix(line, "!"):
+		pp.warn("%s is not supported", keyword)
+	default:
+		if !pp.parseMessage(line) {
+			pp.warn("unrecognised line: %s", line)
+		}
+	}
+}
+
+// Adds an item to the innermost block, or the diagram if there are no blocks
+func (pp *parser) addItem(item seqdiagram.SequenceItem) {
+	if len(pp.blocks) == 0 {
+		pp.diagram.AddSequenceItem(item)
+		return
+	}
+
+	segs := pp.blocks[len(pp.blocks)-1].block.Segments
+	seg := segs[len(segs)-1]
+	seg.SubItems = append(seg.SubItems, item)
+}
+
+// Skips a block comment which starts on the given line
+func (pp *parser) skipComment(line string) {
+	if strings.Contains(line[2:], "'/") {
+		return
+	}
+	pp.skipUntil(func(l string) bool { return strings.Contains(l, "'/") })
+}
+
+// Skips lines up to and including the first one which matches
+func (pp *parser) skipUntil(isEnd func(line string) bool) {
+	for {
+		line, ok := pp.nextLine()
+		if !ok || isEnd(line) {
+			return
+		}
+	}
+}
+
+// Reads the lines of a multi-line construct, up to the line which ends it
+func (pp *parser) readUntil(isEnd func(line string) bool) string {
+	startLine := pp.lineNo
+
+	lines := make([]string, 0)
+	for {
+		line, ok := pp.nextLine()
+		if !ok {
+			pp.warnings = append(pp.warnings, Warning{Line: startLine, Message: "missing end"})
+			break
+		} else if isEnd(line) {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (pp *parser) parseTitle(rest string) {
+	if rest != "" {
+		pp.diagram.Title = unescapeText(rest)
+		return
+	}
+	pp.diagram.Title = pp.readUntil(endTitleRegexp.MatchString)
+}
+
+// Parses the declaration of a participant.  Returns the participant, or nil if the
+// declaration is missing a name.
+func (pp *parser) parseParticipant(keyword, rest string) *seqdiagram.Actor {
+	first, firstQuoted, rest := scanName(rest)
+	if first == "" {
+		pp.warn("%s is missing a name", keyword)
+		return nil
+	}
+
+	name, label := first, first
+	if alias, isAlias := strings.CutPrefix(rest, "as "); isAlias {
+		second, secondQuoted, remaining := scanName(strings.TrimSpace(alias))
+		if second != "" {
+			rest = remaining
+			if !firstQuoted && secondQuoted {
+				name, label = first, second
+			} else {
+				name, label = second, first
+			}
+		}
+	}
+
+	actor := pp.diagram.GetOrAddActorWithOptions(name, unescapeText(label))
+	actor.Label = unescapeText(label)
+
+	if iconName := participantKeywordIcons[keyword]; iconName != "" {
+		if icon, err := seqdiagram.LookupActorIcon(iconName); err == nil {
+			actor.Icon = icon
+		}
+	} else if keyword != "participant" {
+		pp.warn("%s participants are not supported", keyword)
+	}
+
+	if rest != "" {
+		pp.warn("participant options are not supported: %s", rest)
+	}
+	return actor
+}
+
+// Parses a create statement, which is followed by a participant declaration with an
+// optional participant keyword
+func (pp *parser) parseCreate(rest string) {
+	keyword, declaration := splitKeyword(rest)
+	if !participantKeywordExists(keyword) {
+		keyword, declaration = "participant", rest
+	}
+
+	if actor := pp.parseParticipant(keyword, declaration); actor != nil {
+		pp.addItem(&seqdiagram.Creation{Actor: actor})
+	}
+}
+
+func (pp *parser) parseNote(line string) {
+	match := noteRegexp.FindStringSubmatch(line)
+	if match == nil {
+		pp.warn("unrecognised note: %s", line)
+		return
+	}
+
+	position, actorNames, text := match[1], strings.TrimSpace(match[2]), match[3]
+
+	note := &seqdiagram.Note{}
+	if strings.HasPrefix(line, "hnote") {
+		note.Shape = seqdiagram.HexagonNoteShape
+	}
+	if color := colorRegexp.FindString(actorNames); color != "" {
+		note.Color = pp.convertColor(color, "note")
+		actorNames = strings.TrimSpace(colorRegexp.ReplaceAllString(actorNames, ""))
+	}
+
+	switch position {
+	case "left":
+		note.Align = seqdiagram.LeftNoteAlignment
+	case "right":
+		note.Align = seqdiagram.RightNoteAlignment
+	default:
+		note.Align = seqdiagram.OverNoteAlignment
+	}
+
+	if position == "across" {
+		note.Actor1, note.Actor2 = seqdiagram.LeftOffsideActor, seqdiagram.RightOffsideActor
+	} else if actorNames != "" {
+		names := strings.SplitN(actorNames, ",", 2)
+		note.Actor1 = pp.actor(names[0])
+		if len(names) > 1 {
+			note.Actor2 = pp.actor(names[1])
+		}
+	} else if pp.lastAction != nil {
+		// Notes without a participant are placed against the last message
+		note.Actor1 = pp.lastAction.From
+		if position == "right" {
+			note.Actor1 = pp.lastAction.To
+		}
+	}
+
+	if !strings.Contains(line, ":") {
+		text = pp.readUntil(endNoteRegexp.MatchString)
+	} else {
+		text = unescapeText(strings.TrimSpace(text))
+	}
+	note.TextColor, text = pp.noteTextColor(text)
+
+	if note.Actor1 == nil {
+		pp.warn("note is missing a participant")
+		return
+	}
+	note.Message = text
+	pp.addItem(note)
+}
+
+// Parses a reference over one or more participants.  The reference is placed over the
+// first and last participants.
+func (pp *parser) parseRef(line string) {
+	match := refRegexp.FindStringSubmatch(line)
+	if match == nil {
+		pp.warn("unrecognised ref: %s", line)
+		return
+	}
+
+	actorNames, text := strings.TrimSpace(match[1]), match[2]
+	if colorRegexp.MatchString(actorNames) {
+		pp.warn("ref colours are not supported")
+		actorNames = strings.TrimSpace(colorRegexp.ReplaceAllString(actorNames, ""))
+	}
+
+	if !strings.Contains(line, ":") {
+		text = pp.readUntil(endRefRegexp.MatchString)
+	} else {
+		text = unescapeText(strings.TrimSpace(text))
+	}
+
+	if actorNames == "" {
+		pp.warn("ref is missing a participant")
+		return
+	}
+
+	names := strings.Split(actorNames, ",")
+	ref := &seqdiagram.Ref{Actor1: pp.actor(names[0]), Actor2: pp.actor(names[len(names)-1]), Message: text}
+	pp.addItem(ref)
+}
+
+func (pp *parser) openBlock(keyword, message string) {
+	color, message := pp.segmentColor(message)
+	seg := &seqdiagram.BlockSegment{
+		Type:    blockSegmentTypes[keyword],
+		Message: unescapeText(message),
+		Color:   color,
+	}
+
+	block := &seqdiagram.Block{Segments: []*seqdiagram.BlockSegment{seg}}
+	pp.addItem(block)
+	pp.blocks = append(pp.blocks, &openBlock{block, keyword, pp.lineNo})
+}
+
+func (pp *parser) parseElse(message string) {
+	if len(pp.blocks) == 0 {
+		pp.warn("else outside of a block")
+		return
+	}
+
+	top := pp.blocks[len(pp.blocks)-1]
+	segType := seqdiagram.ElseSegmentType
+	if top.keyword == "par" {
+		segType = seqdiagram.ParElseSegmentType
+	}
+
+	color, message := pp.segmentColor(message)
+	top.block.Segments = append(top.block.Segments, &seqdiagram.BlockSegment{
+		Type:    segType,
+		Message: unescapeText(message),
+		Color:   color,
+	})
+}
+
+// Splits the colour from the start of the message of a block segment, such as "#pink failure"
+func (pp *parser) segmentColor(message string) (string, string) {
+	if m := blockColorRegexp.FindStringSubmatch(message); m != nil {
+		return pp.convertColor(m[1], "block"), m[2]
+	}
+	return "", message
+}
+
+// Parses the start of a box around participants, with an optional label and colour
+func (pp *parser) parseBox(rest string) {
+	if pp.group != nil {
+		pp.warn("boxes cannot be nested")
+		return
+	}
+
+	label, color := rest, ""
+	if quoted, isQuoted, remaining := scanName(rest); isQuoted {
+		label, color = quoted, remaining
+	} else if idx := strings.Index(rest, "#"); idx >= 0 {
+		label, color = strings.TrimSpace(rest[:idx]), rest[idx:]
+	}
+
+	if color != "" {
+		color = pp.convertColor(color, "box")
+	}
+
+	pp.group = &seqdiagram.ActorGroup{Label: unescapeText(label), Color: color}
+	pp.groupLineNo = pp.lineNo
+}
+
+// Adds the open box to the diagram
+func (pp *parser) endBox() {
+	group := pp.group
+	pp.group = nil
+
+	if len(group.Actors) == 0 {
+		pp.warn("boxes without participants are not supported")
+	} else if err := pp.diagram.AddActorGroup(group); err != nil {
+		pp.warn("%s", err.Error())
+	}
+}
+
+func (pp *parser) parseEnd(rest string) {
+	switch {
+	case rest == "box":
+		if pp.group == nil {
+			pp.warn("end box outside of a box")
+			return
+		}
+		pp.endBox()
+	case rest != "":
+		pp.warn("unrecognised line: end %s", rest)
+	case len(pp.blocks) == 0:
+		pp.warn("end outside of a block")
+	default:
+		pp.blocks = pp.blocks[:len(pp.blocks)-1]
+	}
+}
+
+// Parses a message between two participants.  Returns false if the line is not a message.
+func (pp *parser) parseMessage(line string) bool {
+	fromName, fromQuoted, rest := scanParticipantRef(line)
+	arrow, rest := scanArrow(strings.TrimSpace(rest))
+	color, width, arrow := pp.parseArrowStyle(arrow)
+
+	// Sloped messages have the height of the slope following the arrow, which is
+	// converted to the number of rows the message is delayed by
+	delay := 0
+	if m := slantRegexp.FindStringSubmatch(rest); m != nil {
+		height, _ := strconv.Atoi(m[1])
+		if delay = (height + delayRowHeight/2) / delayRowHeight; delay == 0 {
+			delay = 1
+		}
+		rest = rest[len(m[0]):]
+	}
+
+	toName, toQuoted, rest := scanParticipantRef(strings.TrimSpace(rest))
+	if fromName == "" || arrow == "" || toName == "" {
+		return false
+	}
+
+	rest = strings.TrimSpace(rest)
+	text := ""
+	if before, after, hasText := strings.Cut(rest, ":"); hasText {
+		rest, text = strings.TrimSpace(before), unescapeText(strings.TrimSpace(after))
+	}
+	textColor := color
+	if m := textColorRegexp.FindStringSubmatch(text); m != nil {
+		textColor, text = pp.convertColor(m[1], "message"), m[2]
+	}
+	createTarget, destroyTarget, activateTarget, deactivateSource := false, false, false, false
+	switch rest {
+	case "":
+	case "**":
+		createTarget = true
+	case "!!":
+		destroyTarget = true
+	case "++":
+		activateTarget = true
+	case "--":
+		deactivateSource = true
+	case "--++", "++--":
+		activateTarget, deactivateSource = true, true
+	default:
+		pp.warn("message options are not supported: %s", rest)
+	}
+
+	arrowModel, reversed, lost := pp.convertArrow(arrow)
+
+	from, to := pp.participantRefActor(fromName, fromQuoted), pp.participantRefActor(toName, toQuoted)
+	if reversed {
+		from, to = to, from
+	}
+
+	// Arrows with a cross at the head are lost before they reach the receiver
+	if lost {
+		if isPseudoActor(from) {
+			pp.warn("lost messages must be sent by a participant")
+			return true
+		}
+		to = seqdiagram.LostActor
+	}
+
+	// Short arrows are lost messages if they end at the '?', and found messages if they
+	// start there
+	if from == seqdiagram.LostActor {
+		from = seqdiagram.FoundActor
+	}
+	if (to == seqdiagram.LostActor && isPseudoActor(from)) || (from == seqdiagram.FoundActor && isPseudoActor(to)) {
+		pp.warn("short arrows must start or end at a participant")
+		return true
+	}
+
+	if (createTarget || destroyTarget) && isPseudoActor(to) {
+		pp.warn("only participants can be created or destroyed")
+		createTarget, destroyTarget = false, false
+	}
+
+	if createTarget {
+		pp.addItem(&seqdiagram.Creation{Actor: to})
+	}
+
+	if delay > 0 && (from == to || isPseudoActor(from) || isPseudoActor(to)) {
+		pp.warn("sloped messages must be sent between two different participants")
+		delay = 0
+	}
+
+	action := &seqdiagram.Action{From: from, To: to, Arrow: arrowModel, Message: text, Delay: delay,
+		Color: color, TextColor: textColor, Width: width}
+	pp.addItem(action)
+	pp.lastAction = action
+
+	if destroyTarget {
+		pp.addItem(&seqdiagram.Destruction{Actor: to})
+	}
+
+	if deactivateSource {
+		pp.addActivation(from, seqdiagram.EndActivation)
+	}
+	if activateTarget {
+		pp.addActivation(to, seqdiagram.StartActivation)
+	}
+	return true
+}
+
+// Parses an activate or deactivate statement
+func (pp *parser) parseActivation(keyword, rest string) {
+	name, _, rest := scanName(rest)
+	if name == "" {
+		pp.warn("%s is missing a participant", keyword)
+		return
+	}
+	if strings.TrimSpace(rest) != "" {
+		pp.warn("activation colours are not supported")
+	}
+
+	activationType := seqdiagram.StartActivation
+	if keyword == "deactivate" {
+		activationType = seqdiagram.EndActivation
+	}
+	pp.addActivation(pp.diagram.GetOrAddActor(name), activationType)
+}
+
+// Parses an autonumber statement.  The digits of the number format are replaced with the
+// '#' used by goseq, and any HTML tags are removed.
+func (pp *parser) parseAutoNumber(rest string) {
+	match := autoNumberRegexp.FindStringSubmatch(rest)
+	if match == nil {
+		pp.warn("autonumber %s is not supported", rest)
+		return
+	}
+
+	switch match[1] {
+	case "stop":
+		pp.addItem(&seqdiagram.AutoNumber{Type: seqdiagram.StopAutoNumber})
+		return
+	case "resume":
+		if match[2] != "" || match[4] != "" {
+			pp.warn("changing the numbering when resuming is not supported")
+		}
+		pp.addItem(&seqdiagram.AutoNumber{Type: seqdiagram.ResumeAutoNumber})
+		return
+	}
+
+	autoNumber := &seqdiagram.AutoNumber{Type: seqdiagram.StartAutoNumber, Start: 1, Step: 1}
+	if match[2] != "" {
+		autoNumber.Start, _ = strconv.Atoi(match[2])
+	}
+	if match[3] != "" {
+		autoNumber.Step, _ = strconv.Atoi(match[3])
+	}
+	if match[4] != "" {
+		autoNumber.Format = digitsRegexp.ReplaceAllString(htmlTagRegexp.ReplaceAllString(match[4], ""), "#")
+	}
+	pp.addItem(autoNumber)
+}
+
+// Adds an activation of an actor.  The sides of the diagram and the ends of lost and found
+// messages cannot be activated.
+func (pp *parser) addActivation(actor *seqdiagram.Actor, activationType seqdiagram.ActivationType) {
+	if isPseudoActor(actor) {
+		pp.warn("activations of the sides of the diagram are not supported")
+		return
+	}
+	pp.addItem(&seqdiagram.Activation{Actor: actor, Type: activationType})
+}
+
+// Parses the style of an arrow, such as -[#red,thickness=2]->.  Returns the colour and width
+// of the arrow, and the arrow without the style.
+func (pp *parser) parseArrowStyle(arrow string) (color string, width int, rest string) {
+	style := arrowStyleRegexp.FindString(arrow)
+	if style == "" {
+		return "", 0, arrow
+	}
+
+	for _, option := range strings.Split(strings.Trim(style, "[]"), ",") {
+		option = strings.TrimSpace(option)
+		if thickness, isThickness := strings.CutPrefix(option, "thickness="); isThickness {
+			if n, err := strconv.Atoi(thickness); err == nil && n >= 0 {
+				width = n
+			} else {
+				pp.warn("arrow thickness is not supported: %s", thickness)
+			}
+		} else if strings.HasPrefix(option, "#") {
+			color = pp.convertColor(option, "arrow")
+		} else if option != "" {
+			pp.warn("arrow style is not supported: %s", option)
+		}
+	}
+	return color, width, arrowStyleRegexp.ReplaceAllString(arrow, "")
+}
+
+// Returns the text colour of a note and the text without the colour.  The colour is only
+// recognised if each line of the text is given the same colour.
+func (pp *parser) noteTextColor(text string) (string, string) {
+	lines := strings.Split(text, "\n")
+	color := ""
+	for i, line := range lines {
+		m := textColorRegexp.FindStringSubmatch(line)
+		if m == nil || (i > 0 && m[1] != color) {
+			return "", text
+		}
+		color, lines[i] = m[1], m[2]
+	}
+	return pp.convertColor(color, "note text"), strings.Join(lines, "\n")
+}
+
+// Converts a PlantUML colour to the colour used by goseq.  Named colours can be written with
+// or without the leading '#'.
+func (pp *parser) convertColor(color, what string) string {
+	if hexColorRegexp.MatchString(color) {
+		return strings.ToLower(color)
+	} else if namedColor := strings.TrimPrefix(color, "#"); namedColorRegexp.MatchString(namedColor) {
+		return strings.ToLower(namedColor)
+	}
+	pp.warn("%s colour is not supported: %s", what, color)
+	return ""
+}
+
+// Converts an arrow to the model.  Returns true if the arrow points to the left, and true
+// if the arrow has a cross at its head, which marks a lost message.
+func (pp *parser) convertArrow(arrow string) (seqdiagram.Arrow, bool, bool) {
+	leftDecoration, rightDecoration := "", ""
+	if strings.HasPrefix(arrow, "o") || strings.HasPrefix(arrow, "x") {
+		leftDecoration, arrow = arrow[:1], arrow[1:]
+	}
+	if strings.HasSuffix(arrow, "o") || strings.HasSuffix(arrow, "x") {
+		arrow, rightDecoration = arrow[:len(arrow)-1], arrow[len(arrow)-1:]
+	}
+
+	stemStart, stemEnd := strings.Index(arrow, "-"), strings.LastIndex(arrow, "-")
+	leftHead, stem, rightHead := arrow[:stemStart], arrow[stemStart:stemEnd+1], arrow[stemEnd+1:]
+
+	result := seqdiagram.Arrow{Stem: seqdiagram.SolidArrowStem, Head: seqdiagram.SolidArrowHead}
+	if strings.Count(stem, "-") > 1 {
+		result.Stem = seqdiagram.DashedArrowStem
+	}
+
+	// Only a cross at the head of the arrow is supported, which is drawn as a lost message
+	reversed := leftHead != "" && rightHead == ""
+	headDecoration, tailDecoration := rightDecoration, leftDecoration
+	if reversed {
+		headDecoration, tailDecoration = leftDecoration, rightDecoration
+	}
+	if (headDecoration != "" && headDecoration != "x") || tailDecoration != "" {
+		pp.warn("arrow decorations are not supported")
+	}
+
+	if reversed {
+		if head, hasHead := leftArrowHeads[leftHead]; hasHead {
+			result.Head = head
+		} else {
+			pp.warn("unsupported arrow head: %s", leftHead)
+		}
+	} else if rightHead != "" {
+		if head, hasHead := rightArrowHeads[rightHead]; hasHead {
+			result.Head = head
+		} else {
+			pp.warn("unsupported arrow head: %s", rightHead)
+		}
+		if leftHead != "" {
+			result.TailHead = true
+			if head, hasHead := leftArrowHeads[leftHead]; !hasHead {
+				pp.warn("unsupported arrow head: %s", leftHead)
+			} else if head != result.Head {
+				pp.warn("arrows with different heads at each end are drawn with the right head")
+			}
+		}
+	} else {
+		pp.warn("arrows without heads are drawn with a solid head")
+	}
+	return result, reversed, headDecoration == "x"
+}
+
+// Returns the actor of a participant reference, which may be a side of the diagram
+func (pp *parser) participantRefActor(name string, quoted bool) *seqdiagram.Actor {
+	if !quoted {
+		switch name {
+		case "[":
+			return seqdiagram.LeftOffsideActor
+		case "]":
+			return seqdiagram.RightOffsideActor
+		case "?":
+			return seqdiagram.LostActor
+		}
+	}
+	return pp.diagram.GetOrAddActor(name)
+}
+
+// Returns the actor with the given name, which may be quoted
+func (pp *parser) actor(name string) *seqdiagram.Actor {
+	name, _, _ = scanName(strings.TrimSpace(name))
+	return pp.diagram.GetOrAddActor(name)
+}
+
+// Splits the first word of a line from the rest of the line
+func splitKeyword(line string) (string, string) {
+	keyword, rest, _ := strings.Cut(line, " ")
+	return strings.ToLower(keyword), strings.TrimSpace(rest)
+}
+
+// Returns true if the line starts a multi-line construct which is not supported
+func startsSkippedSection(keyword, rest string) bool {
+	switch keyword {
+	case "legend":
+		return true
+	case "header", "footer":
+		return rest == ""
+	}
+	return false
+}
+
+// Returns true if the actor is one of the sides of the diagram, or the end of a lost or
+// found message
+func isPseudoActor(actor *seqdiagram.Actor) bool {
+	switch actor {
+	case seqdiagram.LeftOffsideActor, seqdiagram.RightOffsideActor, seqdiagram.LostActor, seqdiagram.FoundActor:
+		return true
+	}
+	return false
+}
+
+func participantKeywordExists(keyword string) bool {
+	_, exists := participantKeywordIcons[keyword]
+	return exists
+}
+
+func hasBlockSegmentType(keyword string) bool {
+	_, exists := blockSegmentTypes[keyword]
+	return exists
+}
+
+// Scans a participant name from the start of s, which may be quoted.  Returns the name,
+// whether it was quoted, and the rest of s with the leading whitespace removed.
+func scanName(s string) (string, bool, string) {
+	if strings.HasPrefix(s, "\"") {
+		if end := strings.Index(s[1:], "\""); end >= 0 {
+			return s[1 : end+1], true, strings.TrimSpace(s[end+2:])
+		}
+		return "", false, s
+	}
+
+	end := strings.IndexFunc(s, func(r rune) bool { return !isNameRune(r) })
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], false, strings.TrimSpace(s[end:])
+}
+
+// Scans a participant reference from the start of s.  This is either a name, or one of
+// "[" or "]" for the sides of the diagram.
+func scanParticipantRef(s string) (string, bool, string) {
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "]") || strings.HasPrefix(s, "?") {
+		return s[:1], false, s[1:]
+	}
+	return scanName(s)
+}
+
+// Scans an arrow from the start of s.  Returns the arrow, or an empty string if s does
+// not start with an arrow, and the rest of s.
+func scanArrow(s string) (string, string) {
+	i := 0
+
+	// A leading decoration, such as "o->"
+	if len(s) > 1 && (s[0] == 'o' || s[0] == 'x') && strings.ContainsRune("<-/\\", rune(s[1])) {
+		i++
+	}
+
+	for i < len(s) {
+		if strings.ContainsRune("<>/\\-", rune(s[i])) {
+			i++
+		} else if s[i] == '[' && i > 0 && s[i-1] == '-' {
+			// An arrow style, such as "-[#red]>"
+			end := strings.Index(s[i:], "]")
+			if end < 0 {
+				return "", s
+			}
+			i += end + 1
+		} else {
+			break
+		}
+	}
+
+	// A trailing decoration, such as "->x"
+	if i < len(s) && (s[i] == 'o' || s[i] == 'x') && (i+1 == len(s) || !isNameRune(rune(s[i+1]))) {
+		i++
+	}
+
+	if !strings.Contains(s[:i], "-") {
+		return "", s
+	}
+	return s[:i], s[i:]
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+func unescapeText(text string) string {
+	return textUnescaper.Replace(text)
+}
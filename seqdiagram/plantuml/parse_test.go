@@ -0,0 +1,321 @@
+package plantuml
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lmika/goseq/seqdiagram"
+)
+
+func TestParseWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Warning
+	}{
+		{
+			name: "supported diagram",
+			src:  "@startuml\nA -> B : hello\nB --> A : world\n@enduml\n",
+			want: nil,
+		},
+		{
+			name: "unrecognised line",
+			src:  "A -> B\nthis is not plantuml\n",
+			want: []Warning{{2, "unrecognised line: this is not plantuml"}},
+		},
+		{
+			name: "unsupported keyword",
+			src:  "A -> B\n\nnewpage\n",
+			want: []Warning{{3, "newpage is not supported"}},
+		},
+		{
+			name: "skipped section",
+			src:  "legend\nsome legend\nend legend\nA -> B\nskinparam {\n  foo bar\n}\n",
+			want: []Warning{{1, "legend is not supported"}, {5, "skinparam is not supported"}},
+		},
+		{
+			name: "arrow style",
+			src:  "A -[#red,dotted]> B : hi\n",
+			want: []Warning{{1, "arrow style is not supported: dotted"}},
+		},
+		{
+			name: "arrow colour",
+			src:  "A -[#notacolour!]> B : hi\n",
+			want: []Warning{{1, "arrow colour is not supported: #notacolour!"}},
+		},
+		{
+			name: "arrow decoration",
+			src:  "A -> B\nA ->o B : hi\n",
+			want: []Warning{{2, "arrow decorations are not supported"}},
+		},
+		{
+			name: "arrow decoration at the tail",
+			src:  "A x-> B : hi\n",
+			want: []Warning{{1, "arrow decorations are not supported"}},
+		},
+		{
+			name: "lost message from a side",
+			src:  "[ ->x A\n",
+			want: []Warning{{1, "lost messages must be sent by a participant"}},
+		},
+		{
+			name: "arrow with different heads",
+			src:  "A <<-> B\n",
+			want: []Warning{{1, "arrows with different heads at each end are drawn with the right head"}},
+		},
+		{
+			name: "arrow without a head",
+			src:  "A - B\n",
+			want: []Warning{{1, "arrows without heads are drawn with a solid head"}},
+		},
+		{
+			name: "unsupported arrow head",
+			src:  "A ->>> B\n",
+			want: []Warning{{1, "unsupported arrow head: >>>"}},
+		},
+		{
+			name: "participant options",
+			src:  "participant A order 10\n",
+			want: []Warning{{1, "participant options are not supported: order 10"}},
+		},
+		{
+			name: "unsupported participant type",
+			src:  "boundary A\n",
+			want: []Warning{{1, "boundary participants are not supported"}},
+		},
+		{
+			name: "note colour",
+			src:  "note left of A #ff00 : hi\n",
+			want: []Warning{{1, "note colour is not supported: #ff00"}},
+		},
+		{
+			name: "note without a participant",
+			src:  "note left : hi\n",
+			want: []Warning{{1, "note is missing a participant"}},
+		},
+		{
+			name: "block without an end",
+			src:  "A -> B\nalt yes\nA -> B\nloop\nA -> B\n",
+			want: []Warning{{4, "loop block is missing an end"}, {2, "alt block is missing an end"}},
+		},
+		{
+			name: "else and end outside of a block",
+			src:  "else\nA -> B\nend\n",
+			want: []Warning{{1, "else outside of a block"}, {3, "end outside of a block"}},
+		},
+		{
+			name: "note without an end",
+			src:  "A -> B\nnote over A\nnever ends\n",
+			want: []Warning{{2, "missing end"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, warnings, err := Parse(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(warnings, test.want) {
+				t.Errorf("want warnings %v, got %v", test.want, warnings)
+			}
+		})
+	}
+}
+
+func TestParseMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantFrom string
+		wantTo   string
+		wantStem seqdiagram.ArrowStem
+		wantHead seqdiagram.ArrowHead
+		wantText string
+	}{
+		{"solid", "A -> B : hi", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, "hi"},
+		{"dashed", "A --> B", "A", "B", seqdiagram.DashedArrowStem, seqdiagram.SolidArrowHead, ""},
+		{"open", "A ->> B", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.OpenArrowHead, ""},
+		{"reversed", "A <- B : back", "B", "A", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, "back"},
+		{"lower barb", "A -/ B", "A", "B", seqdiagram.SolidArrowStem, seqdiagram.LowerBarbArrowHead, ""},
+		{"quoted names", `"Web Server" -> "Data base"`, "Web Server", "Data base", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, ""},
+		{"escaped text", `A -> B : one\ntwo`, "A", "B", seqdiagram.SolidArrowStem, seqdiagram.SolidArrowHead, "one\ntwo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, _, err := Parse(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(d.Items) != 1 {
+				t.Fatalf("want 1 item, got %d", len(d.Items))
+			}
+			action, isAction := d.Items[0].(*seqdiagram.Action)
+			if !isAction {
+				t.Fatalf("want an action, got %T", d.Items[0])
+			}
+
+			if action.From.Name != test.wantFrom || action.To.Name != test.wantTo {
+				t.Errorf("want message from %s to %s, got %s to %s", test.wantFrom, test.wantTo, action.From.Name, action.To.Name)
+			}
+			if action.Arrow.Stem != test.wantStem || action.Arrow.Head != test.wantHead {
+				t.Errorf("want arrow stem %v and head %v, got %v and %v", test.wantStem, test.wantHead, action.Arrow.Stem, action.Arrow.Head)
+			}
+			if action.Message != test.wantText {
+				t.Errorf("want message %q, got %q", test.wantText, action.Message)
+			}
+		})
+	}
+}
+
+func TestParseOffsideMessages(t *testing.T) {
+	d, _, err := Parse(strings.NewReader("[-> A\nA ->]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(d.Items))
+	}
+	if from := d.Items[0].(*seqdiagram.Action).From; from != seqdiagram.LeftOffsideActor {
+		t.Errorf("want message from the left side, got %v", from)
+	}
+	if to := d.Items[1].(*seqdiagram.Action).To; to != seqdiagram.RightOffsideActor {
+		t.Errorf("want message to the right side, got %v", to)
+	}
+	if len(d.Actors) != 1 {
+		t.Errorf("want 1 actor, got %d", len(d.Actors))
+	}
+}
+
+func TestParseMessageStyles(t *testing.T) {
+	d, warnings, err := Parse(strings.NewReader("A -[#Red,thickness=3]-> B : <color:#00FF00>hi</color>\nA -[#blue]> B : plain\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("want no warnings, got %v", warnings)
+	}
+	if len(d.Items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(d.Items))
+	}
+
+	styled := d.Items[0].(*seqdiagram.Action)
+	if styled.Color != "red" || styled.TextColor != "#00ff00" || styled.Width != 3 || styled.Message != "hi" {
+		t.Errorf("want red arrow of width 3 with green text 'hi', got %+v", styled)
+	}
+	if styled.Arrow.Stem != seqdiagram.DashedArrowStem {
+		t.Errorf("want dashed arrow stem, got %v", styled.Arrow.Stem)
+	}
+
+	plain := d.Items[1].(*seqdiagram.Action)
+	if plain.Color != "blue" || plain.TextColor != "blue" || plain.Width != 0 {
+		t.Errorf("want blue arrow with blue text, got %+v", plain)
+	}
+}
+
+func TestParseNoteStyles(t *testing.T) {
+	d, warnings, err := Parse(strings.NewReader("note left of A #Yellow : <color:red>hi</color>\nhnote over A : hexagon\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("want no warnings, got %v", warnings)
+	}
+	if len(d.Items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(d.Items))
+	}
+
+	colored := d.Items[0].(*seqdiagram.Note)
+	if colored.Color != "yellow" || colored.TextColor != "red" || colored.Message != "hi" {
+		t.Errorf("want yellow note with red text 'hi', got %+v", colored)
+	}
+	if shape := d.Items[1].(*seqdiagram.Note).Shape; shape != seqdiagram.HexagonNoteShape {
+		t.Errorf("want hexagon note, got %v", shape)
+	}
+}
+
+func TestParseLostMessages(t *testing.T) {
+	d, warnings, err := Parse(strings.NewReader("A ->x B : dropped\nB x<-- A : dropped\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("want no warnings, got %v", warnings)
+	}
+	if len(d.Items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(d.Items))
+	}
+	for _, item := range d.Items {
+		action := item.(*seqdiagram.Action)
+		if action.From.Name != "A" || action.To != seqdiagram.LostActor {
+			t.Errorf("want lost message from A, got message from %s to %v", action.From.Name, action.To)
+		}
+	}
+	if stem := d.Items[1].(*seqdiagram.Action).Arrow.Stem; stem != seqdiagram.DashedArrowStem {
+		t.Errorf("want dashed arrow stem, got %v", stem)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestParseTwoHeadedMessages(t *testing.T) {
+	d, warnings, err := Parse(strings.NewReader("A <-> B : both\nA <<-->> B : both\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("want no warnings, got %v", warnings)
+	}
+	if len(d.Items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(d.Items))
+	}
+	for _, item := range d.Items {
+		action := item.(*seqdiagram.Action)
+		if action.From.Name != "A" || action.To.Name != "B" || !action.Arrow.TailHead {
+			t.Errorf("want two headed message from A to B, got message from %s to %s with tail head %v",
+				action.From.Name, action.To.Name, action.Arrow.TailHead)
+		}
+	}
+	if arrow := d.Items[1].(*seqdiagram.Action).Arrow; arrow.Stem != seqdiagram.DashedArrowStem || arrow.Head != seqdiagram.OpenArrowHead {
+		t.Errorf("want dashed arrow stem and open head, got %v and %v", arrow.Stem, arrow.Head)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       io.Reader
+		wantErr string
+	}{
+		{"line too long", strings.NewReader("A -> B : " + strings.Repeat("x", bufio.MaxScanTokenSize)), "bufio.Scanner: token too long"},
+		{"read error", failingReader{}, "read failed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, _, err := Parse(test.r)
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("want error '%s', got %v", test.wantErr, err)
+			}
+			if d != nil {
+				t.Errorf("want no diagram on error")
+			}
+		})
+	}
+}
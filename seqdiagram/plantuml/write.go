@@ -0,0 +1,638 @@
+package plantuml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/lmika/goseq/seqdiagram"
+)
+
+// Participant keywords for the built-in actor icons
+var iconParticipantKeywords = map[string]string{
+	"human":          "actor",
+	"cylinder":       "database",
+	"horiz-cylinder": "queue",
+}
+
+var arrowStemMapping = map[seqdiagram.ArrowStem]string{
+	seqdiagram.SolidArrowStem:  "-",
+	seqdiagram.DashedArrowStem: "--",
+	seqdiagram.ThickArrowStem:  "-",
+}
+
+var arrowHeadMapping = map[seqdiagram.ArrowHead]string{
+	seqdiagram.SolidArrowHead:     ">",
+	seqdiagram.OpenArrowHead:      ">>",
+	seqdiagram.BarbArrowHead:      "\\",
+	seqdiagram.LowerBarbArrowHead: "/",
+}
+
+// Arrow heads for arrows pointing to the left
+var reversedArrowHeadMapping = map[seqdiagram.ArrowHead]string{
+	seqdiagram.SolidArrowHead: "<",
+	seqdiagram.OpenArrowHead:  "<<",
+}
+
+var activationKeywords = map[seqdiagram.ActivationType]string{
+	seqdiagram.StartActivation: "activate",
+	seqdiagram.EndActivation:   "deactivate",
+}
+
+var segmentKeywords = map[seqdiagram.SegmentType]string{
+	seqdiagram.AltSegmentType:              "alt",
+	seqdiagram.ElseSegmentType:             "else",
+	seqdiagram.ParSegmentType:              "par",
+	seqdiagram.ParElseSegmentType:          "else",
+	seqdiagram.OptSegmentType:              "opt",
+	seqdiagram.LoopSegmentType:             "loop",
+	seqdiagram.ConcurrentSegmentType:       "par",
+	seqdiagram.ConcurrentWhilstSegmentType: "else",
+	seqdiagram.CriticalSegmentType:         "critical",
+	seqdiagram.BreakSegmentType:            "break",
+	seqdiagram.NegSegmentType:              "group",
+	seqdiagram.IgnoreSegmentType:           "group",
+	seqdiagram.ConsiderSegmentType:         "group",
+	seqdiagram.AssertSegmentType:           "group",
+	seqdiagram.StrictSegmentType:           "group",
+	seqdiagram.SeqSegmentType:              "group",
+	seqdiagram.EmptySegmentType:            "group",
+}
+
+// Labels of the groups written for the fragments which are not supported by PlantUML
+var groupSegmentLabels = map[seqdiagram.SegmentType]string{
+	seqdiagram.NegSegmentType:      "neg",
+	seqdiagram.IgnoreSegmentType:   "ignore",
+	seqdiagram.ConsiderSegmentType: "consider",
+	seqdiagram.AssertSegmentType:   "assert",
+	seqdiagram.StrictSegmentType:   "strict",
+	seqdiagram.SeqSegmentType:      "seq",
+}
+
+// The height in pixels of the slope of a message for each row it is delayed by.  PlantUML
+// draws the messages following a sloped message below it, rather than beside it.
+const delayRowHeight = 30
+
+// Colours which can be written as PlantUML colours, either in hex or by name
+var hexColorRegexp = regexp.MustCompile(`^#(?:[0-9A-Fa-f]{3}){1,2}$`)
+var namedColorRegexp = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// Participant names which can be used without quotes
+var plainNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Write writes the diagram as PlantUML source.  Parts of the diagram which cannot be
+// represented in PlantUML are approximated or left out, and are returned as warnings
+// against the lines of the written source.
+func Write(w io.Writer, d *seqdiagram.Diagram) ([]Warning, error) {
+	pw := &writer{diagram: d, created: make(map[*seqdiagram.Actor]bool)}
+	pw.writeDiagram()
+
+	bw := bufio.NewWriter(w)
+	for _, line := range pw.lines {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return pw.warnings, err
+		}
+	}
+	return pw.warnings, bw.Flush()
+}
+
+type writer struct {
+	diagram  *seqdiagram.Diagram
+	created  map[*seqdiagram.Actor]bool
+	lines    []string
+	warnings []Warning
+	indent   int
+}
+
+// Adds a line to the output
+func (pw *writer) println(format string, args ...interface{}) {
+	pw.lines = append(pw.lines, strings.Repeat("    ", pw.indent)+fmt.Sprintf(format, args...))
+}
+
+// Adds a warning against the line which will be written next
+func (pw *writer) warn(format string, args ...interface{}) {
+	pw.warnings = append(pw.warnings, Warning{
+		Line:    len(pw.lines) + 1,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (pw *writer) writeDiagram() {
+	pw.println("@startuml")
+
+	if pw.diagram.Title != "" {
+		pw.println("title %s", escapeText(pw.diagram.Title))
+	}
+
+	pw.findCreatedActors(pw.diagram.Items)
+	pw.writeParticipants()
+
+	for _, item := range pw.diagram.Items {
+		pw.writeItem(item)
+	}
+
+	pw.println("@enduml")
+}
+
+// Finds the actors which are created part way through the diagram.  These are declared
+// where they are created, instead of with the other participants.
+func (pw *writer) findCreatedActors(items []seqdiagram.SequenceItem) {
+	for _, item := range items {
+		switch it := item.(type) {
+		case *seqdiagram.Creation:
+			pw.created[it.Actor] = true
+		case *seqdiagram.Block:
+			for _, seg := range it.Segments {
+				pw.findCreatedActors(seg.SubItems)
+			}
+		}
+	}
+}
+
+func (pw *writer) writeParticipants() {
+	groupOfActor := make(map[*seqdiagram.Actor]*seqdiagram.ActorGroup)
+	for _, group := range pw.diagram.Groups {
+		for _, actor := range group.Actors {
+			groupOfActor[actor] = group
+		}
+	}
+
+	hiddenFooters := 0
+	for _, actor := range pw.diagram.Actors {
+		if !actor.InFooter {
+			hiddenFooters++
+		}
+
+		if group, inGroup := groupOfActor[actor]; !inGroup {
+			if !pw.created[actor] {
+				pw.println("%s", pw.participantDeclaration(actor))
+			}
+		} else if group.Actors[0] == actor {
+			pw.writeGroup(group)
+		}
+	}
+
+	if hiddenFooters > 0 {
+		if hiddenFooters < len(pw.diagram.Actors) {
+			pw.warn("footers can only be hidden for all participants")
+		}
+		pw.println("hide footbox")
+	}
+}
+
+// Writes a box around the participants of a group
+func (pw *writer) writeGroup(group *seqdiagram.ActorGroup) {
+	line := "box"
+	if group.Label != "" {
+		line += " \"" + escapeText(group.Label) + "\""
+	}
+	if group.Color != "" {
+		if color, isColor := colorToPlantUML(group.Color); isColor {
+			line += " " + color
+		} else {
+			pw.warn("box colour \"%s\" is not supported", group.Color)
+		}
+	}
+	pw.println("%s", line)
+
+	pw.indent++
+	for _, actor := range group.Actors {
+		if pw.created[actor] {
+			pw.warn("participant %s: created participants cannot be placed within a box", actor.Name)
+			continue
+		}
+		pw.println("%s", pw.participantDeclaration(actor))
+	}
+	pw.indent--
+	pw.println("end box")
+}
+
+// Returns the declaration of a participant
+func (pw *writer) participantDeclaration(actor *seqdiagram.Actor) string {
+	keyword := "participant"
+	if actor.Icon != nil {
+		if iconKeyword, hasKeyword := iconParticipantKeywords[actor.Icon.Name()]; hasKeyword {
+			keyword = iconKeyword
+		} else {
+			pw.warn("participant %s: icon \"%s\" is not supported", actor.Name, actor.Icon.Name())
+		}
+	}
+
+	if !actor.InHeader {
+		pw.warn("participant %s: hiding the header is not supported", actor.Name)
+	}
+	if !actor.Lifeline {
+		pw.warn("participant %s: hiding the lifeline is not supported", actor.Name)
+	}
+	if actor.Color != "black" || actor.TextColor != "black" {
+		pw.warn("participant %s: colours are not supported", actor.Name)
+	}
+
+	if actor.Label == actor.Name {
+		return keyword + " " + participantName(actor)
+	}
+	return keyword + " \"" + escapeText(actor.Label) + "\" as " + participantName(actor)
+}
+
+func (pw *writer) writeItem(item seqdiagram.SequenceItem) {
+	switch it := item.(type) {
+	case *seqdiagram.Action:
+		pw.writeAction(it)
+	case *seqdiagram.Activation:
+		pw.writeActivation(it)
+	case *seqdiagram.Creation:
+		pw.println("create %s", pw.participantDeclaration(it.Actor))
+	case *seqdiagram.Destruction:
+		pw.println("destroy %s", participantName(it.Actor))
+	case *seqdiagram.AutoNumber:
+		pw.writeAutoNumber(it)
+	case *seqdiagram.Note:
+		pw.writeNote(it)
+	case *seqdiagram.Ref:
+		pw.writeRef(it)
+	case *seqdiagram.Divider:
+		pw.writeDivider(it)
+	case *seqdiagram.Block:
+		pw.writeBlock(it)
+	default:
+		pw.warn("unsupported item: %T", item)
+	}
+}
+
+func (pw *writer) writeAction(action *seqdiagram.Action) {
+	if action.Arrow.Stem == seqdiagram.ThickArrowStem {
+		pw.warn("thick arrow stems are not supported")
+	}
+
+	stem := pw.styleStem(arrowStemMapping[action.Arrow.Stem], action)
+	arrow := stem + arrowHeadMapping[action.Arrow.Head]
+	if action.Arrow.TailHead {
+		arrow = pw.leftArrowHead(action.Arrow.Head) + arrow
+	}
+
+	delay := ""
+	if action.Delay > 0 {
+		if isOffside(action.From) || isOffside(action.To) {
+			pw.warn("delayed messages to or from the sides of the diagram are not supported")
+		} else {
+			delay = fmt.Sprintf("(%d)", action.Delay*delayRowHeight)
+		}
+	}
+
+	var line string
+	switch {
+	case action.To == seqdiagram.LostActor:
+		line = participantName(action.From) + " " + arrow + "?"
+	case action.From == seqdiagram.FoundActor:
+		line = "?" + arrow + " " + participantName(action.To)
+	case isOffside(action.From) && isOffside(action.To):
+		pw.warn("messages between the left and right sides are not supported")
+		return
+	case action.From == seqdiagram.LeftOffsideActor:
+		line = "[" + arrow + " " + participantName(action.To)
+	case action.To == seqdiagram.RightOffsideActor:
+		line = participantName(action.From) + " " + arrow + "]"
+	case action.From == seqdiagram.RightOffsideActor, action.To == seqdiagram.LeftOffsideActor:
+		// Arrows to and from the sides of the diagram must start and end at a participant,
+		// so these need to point to the left
+		head := pw.leftArrowHead(action.Arrow.Head) + stem
+		if action.Arrow.TailHead {
+			head += arrowHeadMapping[action.Arrow.Head]
+		}
+
+		if action.To == seqdiagram.LeftOffsideActor {
+			line = "[" + head + " " + participantName(action.From)
+		} else {
+			line = participantName(action.To) + " " + head + "]"
+		}
+	default:
+		line = participantName(action.From) + " " + arrow + delay + " " + participantName(action.To)
+	}
+
+	if action.Message != "" {
+		message := escapeText(action.Message)
+		if action.TextColor != "" {
+			if _, isColor := colorToPlantUML(action.TextColor); isColor {
+				message = "<color:" + action.TextColor + ">" + message + "</color>"
+			} else {
+				pw.warn("message colour is not supported: %s", action.TextColor)
+			}
+		}
+		line += " : " + message
+	}
+	pw.println("%s", line)
+}
+
+// Returns the arrow head pointing to the left
+func (pw *writer) leftArrowHead(head seqdiagram.ArrowHead) string {
+	if left, hasHead := reversedArrowHeadMapping[head]; hasHead {
+		return left
+	}
+	pw.warn("half arrow heads pointing to the left are not supported")
+	return reversedArrowHeadMapping[seqdiagram.SolidArrowHead]
+}
+
+// Adds the colour and width of an action to an arrow stem, such as -[#red,thickness=2]-
+func (pw *writer) styleStem(stem string, action *seqdiagram.Action) string {
+	var options []string
+	if action.Color != "" {
+		if color, isColor := colorToPlantUML(action.Color); isColor {
+			options = append(options, color)
+		} else {
+			pw.warn("arrow colour is not supported: %s", action.Color)
+		}
+	}
+	if action.Width > 0 {
+		options = append(options, fmt.Sprintf("thickness=%d", action.Width))
+	}
+
+	if len(options) == 0 {
+		return stem
+	}
+	return stem[:1] + "[" + strings.Join(options, ",") + "]" + stem[1:]
+}
+
+func (pw *writer) writeActivation(activation *seqdiagram.Activation) {
+	if isOffside(activation.Actor) {
+		pw.warn("activations of the sides of the diagram are not supported")
+		return
+	}
+	pw.println("%s %s", activationKeywords[activation.Type], participantName(activation.Actor))
+}
+
+// Writes a change to the automatic numbering.  The '#' of the goseq number format is also
+// a digit in the PlantUML number format, so the format is written as is.
+func (pw *writer) writeAutoNumber(autoNumber *seqdiagram.AutoNumber) {
+	switch autoNumber.Type {
+	case seqdiagram.StopAutoNumber:
+		pw.println("autonumber stop")
+		return
+	case seqdiagram.ResumeAutoNumber:
+		pw.println("autonumber resume")
+		return
+	}
+
+	if autoNumber.Nested {
+		pw.warn("nested numbering is not supported")
+	}
+
+	line := "autonumber"
+	if autoNumber.Start != 1 || autoNumber.Step != 1 {
+		line += fmt.Sprintf(" %d %d", autoNumber.Start, autoNumber.Step)
+	}
+	if autoNumber.Format != "" {
+		line += " \"" + escapeText(autoNumber.Format) + "\""
+	}
+	pw.println("%s", line)
+}
+
+func (pw *writer) writeNote(note *seqdiagram.Note) {
+	if len(pw.diagram.Actors) == 0 {
+		pw.warn("notes without any participants are not supported")
+		return
+	}
+
+	var position string
+	switch {
+	case note.Align == seqdiagram.OverNoteAlignment && note.Actor1 == seqdiagram.LeftOffsideActor &&
+		note.Actor2 == seqdiagram.RightOffsideActor:
+		position = "across"
+	case note.Align == seqdiagram.OverNoteAlignment:
+		first, last := pw.noteActors(note)
+		if first == last {
+			position = "over " + participantName(first)
+		} else {
+			position = "over " + participantName(first) + ", " + participantName(last)
+		}
+	case note.Align == seqdiagram.LeftNoteAlignment:
+		first, _ := pw.noteActors(note)
+		position = "left of " + participantName(first)
+	default:
+		_, last := pw.noteActors(note)
+		position = "right of " + participantName(last)
+	}
+
+	keyword := "note"
+	switch note.Shape {
+	case seqdiagram.HexagonNoteShape:
+		keyword = "hnote"
+	case seqdiagram.RoundedNoteShape:
+		pw.warn("rounded notes are not supported")
+	case seqdiagram.CloudNoteShape:
+		pw.warn("cloud notes are not supported")
+	}
+
+	if note.Color != "" {
+		if color, isColor := colorToPlantUML(note.Color); isColor {
+			position += " " + color
+		} else {
+			pw.warn("note colour is not supported: %s", note.Color)
+		}
+	}
+	if note.BorderColor != "" {
+		pw.warn("note border colours are not supported")
+	}
+
+	lines := strings.Split(note.Message, "\n")
+	if note.TextColor != "" {
+		if _, isColor := colorToPlantUML(note.TextColor); isColor {
+			for i, line := range lines {
+				lines[i] = "<color:" + note.TextColor + ">" + line + "</color>"
+			}
+		} else {
+			pw.warn("note text colour is not supported: %s", note.TextColor)
+		}
+	}
+
+	if len(lines) > 1 {
+		pw.println("%s %s", keyword, position)
+		for _, line := range lines {
+			pw.println("%s", line)
+		}
+		pw.println("end %s", keyword)
+	} else {
+		pw.println("%s %s : %s", keyword, position, lines[0])
+	}
+}
+
+func (pw *writer) writeRef(ref *seqdiagram.Ref) {
+	if ref.Link != "" {
+		pw.warn("links are not supported")
+	}
+
+	position := "over " + participantName(ref.Actor1)
+	if ref.Actor2 != ref.Actor1 {
+		position += ", " + participantName(ref.Actor2)
+	}
+
+	if strings.Contains(ref.Message, "\n") {
+		pw.println("ref %s", position)
+		for _, line := range strings.Split(ref.Message, "\n") {
+			pw.println("%s", line)
+		}
+		pw.println("end ref")
+	} else {
+		pw.println("ref %s : %s", position, ref.Message)
+	}
+}
+
+// Returns the leftmost and rightmost participants of a note.  Notes against the sides of
+// the diagram are placed against the outermost participants.
+func (pw *writer) noteActors(note *seqdiagram.Note) (*seqdiagram.Actor, *seqdiagram.Actor) {
+	first, last := note.Actor1, note.Actor2
+	if last == nil {
+		last = first
+	}
+	if pw.actorIndex(first) > pw.actorIndex(last) {
+		first, last = last, first
+	}
+
+	if isOffside(first) || isOffside(last) {
+		pw.warn("notes against the sides of the diagram are not supported")
+		first, last = pw.realActor(first), pw.realActor(last)
+	}
+	return first, last
+}
+
+// Returns the position of the actor from the left of the diagram
+func (pw *writer) actorIndex(actor *seqdiagram.Actor) int {
+	switch actor {
+	case seqdiagram.LeftOffsideActor:
+		return -1
+	case seqdiagram.RightOffsideActor:
+		return len(pw.diagram.Actors)
+	}
+
+	for i, a := range pw.diagram.Actors {
+		if a == actor {
+			return i
+		}
+	}
+	return -1
+}
+
+// Replaces offside actors with the outermost participant on that side
+func (pw *writer) realActor(actor *seqdiagram.Actor) *seqdiagram.Actor {
+	switch actor {
+	case seqdiagram.LeftOffsideActor:
+		return pw.diagram.Actors[0]
+	case seqdiagram.RightOffsideActor:
+		return pw.diagram.Actors[len(pw.diagram.Actors)-1]
+	}
+	return actor
+}
+
+func (pw *writer) writeDivider(divider *seqdiagram.Divider) {
+	if divider.Color != "" || divider.TextColor != "" {
+		pw.warn("divider colours are not supported")
+	}
+	switch divider.Type {
+	case seqdiagram.DTGap:
+		if divider.Message != "" {
+			pw.println("...%s...", escapeText(divider.Message))
+		} else {
+			pw.println("...")
+		}
+	case seqdiagram.DTFrame, seqdiagram.DTLine:
+		if divider.Message != "" {
+			pw.println("== %s ==", escapeText(divider.Message))
+		} else {
+			pw.warn("dividers without a message are written as a space")
+			pw.println("|||")
+		}
+	default:
+		if divider.Message != "" {
+			pw.warn("spacer messages are not supported")
+		}
+		pw.println("|||")
+	}
+}
+
+func (pw *writer) writeBlock(block *seqdiagram.Block) {
+	for i, seg := range block.Segments {
+		if seg.FullWidth {
+			pw.warn("full width blocks are not supported")
+		}
+
+		keyword := segmentKeywords[seg.Type]
+		if i > 0 && keyword != "else" {
+			// PlantUML fragments cannot change type part way through
+			keyword = "else"
+		}
+
+		line, message := keyword, seg.Message
+		if seg.Color != "" {
+			if color, isColor := colorToPlantUML(seg.Color); isColor && keyword != "group" {
+				line += " " + color
+			} else {
+				pw.warn("block colour is not supported: %s", seg.Color)
+			}
+		}
+		if seg.BorderColor != "" || seg.TabColor != "" || seg.LineStyle != seqdiagram.DashedBlockLine || seg.FontSize > 0 {
+			pw.warn("block styles are not supported")
+		}
+
+		if label, isGroup := groupSegmentLabels[seg.Type]; isGroup && i == 0 {
+			// Groups take the operator as the label, with the message as a secondary label
+			if len(seg.Messages) > 0 {
+				label += " {" + strings.Join(seg.Messages, ", ") + "}"
+			}
+			line += " " + escapeText(label)
+			if message != "" {
+				message = "[" + message + "]"
+			}
+		}
+		if seg.Prefix != "" {
+			if seg.Type == seqdiagram.EmptySegmentType && i == 0 {
+				// Groups take the prefix as the label, with the message as a secondary label
+				line += " " + escapeText(seg.Prefix)
+				if message != "" {
+					message = "[" + message + "]"
+				}
+			} else {
+				pw.warn("segment prefix \"%s\" is not supported", seg.Prefix)
+			}
+		}
+		if message != "" {
+			line += " " + escapeText(message)
+		}
+
+		pw.println("%s", line)
+		pw.indent++
+		for _, item := range seg.SubItems {
+			pw.writeItem(item)
+		}
+		pw.indent--
+	}
+	pw.println("end")
+}
+
+// Returns the name to use for the actor
+func participantName(actor *seqdiagram.Actor) string {
+	if plainNameRegexp.MatchString(actor.Name) {
+		return actor.Name
+	}
+	return "\"" + escapeText(actor.Name) + "\""
+}
+
+func isOffside(actor *seqdiagram.Actor) bool {
+	return actor == seqdiagram.LeftOffsideActor || actor == seqdiagram.RightOffsideActor
+}
+
+// Escapes text for use on a single line
+func escapeText(text string) string {
+	return strings.ReplaceAll(text, "\n", "\\n")
+}
+
+// Returns the colour in the form used by PlantUML, or false if it cannot be represented
+func colorToPlantUML(color string) (string, bool) {
+	switch {
+	case hexColorRegexp.MatchString(color):
+		return color, true
+	case namedColorRegexp.MatchString(color):
+		return "#" + color, true
+	}
+	return "", false
+}
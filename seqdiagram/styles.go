@@ -13,6 +13,9 @@ type DiagramStyles struct {
 	ActorBox     graphbox.ActorBoxStyle
 	ActorIconBox graphbox.ActorIconBoxStyle
 
+	// Styling of the boxes drawn around groups of actors
+	ActorGroup graphbox.ActorGroupStyle
+
 	// Styling of the note box
 	NoteBox graphbox.NoteBoxStyle
 
@@ -21,6 +24,12 @@ type DiagramStyles struct {
 	// Styling of the activity line
 	ActivityLine graphbox.ActivityLineStyle
 
+	// Styling of the lifelines
+	LifeLine graphbox.LifeLineStyle
+
+	// Styling of the activation bars
+	ActivationBar graphbox.ActivationBarStyle
+
 	// Styling of arrow heads
 	ArrowHeads map[ArrowHead]*graphbox.ArrowHeadStyle
 
@@ -32,10 +41,24 @@ type DiagramStyles struct {
 
 	// Styles of dividers
 	Divider map[DividerType]graphbox.DividerStyle
+
+	// Height of a diagram with no items.  If zero, a height of 64 is used.
+	EmptyDiagramHeight int
+
+	// Height of the rows reserved for delayed messages which have no other items
+	DelayRowHeight int
+
+	// If true, actors with icons are drawn as actor boxes
+	ActorIconsAsBoxes bool
+
+	// If true, blocks are not filled, as the fill would hide the lines of the boxes drawn
+	// underneath them without being visible itself
+	UnfilledBlocks bool
 }
 
 // Fonts
 var standardFont = mustLoadFont()
+var cellFont = graphbox.CellFont{}
 
 // The Default style
 var DefaultStyle = &DiagramStyles{
@@ -61,12 +84,32 @@ var DefaultStyle = &DiagramStyles{
 	},
 	MultiNoteOverlap: 16,
 	ActivityLine: graphbox.ActivityLineStyle{
-		Font:          standardFont,
-		FontSize:      14,
-		SelfRefWidth:  48,
-		SelfRefHeight: 24,
-		Margin:        graphbox.Point{X: 16, Y: 8},
-		TextGap:       4,
+		Font:           standardFont,
+		FontSize:       14,
+		SelfRefWidth:   48,
+		SelfRefHeight:  24,
+		Margin:         graphbox.Point{X: 16, Y: 8},
+		TextGap:        4,
+		EndpointLength: 40,
+		EndpointRadius: 5,
+		NumberBadge: graphbox.NumberBadgeStyle{
+			Font:      standardFont,
+			FontSize:  12,
+			Padding:   graphbox.Point{X: 4, Y: 1},
+			Gap:       4,
+			Color:     "black",
+			TextColor: "white",
+		},
+	},
+	LifeLine: graphbox.LifeLineStyle{
+		CrossSize: 8,
+	},
+	ActivationBar: graphbox.ActivationBarStyle{
+		Width:      10,
+		MinHeight:  10,
+		NestOffset: 5,
+		ArrowGap:   0,
+		Color:      "black",
 	},
 	ArrowHeads: map[ArrowHead]*graphbox.ArrowHeadStyle{
 		SolidArrowHead: {
@@ -95,6 +138,11 @@ var DefaultStyle = &DiagramStyles{
 		FontSize: 20,
 		Padding:  graphbox.Point{X: 4, Y: 16},
 	},
+	ActorGroup: graphbox.ActorGroupStyle{
+		Font:     standardFont,
+		FontSize: 14,
+		Padding:  graphbox.Point{X: 8, Y: 4},
+	},
 	Block: graphbox.BlockStyle{
 		Margin:           graphbox.Point{X: 8, Y: 8},
 		TextPadding:      graphbox.Point{X: 4, Y: 4},
@@ -105,6 +153,9 @@ var DefaultStyle = &DiagramStyles{
 		Font:      standardFont,
 		FontSize:  14,
 		MidMargin: 4,
+
+		Dashes:      []int{4, 4},
+		NestedColor: "#f2f2f2",
 	},
 	Divider: map[DividerType]graphbox.DividerStyle{
 		DTGap: {
@@ -140,6 +191,8 @@ var DefaultStyle = &DiagramStyles{
 			Shape:       graphbox.DSSpacerRect,
 		},
 	},
+	EmptyDiagramHeight: 64,
+	DelayRowHeight:     32,
 }
 
 // The Tight style.  Same horizontal dimensions as the normal
@@ -167,12 +220,32 @@ var TightStyle = &DiagramStyles{
 	},
 	MultiNoteOverlap: 16,
 	ActivityLine: graphbox.ActivityLineStyle{
-		Font:          standardFont,
-		FontSize:      14,
-		SelfRefWidth:  48,
-		SelfRefHeight: 12,
-		Margin:        graphbox.Point{X: 16, Y: 4},
-		TextGap:       4,
+		Font:           standardFont,
+		FontSize:       14,
+		SelfRefWidth:   48,
+		SelfRefHeight:  12,
+		Margin:         graphbox.Point{X: 16, Y: 4},
+		TextGap:        4,
+		EndpointLength: 32,
+		EndpointRadius: 5,
+		NumberBadge: graphbox.NumberBadgeStyle{
+			Font:      standardFont,
+			FontSize:  12,
+			Padding:   graphbox.Point{X: 4, Y: 1},
+			Gap:       4,
+			Color:     "black",
+			TextColor: "white",
+		},
+	},
+	LifeLine: graphbox.LifeLineStyle{
+		CrossSize: 8,
+	},
+	ActivationBar: graphbox.ActivationBarStyle{
+		Width:      10,
+		MinHeight:  10,
+		NestOffset: 5,
+		ArrowGap:   0,
+		Color:      "black",
 	},
 	ArrowHeads: map[ArrowHead]*graphbox.ArrowHeadStyle{
 		SolidArrowHead: {
@@ -201,6 +274,11 @@ var TightStyle = &DiagramStyles{
 		FontSize: 20,
 		Padding:  graphbox.Point{X: 4, Y: 8},
 	},
+	ActorGroup: graphbox.ActorGroupStyle{
+		Font:     standardFont,
+		FontSize: 14,
+		Padding:  graphbox.Point{X: 8, Y: 4},
+	},
 	Block: graphbox.BlockStyle{
 		Margin:           graphbox.Point{X: 8, Y: 8},
 		TextPadding:      graphbox.Point{X: 4, Y: 4},
@@ -211,6 +289,9 @@ var TightStyle = &DiagramStyles{
 		Font:      standardFont,
 		FontSize:  14,
 		MidMargin: 4,
+
+		Dashes:      []int{4, 4},
+		NestedColor: "#f2f2f2",
 	},
 	Divider: map[DividerType]graphbox.DividerStyle{
 		DTGap: {
@@ -246,6 +327,8 @@ var TightStyle = &DiagramStyles{
 			Shape:       graphbox.DSSpacerRect,
 		},
 	},
+	EmptyDiagramHeight: 64,
+	DelayRowHeight:     24,
 }
 
 // The small style.  This has narrower margins and font sizes and
@@ -273,12 +356,32 @@ var SmallStyle = &DiagramStyles{
 	},
 	MultiNoteOverlap: 8,
 	ActivityLine: graphbox.ActivityLineStyle{
-		Font:          standardFont,
-		FontSize:      12,
-		Margin:        graphbox.Point{X: 8, Y: 8},
-		TextGap:       4,
-		SelfRefWidth:  32,
-		SelfRefHeight: 12,
+		Font:           standardFont,
+		FontSize:       12,
+		Margin:         graphbox.Point{X: 8, Y: 8},
+		TextGap:        4,
+		SelfRefWidth:   32,
+		SelfRefHeight:  12,
+		EndpointLength: 24,
+		EndpointRadius: 4,
+		NumberBadge: graphbox.NumberBadgeStyle{
+			Font:      standardFont,
+			FontSize:  10,
+			Padding:   graphbox.Point{X: 3, Y: 1},
+			Gap:       3,
+			Color:     "black",
+			TextColor: "white",
+		},
+	},
+	LifeLine: graphbox.LifeLineStyle{
+		CrossSize: 6,
+	},
+	ActivationBar: graphbox.ActivationBarStyle{
+		Width:      8,
+		MinHeight:  8,
+		NestOffset: 4,
+		ArrowGap:   0,
+		Color:      "black",
 	},
 	ArrowHeads: map[ArrowHead]*graphbox.ArrowHeadStyle{
 		SolidArrowHead: {
@@ -307,6 +410,11 @@ var SmallStyle = &DiagramStyles{
 		FontSize: 18,
 		Padding:  graphbox.Point{X: 2, Y: 8},
 	},
+	ActorGroup: graphbox.ActorGroupStyle{
+		Font:     standardFont,
+		FontSize: 12,
+		Padding:  graphbox.Point{X: 5, Y: 3},
+	},
 	Block: graphbox.BlockStyle{
 		Margin:           graphbox.Point{X: 5, Y: 5},
 		TextPadding:      graphbox.Point{X: 3, Y: 2},
@@ -317,6 +425,9 @@ var SmallStyle = &DiagramStyles{
 		Font:      standardFont,
 		FontSize:  12,
 		MidMargin: 2,
+
+		Dashes:      []int{4, 4},
+		NestedColor: "#f2f2f2",
 	},
 	Divider: map[DividerType]graphbox.DividerStyle{
 		DTGap: {
@@ -352,6 +463,111 @@ var SmallStyle = &DiagramStyles{
 			Shape:       graphbox.DSSpacerRect,
 		},
 	},
+	EmptyDiagramHeight: 64,
+	DelayRowHeight:     20,
+}
+
+// The style used for text art.  Each unit is a single character cell.  This style is
+// used for the text renderers and is not suitable for images.
+var TextArtStyle = &DiagramStyles{
+	Margin: graphbox.Point{X: 1, Y: 0},
+	ActorBox: graphbox.ActorBoxStyle{
+		Font:     cellFont,
+		Padding:  graphbox.Point{X: 2, Y: 1},
+		Margin:   graphbox.Point{X: 2, Y: 1},
+		ArrowGap: 1,
+	},
+	ActorIconBox: graphbox.ActorIconBoxStyle{
+		Font:    cellFont,
+		Padding: graphbox.Point{X: 2, Y: 1},
+		Margin:  graphbox.Point{X: 2, Y: 1},
+	},
+	NoteBox: graphbox.NoteBoxStyle{
+		Font:    cellFont,
+		Padding: graphbox.Point{X: 2, Y: 1},
+		Margin:  graphbox.Point{X: 2, Y: 1},
+	},
+	MultiNoteOverlap: 2,
+	ActivityLine: graphbox.ActivityLineStyle{
+		Font:           cellFont,
+		SelfRefWidth:   3,
+		SelfRefHeight:  1,
+		Margin:         graphbox.Point{X: 2, Y: 1},
+		TextGap:        1,
+		EndpointLength: 6,
+		EndpointRadius: 1,
+		NumberBadge: graphbox.NumberBadgeStyle{
+			Font:     cellFont,
+			Gap:      2,
+			Brackets: [2]string{"[", "]"},
+		},
+	},
+	LifeLine: graphbox.LifeLineStyle{
+		CrossSize: 1,
+	},
+	ActivationBar: graphbox.ActivationBarStyle{
+		Width:      2,
+		MinHeight:  1,
+		NestOffset: 1,
+		ArrowGap:   1,
+		Color:      "black",
+	},
+	ArrowHeads: map[ArrowHead]*graphbox.ArrowHeadStyle{
+		SolidArrowHead:     {Glyphs: [2]string{"◀", "▶"}},
+		OpenArrowHead:      {Glyphs: [2]string{"◁", "▷"}},
+		BarbArrowHead:      {Glyphs: [2]string{"↼", "⇀"}},
+		LowerBarbArrowHead: {Glyphs: [2]string{"↽", "⇁"}},
+	},
+	Title: graphbox.TitleStyle{
+		Font:    cellFont,
+		Padding: graphbox.Point{X: 0, Y: 1},
+	},
+	ActorGroup: graphbox.ActorGroupStyle{
+		Font:    cellFont,
+		Padding: graphbox.Point{X: 2, Y: 1},
+	},
+	Block: graphbox.BlockStyle{
+		Margin:         graphbox.Point{X: 2, Y: 1},
+		TextPadding:    graphbox.Point{X: 2, Y: 1},
+		MessagePadding: graphbox.Point{X: 0, Y: 1},
+		GapWidth:       2,
+
+		Font:      cellFont,
+		MidMargin: 2,
+
+		Dashes: []int{4, 4},
+	},
+	Divider: map[DividerType]graphbox.DividerStyle{
+		DTGap: {
+			Font:    cellFont,
+			Padding: graphbox.Point{X: 2, Y: 0},
+			Margin:  graphbox.Point{X: 1, Y: 1},
+			Shape:   graphbox.DSFullRect,
+		},
+		DTFrame: {
+			Font:    cellFont,
+			Padding: graphbox.Point{X: 2, Y: 1},
+			Margin:  graphbox.Point{X: 1, Y: 1},
+			Shape:   graphbox.DSFramedRect,
+		},
+		DTLine: {
+			Font:        cellFont,
+			Padding:     graphbox.Point{X: 2, Y: 0},
+			Margin:      graphbox.Point{X: 1, Y: 1},
+			TextPadding: graphbox.Point{X: 1, Y: 0},
+			Shape:       graphbox.DSFullLine,
+		},
+		DTSpacer: {
+			Font:    cellFont,
+			Padding: graphbox.Point{X: 2, Y: 0},
+			Margin:  graphbox.Point{X: 1, Y: 1},
+			Shape:   graphbox.DSSpacerRect,
+		},
+	},
+	EmptyDiagramHeight: 6,
+	DelayRowHeight:     2,
+	ActorIconsAsBoxes:  true,
+	UnfilledBlocks:     true,
 }
 
 func StyleByName(name string) *DiagramStyles {
@@ -4,6 +4,7 @@ package seqdiagram
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/lmika/goseq/seqdiagram/parse"
@@ -22,12 +23,37 @@ var arrowHeadMap = map[parse.ArrowHeadType]ArrowHead{
 	parse.LOWER_BARBED_ARROW_HEAD: LowerBarbArrowHead,
 }
 
+var activationTypeMap = map[parse.ActivationType]ActivationType{
+	parse.ACTIVATE:   StartActivation,
+	parse.DEACTIVATE: EndActivation,
+}
+
+var autoNumberTypeMap = map[parse.AutoNumberType]AutoNumberType{
+	parse.AUTONUMBER_START:  StartAutoNumber,
+	parse.AUTONUMBER_STOP:   StopAutoNumber,
+	parse.AUTONUMBER_RESUME: ResumeAutoNumber,
+}
+
 var noteAlignmentMap = map[parse.NoteAlignment]NoteAlignment{
 	parse.LEFT_NOTE_ALIGNMENT:  LeftNoteAlignment,
 	parse.RIGHT_NOTE_ALIGNMENT: RightNoteAlignment,
 	parse.OVER_NOTE_ALIGNMENT:  OverNoteAlignment,
 }
 
+var noteShapeMap = map[string]NoteShape{
+	"rect":    RectNoteShape,
+	"note":    FoldedNoteShape,
+	"rounded": RoundedNoteShape,
+	"hexagon": HexagonNoteShape,
+	"cloud":   CloudNoteShape,
+}
+
+var blockLineStyleMap = map[string]BlockLineStyle{
+	"dashed": DashedBlockLine,
+	"dotted": DottedBlockLine,
+	"solid":  SolidBlockLine,
+}
+
 var dividerTypeMap = map[parse.GapType]DividerType{
 	parse.SPACER_GAP: DTSpacer,
 	parse.EMPTY_GAP:  DTGap,
@@ -44,18 +70,38 @@ var segmentTypeMap = map[parse.SegmentType]SegmentType{
 	parse.LOOP_SEGMENT:              LoopSegmentType,
 	parse.CONCURRENT_SEGMENT:        ConcurrentSegmentType,
 	parse.CONCURRENT_WHILST_SEGMENT: ConcurrentWhilstSegmentType,
+	parse.CRITICAL_SEGMENT:          CriticalSegmentType,
+	parse.BREAK_SEGMENT:             BreakSegmentType,
+	parse.NEG_SEGMENT:               NegSegmentType,
+	parse.IGNORE_SEGMENT:            IgnoreSegmentType,
+	parse.CONSIDER_SEGMENT:          ConsiderSegmentType,
+	parse.ASSERT_SEGMENT:            AssertSegmentType,
+	parse.STRICT_SEGMENT:            StrictSegmentType,
+	parse.SEQ_SEGMENT:               SeqSegmentType,
 	parse.NONE_SEGMENT:              EmptySegmentType,
 }
 
 // styleIdentifierParticipant is the style identifier for participants
 const styleIdentifierParticipant = "participant"
 
+// styleIdentifierNote is the style identifier for notes
+const styleIdentifierNote = "note"
+
+// styleIdentifierBlock is the style identifier for the segments of blocks
+const styleIdentifierBlock = "block"
+
 type treeBuilder struct {
 	nodeList *parse.NodeList
 	filename string
 
 	// List of style definitions
 	styleDefs map[string]*AttributeSet
+
+	// Sequences defined with define, the names of the sequences being expanded and the
+	// actors given to the parameters of the innermost one
+	sequences map[string]*parse.DefineNode
+	expanding []string
+	params    map[string]*Actor
 }
 
 func newTreeBuilder(nl *parse.NodeList, filename string) *treeBuilder {
@@ -63,15 +109,18 @@ func newTreeBuilder(nl *parse.NodeList, filename string) *treeBuilder {
 		nodeList:  nl,
 		filename:  filename,
 		styleDefs: make(map[string]*AttributeSet),
+		sequences: make(map[string]*parse.DefineNode),
 	}
 }
 
 func (tb *treeBuilder) buildTree(d *Diagram) error {
 	for nodeList := tb.nodeList; nodeList != nil; nodeList = nodeList.Tail {
-		seqItem, err := tb.toSequenceItem(nodeList.Head, d)
+		seqItems, err := tb.toSequenceItems(nodeList.Head, d)
 		if err != nil {
 			return err
-		} else if seqItem != nil {
+		}
+
+		for _, seqItem := range seqItems {
 			d.AddSequenceItem(seqItem)
 		}
 	}
@@ -83,17 +132,62 @@ func (tb *treeBuilder) nodesToSlice(nodeList *parse.NodeList, d *Diagram) ([]Seq
 	seq := make([]SequenceItem, 0)
 
 	for ; nodeList != nil; nodeList = nodeList.Tail {
-		seqItem, err := tb.toSequenceItem(nodeList.Head, d)
+		seqItems, err := tb.toSequenceItems(nodeList.Head, d)
 		if err != nil {
 			return nil, err
-		} else if seqItem != nil {
-			seq = append(seq, seqItem)
 		}
+
+		seq = append(seq, seqItems...)
 	}
 
 	return seq, nil
 }
 
+// Converts a node into sequence items.  Most nodes produce at most one item, except for
+// actions which create the target actor, which are preceded by the creation, and actions
+// which activate or deactivate an actor, which are followed by the activation.
+func (tb *treeBuilder) toSequenceItems(node parse.Node, d *Diagram) ([]SequenceItem, error) {
+	if un, isUse := node.(*parse.UseNode); isUse {
+		return tb.addUse(un, d)
+	}
+
+	seqItem, err := tb.toSequenceItem(node, d)
+	if err != nil {
+		return nil, err
+	} else if seqItem == nil {
+		return nil, nil
+	}
+
+	an, isAction := node.(*parse.ActionNode)
+	if !isAction {
+		return []SequenceItem{seqItem}, nil
+	}
+
+	action := seqItem.(*Action)
+	seqItems := []SequenceItem{action}
+	if an.Create {
+		if err := tb.checkNotSide(action.To, "created"); err != nil {
+			return nil, err
+		}
+		seqItems = []SequenceItem{&Creation{action.To}, action}
+	}
+
+	var activation *Activation
+	switch an.Activation {
+	case parse.ACTIVATE_TARGET:
+		activation = &Activation{action.To, StartActivation}
+	case parse.DEACTIVATE_SOURCE:
+		activation = &Activation{action.From, EndActivation}
+	default:
+		return seqItems, nil
+	}
+
+	if err := tb.checkNotSide(activation.Actor, "activated"); err != nil {
+		return nil, err
+	}
+	return append(seqItems, activation), nil
+}
+
 func (tb *treeBuilder) makeError(msg string) error {
 	return fmt.Errorf("%s:%s", tb.filename, msg)
 }
@@ -106,6 +200,8 @@ func (tb *treeBuilder) toSequenceItem(node parse.Node, d *Diagram) (SequenceItem
 			Value:  n.Value,
 		})
 		return nil, nil
+	case *parse.CommentNode, *parse.BlankLineNode:
+		return nil, nil
 	case *parse.TitleNode:
 		d.Title = n.Title
 		return nil, nil
@@ -114,12 +210,26 @@ func (tb *treeBuilder) toSequenceItem(node parse.Node, d *Diagram) (SequenceItem
 		return nil, err
 	case *parse.ActionNode:
 		return tb.addAction(n, d)
+	case *parse.ActivationNode:
+		return tb.addActivation(n, d)
+	case *parse.CreateNode:
+		return tb.addCreation(n, d)
+	case *parse.DestroyNode:
+		return tb.addDestruction(n, d)
+	case *parse.AutoNumberNode:
+		return tb.addAutoNumber(n)
 	case *parse.NoteNode:
 		return tb.addNote(n, d)
+	case *parse.RefNode:
+		return tb.addRef(n, d)
 	case *parse.GapNode:
 		return tb.addGap(n, d)
 	case *parse.BlockNode:
 		return tb.addBlock(n, d)
+	case *parse.BoxNode:
+		return nil, tb.addBox(n, d)
+	case *parse.DefineNode:
+		return nil, tb.addDefine(n)
 	case *parse.StyleNode:
 		if attrs, err := tb.attrsToMap(n.Attributes, tb.styleDefs[n.Name]); err == nil {
 			tb.styleDefs[n.Name] = attrs
@@ -133,7 +243,12 @@ func (tb *treeBuilder) toSequenceItem(node parse.Node, d *Diagram) (SequenceItem
 }
 
 func (tb *treeBuilder) addActor(an *parse.ActorNode, d *Diagram) error {
-	actor := d.GetOrAddActorWithOptions(an.Ident, an.ActorName())
+	ident, err := tb.actorIdent(an)
+	if err != nil {
+		return err
+	}
+
+	actor := d.GetOrAddActorWithOptions(ident, an.ActorName())
 	parentStyle := tb.styleDefs[styleIdentifierParticipant]
 
 	attrMap, err := tb.attrsToMap(an.Attributes, parentStyle)
@@ -159,6 +274,40 @@ func (tb *treeBuilder) addActor(an *parse.ActorNode, d *Diagram) error {
 	return nil
 }
 
+// Adds a group for the participants declared within a box.  Only declarations which do
+// not produce sequence items are permitted within a box.
+func (tb *treeBuilder) addBox(bn *parse.BoxNode, d *Diagram) error {
+	attrs, err := tb.attrsToMap(bn.Attributes, nil)
+	if err != nil {
+		return err
+	}
+
+	group := &ActorGroup{Label: bn.Label, Color: attrs.GetDef("color", "")}
+	for nodeList := bn.SubNodes; nodeList != nil; nodeList = nodeList.Tail {
+		switch n := nodeList.Head.(type) {
+		case *parse.ActorNode:
+			if err := tb.addActor(n, d); err != nil {
+				return err
+			}
+			ident, _ := tb.actorIdent(n)
+			group.Actors = append(group.Actors, d.GetOrAddActor(ident))
+		case *parse.BoxNode:
+			return tb.makeError("boxes cannot be nested")
+		default:
+			if seqItems, err := tb.toSequenceItems(n, d); err != nil {
+				return err
+			} else if len(seqItems) > 0 {
+				return tb.makeError("only participants can be declared within a box")
+			}
+		}
+	}
+
+	if err := d.AddActorGroup(group); err != nil {
+		return tb.makeError(err.Error())
+	}
+	return nil
+}
+
 func (tb *treeBuilder) addAction(an *parse.ActionNode, d *Diagram) (SequenceItem, error) {
 	from, err := tb.getOrAddActor(an.From, d)
 	if err != nil {
@@ -170,11 +319,107 @@ func (tb *treeBuilder) addAction(an *parse.ActionNode, d *Diagram) (SequenceItem
 		return nil, err
 	}
 
-	arrow := Arrow{arrowStemMap[an.Arrow.Stem], arrowHeadMap[an.Arrow.Head]}
-	action := &Action{from, to, arrow, an.Descr}
+	// Reversed arrows are written from the receiver to the sender
+	if an.Arrow.Reversed {
+		from, to = to, from
+	}
+
+	if err := checkLostAndFound(from, to); err != nil {
+		return nil, tb.makeError(err.Error())
+	}
+
+	attrs, err := tb.attrsToMap(an.Attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+	width, err := attrs.GetInt("width", 0)
+	if err != nil {
+		return nil, tb.makeError(err.Error())
+	} else if width < 0 {
+		return nil, tb.makeError("the width of a message cannot be negative")
+	}
+
+	arrow := Arrow{arrowStemMap[an.Arrow.Stem], arrowHeadMap[an.Arrow.Head], an.Arrow.Tail}
+	color := attrs.GetDef("color", "")
+	action := &Action{from, to, arrow, an.Descr, an.Delay, color, attrs.GetDef("textcolor", color), width}
+	if err := checkDelay(action); err != nil {
+		return nil, tb.makeError(err.Error())
+	}
 	return action, nil
 }
 
+func (tb *treeBuilder) addActivation(an *parse.ActivationNode, d *Diagram) (SequenceItem, error) {
+	actor, err := tb.getOrAddActor(an.Actor, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tb.checkNotSide(actor, "activated"); err != nil {
+		return nil, err
+	}
+	return &Activation{actor, activationTypeMap[an.Type]}, nil
+}
+
+func (tb *treeBuilder) addCreation(cn *parse.CreateNode, d *Diagram) (SequenceItem, error) {
+	actor, err := tb.getOrAddActor(cn.Actor, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tb.checkNotSide(actor, "created"); err != nil {
+		return nil, err
+	}
+	return &Creation{actor}, nil
+}
+
+func (tb *treeBuilder) addDestruction(dn *parse.DestroyNode, d *Diagram) (SequenceItem, error) {
+	actor, err := tb.getOrAddActor(dn.Actor, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tb.checkNotSide(actor, "destroyed"); err != nil {
+		return nil, err
+	}
+	return &Destruction{actor}, nil
+}
+
+// Returns an error if the actor is one of the sides of the diagram, or the end of a lost
+// or found message.  These have no lifeline, and so cannot be activated, created or destroyed.
+func (tb *treeBuilder) checkNotSide(actor *Actor, action string) error {
+	switch actor {
+	case LeftOffsideActor, RightOffsideActor:
+		return tb.makeError("the sides of the diagram cannot be " + action)
+	case LostActor, FoundActor:
+		return tb.makeError("lost and found messages cannot be " + action)
+	}
+	return nil
+}
+
+func (tb *treeBuilder) addAutoNumber(an *parse.AutoNumberNode) (SequenceItem, error) {
+	attrs, err := tb.attrsToMap(an.Attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := attrs.GetInt("start", 1)
+	if err != nil {
+		return nil, tb.makeError(err.Error())
+	}
+	step, err := attrs.GetInt("step", 1)
+	if err != nil {
+		return nil, tb.makeError(err.Error())
+	}
+
+	return &AutoNumber{
+		Type:   autoNumberTypeMap[an.Type],
+		Start:  start,
+		Step:   step,
+		Format: attrs.GetDef("format", ""),
+		Nested: attrs.GetBool("nested", false),
+	}, nil
+}
+
 func (tb *treeBuilder) addNote(nn *parse.NoteNode, d *Diagram) (SequenceItem, error) {
 	actor1, err := tb.getOrAddActor(nn.Actor1, d)
 	if err != nil {
@@ -189,13 +434,78 @@ func (tb *treeBuilder) addNote(nn *parse.NoteNode, d *Diagram) (SequenceItem, er
 		}
 	}
 
-	note := &Note{actor1, actor2, noteAlignmentMap[nn.Position], nn.Descr}
+	if isLostOrFound(actor1) || isLostOrFound(actor2) {
+		return nil, tb.makeError("notes cannot be placed against lost or found")
+	}
+
+	attrs, err := tb.attrsToMap(nn.Attributes, tb.styleDefs[styleIdentifierNote])
+	if err != nil {
+		return nil, err
+	}
+
+	shapeName := attrs.GetDef("shape", "rect")
+	shape, hasShape := noteShapeMap[shapeName]
+	if !hasShape {
+		return nil, tb.makeError(fmt.Sprintf("unrecognised note shape '%s'", shapeName))
+	}
+
+	note := &Note{
+		Actor1:      actor1,
+		Actor2:      actor2,
+		Align:       noteAlignmentMap[nn.Position],
+		Message:     nn.Descr,
+		Shape:       shape,
+		Color:       attrs.GetDef("color", ""),
+		BorderColor: attrs.GetDef("bordercolor", ""),
+		TextColor:   attrs.GetDef("textcolor", ""),
+	}
 	return note, nil
 }
 
+func (tb *treeBuilder) addRef(rn *parse.RefNode, d *Diagram) (SequenceItem, error) {
+	actor1, err := tb.getOrAddActor(rn.Actor1, d)
+	if err != nil {
+		return nil, err
+	}
+
+	actor2 := actor1
+	if rn.Actor2 != nil {
+		actor2, err = tb.getOrAddActor(rn.Actor2, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if actor1.rank < 0 || actor2.rank < 0 {
+		return nil, tb.makeError("references can only be placed over participants")
+	}
+
+	attrs, err := tb.attrsToMap(rn.Attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ref{actor1, actor2, rn.Descr, attrs.GetDef("link", "")}, nil
+}
+
+// Returns the identifier of the actor declared by a participant declaration.  Within a
+// defined sequence, a parameter is replaced with the name of the actor given to it.
+func (tb *treeBuilder) actorIdent(an *parse.ActorNode) (string, error) {
+	actor, isParam := tb.params[an.Ident]
+	if !isParam {
+		return an.Ident, nil
+	} else if actor.rank < 0 {
+		return "", tb.makeError(fmt.Sprintf("parameter '%s' is not a participant", an.Ident))
+	}
+	return actor.Name, nil
+}
+
 func (tb *treeBuilder) getOrAddActor(ar parse.ActorRef, d *Diagram) (*Actor, error) {
 	switch a := ar.(type) {
 	case parse.NormalActorRef:
+		if actor, isParam := tb.params[string(a)]; isParam {
+			return actor, nil
+		}
 		return d.GetOrAddActor(string(a)), nil
 	case parse.PseudoActorRef:
 		pn := string(a)
@@ -204,6 +514,10 @@ func (tb *treeBuilder) getOrAddActor(ar parse.ActorRef, d *Diagram) (*Actor, err
 			return LeftOffsideActor, nil
 		case "right":
 			return RightOffsideActor, nil
+		case "lost":
+			return LostActor, nil
+		case "found":
+			return FoundActor, nil
 		default:
 			return nil, fmt.Errorf("invalid pseudo actor: %s", pn)
 		}
@@ -212,8 +526,134 @@ func (tb *treeBuilder) getOrAddActor(ar parse.ActorRef, d *Diagram) (*Actor, err
 	}
 }
 
+func (tb *treeBuilder) addDefine(dn *parse.DefineNode) error {
+	if len(tb.expanding) > 0 {
+		return fmt.Errorf("%s: sequences cannot be defined within another sequence", formatPos(dn.Pos))
+	} else if prev, isDefined := tb.sequences[dn.Name]; isDefined {
+		return fmt.Errorf("%s: sequence '%s' is already defined at %s", formatPos(dn.Pos), dn.Name, formatPos(prev.Pos))
+	}
+
+	seen := make(map[string]bool)
+	for _, param := range dn.Params {
+		if seen[param] {
+			return fmt.Errorf("%s: parameter '%s' of sequence '%s' is declared more than once", formatPos(dn.Pos), param, dn.Name)
+		}
+		seen[param] = true
+	}
+
+	tb.sequences[dn.Name] = dn
+	return nil
+}
+
+// Expands a use of a defined sequence.  The actors given to the parameters are bound while
+// the declarations of the sequence are added.  The sequence items can be wrapped in a block
+// with the description as the label, or collapsed into a reference frame.
+func (tb *treeBuilder) addUse(un *parse.UseNode, d *Diagram) ([]SequenceItem, error) {
+	dn, isDefined := tb.sequences[un.Name]
+	if !isDefined {
+		return nil, fmt.Errorf("%s: sequence '%s' is not defined", formatPos(un.Pos), un.Name)
+	} else if len(un.Args) != len(dn.Params) {
+		return nil, fmt.Errorf("%s: sequence '%s' expects %d participants but was given %d (defined at %s)",
+			formatPos(un.Pos), un.Name, len(dn.Params), len(un.Args), formatPos(dn.Pos))
+	}
+	for _, name := range tb.expanding {
+		if name == un.Name {
+			return nil, fmt.Errorf("%s: sequence '%s' uses itself (defined at %s)", formatPos(un.Pos), un.Name, formatPos(dn.Pos))
+		}
+	}
+
+	attrs, err := tb.attrsToMap(un.Attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]*Actor)
+	for i, arg := range un.Args {
+		if params[dn.Params[i]], err = tb.getOrAddActor(arg, d); err != nil {
+			return nil, err
+		}
+	}
+
+	prevParams := tb.params
+	tb.params = params
+	tb.expanding = append(tb.expanding, un.Name)
+	seqItems, err := tb.nodesToSlice(dn.SubNodes, d)
+	tb.params = prevParams
+	tb.expanding = tb.expanding[:len(tb.expanding)-1]
+	if err != nil {
+		return nil, fmt.Errorf("%w\n\tin sequence '%s' used at %s, defined at %s", err, un.Name, formatPos(un.Pos), formatPos(dn.Pos))
+	}
+
+	if attrs.GetBool("collapsed", false) {
+		label := un.Descr
+		if label == "" {
+			label = un.Name
+		}
+
+		actor1, actor2 := actorSpan(seqItems)
+		if actor1 == nil {
+			return nil, fmt.Errorf("%s: sequence '%s' has no participants and cannot be collapsed", formatPos(un.Pos), un.Name)
+		}
+		return []SequenceItem{&Ref{actor1, actor2, label, attrs.GetDef("link", "")}}, nil
+	} else if un.Descr != "" {
+		return []SequenceItem{&Block{[]*BlockSegment{{Type: EmptySegmentType, Message: un.Descr, SubItems: seqItems}}}}, nil
+	}
+	return seqItems, nil
+}
+
+// Returns the leftmost and rightmost participants of the sequence items, or nil if the
+// items are not placed against any participants.
+func actorSpan(seqItems []SequenceItem) (left, right *Actor) {
+	var actors []*Actor
+	for _, seqItem := range seqItems {
+		switch s := seqItem.(type) {
+		case *Action:
+			actors = append(actors, s.From, s.To)
+		case *Note:
+			actors = append(actors, s.Actor1, s.Actor2)
+		case *Ref:
+			actors = append(actors, s.Actor1, s.Actor2)
+		case *Activation:
+			actors = append(actors, s.Actor)
+		case *Creation:
+			actors = append(actors, s.Actor)
+		case *Destruction:
+			actors = append(actors, s.Actor)
+		case *Block:
+			for _, seg := range s.Segments {
+				segLeft, segRight := actorSpan(seg.SubItems)
+				actors = append(actors, segLeft, segRight)
+			}
+		}
+	}
+
+	for _, actor := range actors {
+		if actor == nil || actor.rank < 0 {
+			continue
+		}
+		if left == nil || actor.rank < left.rank {
+			left = actor
+		}
+		if right == nil || actor.rank > right.rank {
+			right = actor
+		}
+	}
+	return left, right
+}
+
+// Formats the position of a declaration for use in an error message
+func formatPos(pos parse.Position) string {
+	return fmt.Sprintf("%s:%d", pos.Filename, pos.Line)
+}
+
 func (tb *treeBuilder) addGap(gn *parse.GapNode, d *Diagram) (SequenceItem, error) {
-	divider := &Divider{gn.Descr, dividerTypeMap[gn.Type]}
+	attrs, err := tb.attrsToMap(gn.Attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	color := attrs.GetDef("color", "")
+	divider := &Divider{gn.Descr, dividerTypeMap[gn.Type], color, attrs.GetDef("textcolor", color)}
 	return divider, nil
 }
 
@@ -232,25 +672,64 @@ func (tb *treeBuilder) addBlock(bn *parse.BlockNode, d *Diagram) (SequenceItem,
 }
 
 func (tb *treeBuilder) buildSegment(sn *parse.BlockSegment, d *Diagram) (*BlockSegment, error) {
-	attrs, err := tb.attrsToMap(sn.AttributeList, tb.styleDefs[styleIdentifierParticipant])
+	attrs, err := tb.attrsToMap(sn.AttributeList, tb.styleDefs[styleIdentifierBlock].inheriting(tb.blockParticipantStyle()))
 	if err != nil {
 		return nil, err
 	}
 
+	lineStyleName := attrs.GetDef("linestyle", "dashed")
+	lineStyle, hasLineStyle := blockLineStyleMap[lineStyleName]
+	if !hasLineStyle {
+		return nil, tb.makeError(fmt.Sprintf("unrecognised line style '%s'", lineStyleName))
+	}
+
+	fontSize, err := attrs.GetInt("fontsize", 0)
+	if err != nil {
+		return nil, tb.makeError(err.Error())
+	} else if fontSize < 0 {
+		return nil, tb.makeError("the font size of a block cannot be negative")
+	}
+
 	slice, err := tb.nodesToSlice(sn.SubNodes, d)
 	if err != nil {
 		return nil, err
 	}
 
 	return &BlockSegment{
-		Type:      segmentTypeMap[sn.Type],
-		Prefix:    sn.Prefix,
-		Message:   sn.Message,
-		FullWidth: attrs.GetBool("fullwidth", false),
-		SubItems:  slice,
+		Type:        segmentTypeMap[sn.Type],
+		Prefix:      sn.Prefix,
+		Message:     sn.Message,
+		FullWidth:   attrs.GetBool("fullwidth", false),
+		SubItems:    slice,
+		Messages:    sn.Messages,
+		Color:       attrs.GetDef("color", ""),
+		BorderColor: attrs.GetDef("bordercolor", ""),
+		TabColor:    attrs.GetDef("tabcolor", ""),
+		LineStyle:   lineStyle,
+		FontSize:    fontSize,
 	}, nil
 }
 
+// Returns the attributes of the participant style which are inherited by the segments of
+// blocks, as the participant style applied to them before blocks had a style of their own.
+// Only the attributes which blocks had then are inherited, as the others, such as color,
+// mean something else for participants.
+func (tb *treeBuilder) blockParticipantStyle() *AttributeSet {
+	participantStyle := tb.styleDefs[styleIdentifierParticipant]
+	if participantStyle == nil {
+		return nil
+	}
+
+	attrs := make(map[string]string)
+	if fullWidth, hasFullWidth := participantStyle.Get("fullwidth"); hasFullWidth {
+		attrs["fullwidth"] = fullWidth
+	}
+	return &AttributeSet{nil, attrs}
+}
+
+// Builds the attribute set of an element.  Attributes which are not set on the element are
+// inherited from the styles named in its class attribute, with later classes taking precedence
+// over earlier ones, and then from the parent.
 func (tb *treeBuilder) attrsToMap(attrs *parse.AttributeList, parent *AttributeSet) (*AttributeSet, error) {
 	attrMaps := make(map[string]string)
 
@@ -259,6 +738,14 @@ func (tb *treeBuilder) attrsToMap(attrs *parse.AttributeList, parent *AttributeS
 		attrMaps[attr.Name] = attr.Value
 	}
 
+	for _, class := range strings.Fields(attrMaps["class"]) {
+		style, hasStyle := tb.styleDefs[class]
+		if !hasStyle {
+			return nil, tb.makeError(fmt.Sprintf("undefined style class '%s'", class))
+		}
+		parent = style.inheriting(parent)
+	}
+
 	return &AttributeSet{parent, attrMaps}, nil
 }
 
@@ -268,6 +755,15 @@ type AttributeSet struct {
 	Attrs  map[string]string
 }
 
+// Returns a copy of the attribute set which inherits from parent once the attributes of
+// this set, and the sets it inherits from, are exhausted
+func (as *AttributeSet) inheriting(parent *AttributeSet) *AttributeSet {
+	if as == nil {
+		return parent
+	}
+	return &AttributeSet{as.Parent.inheriting(parent), as.Attrs}
+}
+
 // Get an attribute value and if the attribute is defined
 func (as *AttributeSet) Get(name string) (value string, hasValue bool) {
 	if value, hasValue = as.Attrs[name]; hasValue {
@@ -303,3 +799,16 @@ func (as *AttributeSet) GetBool(name string, def bool) bool {
 		return def
 	}
 }
+
+// Gets an integer value.  If the value is undefined, returns the default.
+func (as *AttributeSet) GetInt(name string, def int) (int, error) {
+	if value, hasValue := as.Get(name); hasValue {
+		intValue, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return def, fmt.Errorf("invalid value for %s: '%s'", name, value)
+		}
+		return intValue, nil
+	} else {
+		return def, nil
+	}
+}
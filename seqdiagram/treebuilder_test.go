@@ -0,0 +1,126 @@
+package seqdiagram
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefineAndUseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{
+			name: "sequence using itself",
+			src: "define ping(a, b)\n" +
+				"  a->b: ping\n" +
+				"  use ping(b, a)\n" +
+				"end\n" +
+				"use ping(A, B)\n",
+			wantErr: "test.seq:3: sequence 'ping' uses itself (defined at test.seq:1)\n" +
+				"\tin sequence 'ping' used at test.seq:5, defined at test.seq:1",
+		},
+		{
+			name: "sequences using each other",
+			src: "define ping(a, b)\n" +
+				"  use pong(b, a)\n" +
+				"end\n" +
+				"define pong(a, b)\n" +
+				"  use ping(b, a)\n" +
+				"end\n" +
+				"use ping(A, B)\n",
+			wantErr: "test.seq:5: sequence 'ping' uses itself (defined at test.seq:1)\n" +
+				"\tin sequence 'pong' used at test.seq:2, defined at test.seq:4\n" +
+				"\tin sequence 'ping' used at test.seq:7, defined at test.seq:1",
+		},
+		{
+			name:    "undefined sequence",
+			src:     "use ping(A, B)\n",
+			wantErr: "test.seq:1: sequence 'ping' is not defined",
+		},
+		{
+			name: "wrong number of participants",
+			src: "define ping(a, b)\n" +
+				"  a->b: ping\n" +
+				"end\n" +
+				"use ping(A)\n",
+			wantErr: "test.seq:4: sequence 'ping' expects 2 participants but was given 1 (defined at test.seq:1)",
+		},
+		{
+			name: "sequence defined twice",
+			src: "define ping(a, b)\n" +
+				"  a->b: ping\n" +
+				"end\n" +
+				"define ping(a)\n" +
+				"  a->a: ping\n" +
+				"end\n",
+			wantErr: "test.seq:4: sequence 'ping' is already defined at test.seq:1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := ParseDiagram(strings.NewReader(test.src), "test.seq")
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("want error:\n%s\ngot:\n%v", test.wantErr, err)
+			}
+			if d != nil {
+				t.Errorf("want no diagram on error")
+			}
+		})
+	}
+}
+
+func TestStyleClassPrecedence(t *testing.T) {
+	src := "style note (color=\"yellow\", bordercolor=\"grey\", shape=\"cloud\")\n" +
+		"style first (color=\"red\", bordercolor=\"maroon\")\n" +
+		"style second (color=\"blue\")\n" +
+		"note over A (class=\"first second\"): classes\n" +
+		"note over A (class=\"first second\", color=\"white\"): element\n" +
+		"note over A (class=\"second first\"): reversed\n" +
+		"note over A: type\n"
+
+	d, err := ParseDiagram(strings.NewReader(src), "test.seq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		message         string
+		wantColor       string
+		wantBorderColor string
+	}{
+		{"classes", "blue", "maroon"},
+		{"element", "white", "maroon"},
+		{"reversed", "red", "maroon"},
+		{"type", "yellow", "grey"},
+	}
+
+	if len(d.Items) != len(tests) {
+		t.Fatalf("want %d items, got %d", len(tests), len(d.Items))
+	}
+	for i, test := range tests {
+		note := d.Items[i].(*Note)
+		if note.Message != test.message {
+			t.Fatalf("want note '%s', got '%s'", test.message, note.Message)
+		}
+		if note.Color != test.wantColor || note.BorderColor != test.wantBorderColor || note.Shape != CloudNoteShape {
+			t.Errorf("note '%s': want colour %s, border colour %s and cloud shape, got %s, %s and %v",
+				test.message, test.wantColor, test.wantBorderColor, note.Color, note.BorderColor, note.Shape)
+		}
+	}
+}
+
+func TestUndefinedStyleClass(t *testing.T) {
+	src := "style first (color=\"red\")\n" +
+		"A->B (class=\"first x\"): hello\n"
+
+	d, err := ParseDiagram(strings.NewReader(src), "test.seq")
+	if wantErr := "test.seq:undefined style class 'x'"; err == nil || err.Error() != wantErr {
+		t.Errorf("want error '%s', got %v", wantErr, err)
+	}
+	if d != nil {
+		t.Errorf("want no diagram on error")
+	}
+}
@@ -7,3 +7,11 @@ func maxInt(x, y int) int {
 		return y
 	}
 }
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	} else {
+		return y
+	}
+}
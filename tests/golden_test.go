@@ -3,11 +3,19 @@ package tests
 import (
 	"bufio"
 	"bytes"
+	"compress/zlib"
 	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/kylelemons/godebug/diff"
@@ -33,8 +41,10 @@ func TestGolden(t *testing.T) {
 		t.Skip("Re-generated golden files")
 	}
 
-	// build results page
-	f, err := os.Create("testout.html")
+	// build results page.  This is written to the temp directory so that it can be
+	// viewed without being picked up as a change to the source tree.
+	resultsFile := filepath.Join(os.TempDir(), "goseq-testout.html")
+	f, err := os.Create(resultsFile)
 	noError(t, err)
 
 	defer f.Close()
@@ -101,6 +111,8 @@ func TestGolden(t *testing.T) {
 	noError(t, err)
 
 	noError(t, w.Flush())
+
+	t.Log("results page written to", resultsFile)
 }
 
 func buildTestBin(t *testing.T) string {
@@ -157,6 +169,19 @@ func runOut(tb testing.TB, name string, arg ...string) []byte {
 	return out
 }
 
+// runOutQuiet runs `cmd arg...` and returns stdout, discarding stderr. On error, it
+// logs and bails out.
+func runOutQuiet(tb testing.TB, name string, arg ...string) []byte {
+	c := exec.Command(name, arg...)
+
+	tb.Log(str2any(c.Args)...)
+
+	out, err := c.Output()
+	noError(tb, err, "Running ", name)
+
+	return out
+}
+
 // Str2interface converts a slice of strings to a slice of interfaces
 func str2any(s []string) []any {
 	anys := make([]any, 0, len(s))
@@ -166,3 +191,351 @@ func str2any(s []string) []any {
 	}
 	return anys
 }
+
+func TestTextGolden(t *testing.T) {
+	testFormatGolden(t, "testdata/input/*.seq", "text", ".txt")
+}
+
+func TestPlantUMLGolden(t *testing.T) {
+	testFormatGolden(t, "testdata/input/*.seq", "plantuml", ".puml")
+}
+
+func TestMermaidGolden(t *testing.T) {
+	testFormatGolden(t, "testdata/input/*.seq", "mermaid", ".mmd")
+}
+
+func TestJSONGolden(t *testing.T) {
+	testFormatGolden(t, "testdata/input/*.seq", "json", ".json")
+}
+
+// TestJSONRoundTrip checks that the JSON golden files are drawn the same as the .seq files
+// they were generated from.
+func TestJSONRoundTrip(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	entries, err := fs.Glob(os.DirFS("."), "testdata/golden/*.seq.json")
+	noError(t, err)
+
+	for _, e := range entries {
+		wantFile := strings.TrimSuffix(e, ".json") + ".svg"
+		want, err := os.ReadFile(wantFile)
+		noError(t, err)
+
+		got := runOut(t, testBin, e)
+
+		if !bytes.Equal(got, want) {
+			t.Log(diff.Diff(string(want), string(got)))
+			t.Fatalf("%s %q output does not match %q", testBin, e, wantFile)
+		}
+	}
+}
+
+func TestPlantUMLImportGolden(t *testing.T) {
+	testFormatGolden(t, "testdata/input/*.puml", "text", ".txt")
+}
+
+func TestMermaidImportGolden(t *testing.T) {
+	testFormatGolden(t, "testdata/input/*.mmd", "text", ".txt")
+}
+
+// testFormatGolden compares the output of each input file matching the pattern in a
+// particular format with the golden file with the given extension.  Any warnings written
+// to stderr are ignored.
+func testFormatGolden(t *testing.T, pattern, format, ext string) {
+	testBin := buildTestBin(t)
+
+	entries, err := fs.Glob(os.DirFS("."), pattern)
+	noError(t, err)
+
+	if *update {
+		for _, e := range entries {
+			runOutQuiet(t, testBin, "-T", format, "-o", filepath.Join("testdata", "golden", filepath.Base(e)+ext), e)
+		}
+
+		t.Skip("Re-generated golden files")
+	}
+
+	for _, e := range entries {
+		wantFile := filepath.Join("testdata", "golden", filepath.Base(e)+ext)
+		want, err := os.ReadFile(wantFile)
+		noError(t, err)
+
+		got := runOutQuiet(t, testBin, "-T", format, e)
+
+		if !bytes.Equal(got, want) {
+			t.Log(diff.Diff(string(want), string(got)))
+			t.Fatalf("%s %q output does not match %q", testBin, e, wantFile)
+		}
+	}
+}
+
+// TestFmtGolden compares the output of 'goseq fmt' for each .seq file with the golden
+// .fmt file.
+func TestFmtGolden(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	entries, err := fs.Glob(os.DirFS("."), "testdata/input/*.seq")
+	noError(t, err)
+
+	if *update {
+		for _, e := range entries {
+			got := runOut(t, testBin, "fmt", e)
+			noError(t, os.WriteFile(filepath.Join("testdata", "golden", filepath.Base(e)+".fmt"), got, 0644))
+		}
+
+		t.Skip("Re-generated golden files")
+	}
+
+	for _, e := range entries {
+		wantFile := filepath.Join("testdata", "golden", filepath.Base(e)+".fmt")
+		want, err := os.ReadFile(wantFile)
+		noError(t, err)
+
+		got := runOut(t, testBin, "fmt", e)
+
+		if !bytes.Equal(got, want) {
+			t.Log(diff.Diff(string(want), string(got)))
+			t.Fatalf("%s fmt %q output does not match %q", testBin, e, wantFile)
+		}
+	}
+}
+
+// TestFmtRoundTrip checks that the formatted golden files are already formatted, and are
+// drawn the same as the .seq files they were generated from.
+func TestFmtRoundTrip(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	entries, err := fs.Glob(os.DirFS("."), "testdata/golden/*.seq.fmt")
+	noError(t, err)
+
+	for _, e := range entries {
+		if got := runOut(t, testBin, "fmt", "-l", e); len(got) != 0 {
+			t.Fatalf("%s fmt -l %q: file is not formatted", testBin, e)
+		}
+
+		wantFile := strings.TrimSuffix(e, ".fmt") + ".svg"
+		want, err := os.ReadFile(wantFile)
+		noError(t, err)
+
+		got := runOut(t, testBin, e)
+
+		if !bytes.Equal(got, want) {
+			t.Log(diff.Diff(string(want), string(got)))
+			t.Fatalf("%s %q output does not match %q", testBin, e, wantFile)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	entries, err := fs.Glob(os.DirFS("."), "testdata/input/*.seq")
+	noError(t, err)
+
+	outDir := t.TempDir()
+	for _, e := range entries {
+		outFile := filepath.Join(outDir, filepath.Base(e)+".png")
+		runNoError(t, testBin, "-o", outFile, e)
+
+		img := decodePNG(t, outFile)
+
+		// the image should be the same size as the SVG
+		svgFile := filepath.Join("testdata", "golden", filepath.Base(e)+".svg")
+		wantW, wantH := svgSize(t, svgFile)
+		if b := img.Bounds(); b.Dx() != wantW || b.Dy() != wantH {
+			t.Fatalf("%s: want size %dx%d, got %dx%d", outFile, wantW, wantH, b.Dx(), b.Dy())
+		}
+
+		if !isWhite(img.At(0, 0)) {
+			t.Errorf("%s: want white background, got %v", outFile, img.At(0, 0))
+		}
+	}
+}
+
+func TestPNGPixels(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	outFile := filepath.Join(t.TempDir(), "test1.png")
+	runNoError(t, testBin, "-o", outFile, "testdata/input/test1.seq")
+
+	img := decodePNG(t, outFile)
+
+	// points taken from testdata/golden/test1.seq.svg
+	tests := []struct {
+		desc  string
+		x, y  int
+		white bool
+	}{
+		{"left edge of Andrew's box", 8, 24, false},
+		{"inside Andrew's box", 12, 24, true},
+		{"top edge of China's box", 210, 8, false},
+		{"message arrow", 130, 74, false},
+		{"message arrow head", 205, 74, false},
+		{"left edge of the note", 218, 110, false},
+		{"between the participants", 130, 200, true},
+	}
+
+	for _, tt := range tests {
+		if got := isWhite(img.At(tt.x, tt.y)); got != tt.white {
+			t.Errorf("%s at (%d, %d): want white = %v, got %v", tt.desc, tt.x, tt.y, tt.white, img.At(tt.x, tt.y))
+		}
+	}
+}
+
+func decodePNG(t *testing.T, file string) image.Image {
+	t.Helper()
+
+	f, err := os.Open(file)
+	noError(t, err)
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	noError(t, err, "decoding ", file)
+
+	return img
+}
+
+// svgSize returns the size of an SVG image written by goseq
+func svgSize(t *testing.T, file string) (int, int) {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	noError(t, err)
+
+	var w, h int
+	start := bytes.Index(data, []byte("<svg "))
+	_, err = fmt.Sscanf(string(data[start:]), "<svg width=\"%d\" height=\"%d\"", &w, &h)
+	noError(t, err, "reading size of ", file)
+
+	return w, h
+}
+
+func isWhite(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xf000 && g > 0xf000 && b > 0xf000
+}
+
+func TestPDF(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	entries, err := fs.Glob(os.DirFS("."), "testdata/input/*.seq")
+	noError(t, err)
+
+	outDir := t.TempDir()
+	for _, e := range entries {
+		outFile := filepath.Join(outDir, filepath.Base(e)+".pdf")
+		runNoError(t, testBin, "-o", outFile, e)
+
+		got, err := os.ReadFile(outFile)
+		noError(t, err)
+
+		if !bytes.HasPrefix(got, []byte("%PDF-")) || !bytes.HasSuffix(got, []byte("%%EOF\n")) {
+			t.Fatalf("%s: not a PDF document", outFile)
+		}
+
+		checkPDFXref(t, outFile, got)
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	testBin := buildTestBin(t)
+
+	outFile := filepath.Join(t.TempDir(), "test1.pdf")
+	runNoError(t, testBin, "-o", outFile, "testdata/input/test1.seq")
+
+	got, err := os.ReadFile(outFile)
+	noError(t, err)
+
+	// only the glyphs used are embedded, rather than the whole font
+	if len(got) > 100000 {
+		t.Errorf("%s: want at most 100000 bytes, got %d", outFile, len(got))
+	}
+
+	text := pdfText(t, got)
+	for _, want := range []string{"Andrew", "China", "Says Hello", "China thinks", "about it", "How are you?", "I am good thanks!"} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("%s: want text %q, got:\n%s", outFile, want, text)
+		}
+	}
+}
+
+// checkPDFXref checks that the cross-reference table of a PDF document points to
+// each of its objects
+func checkPDFXref(t *testing.T, file string, doc []byte) {
+	t.Helper()
+
+	start := bytes.LastIndex(doc, []byte("startxref\n"))
+	if start < 0 {
+		t.Fatalf("%s: no startxref", file)
+	}
+
+	var xrefOffset int
+	_, err := fmt.Sscanf(string(doc[start:]), "startxref\n%d", &xrefOffset)
+	noError(t, err, file, ": reading startxref")
+
+	var first, count int
+	_, err = fmt.Sscanf(string(doc[xrefOffset:]), "xref\n%d %d\n", &first, &count)
+	noError(t, err, file, ": reading xref")
+
+	entries := doc[bytes.IndexByte(doc[xrefOffset+5:], '\n')+xrefOffset+6:]
+	for i := 1; i < count; i++ {
+		var offset, gen int
+		_, err := fmt.Sscanf(string(entries[i*20:i*20+20]), "%d %d n", &offset, &gen)
+		noError(t, err, file, ": reading xref entry ", i)
+
+		if want := fmt.Sprintf("%d 0 obj\n", first+i); !bytes.HasPrefix(doc[offset:], []byte(want)) {
+			t.Errorf("%s: xref entry %d points to %q", file, i, doc[offset:offset+10])
+		}
+	}
+}
+
+// pdfText returns the text drawn in a PDF document written by goseq, one line per
+// text operator.  Glyphs are mapped back to text using the ToUnicode maps of the fonts.
+func pdfText(t *testing.T, doc []byte) string {
+	t.Helper()
+
+	var streams [][]byte
+	for rest := doc; ; {
+		start := bytes.Index(rest, []byte(">>\nstream\n"))
+		if start < 0 {
+			break
+		}
+		rest = rest[start+len(">>\nstream\n"):]
+
+		zr, err := zlib.NewReader(bytes.NewReader(rest))
+		noError(t, err)
+		data, err := io.ReadAll(zr)
+		noError(t, err)
+		streams = append(streams, data)
+	}
+
+	glyphs := make(map[string]string)
+	for _, s := range streams {
+		if !bytes.Contains(s, []byte("beginbfchar")) {
+			continue
+		}
+		for _, line := range strings.Split(string(s), "\n") {
+			var gid, u string
+			if _, err := fmt.Sscanf(line, "<%4s> <%4s>", &gid, &u); err == nil {
+				r, err := strconv.ParseUint(u, 16, 16)
+				noError(t, err)
+				glyphs[gid] = string(rune(r))
+			}
+		}
+	}
+
+	text := new(strings.Builder)
+	for _, s := range streams {
+		for _, line := range strings.Split(string(s), "\n") {
+			start, end := strings.Index(line, "<"), strings.Index(line, "> Tj")
+			if !strings.HasPrefix(line, "BT ") || start < 0 || end < start {
+				continue
+			}
+			for hex := line[start+1 : end]; len(hex) >= 4; hex = hex[4:] {
+				text.WriteString(glyphs[hex[:4]])
+			}
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}